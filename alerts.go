@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// documentAlert records a keyword found in a new version of a document
+// attached to a watched tender.
+type documentAlert struct {
+	ID       int64
+	TenderID string
+	Name     string
+	Version  int
+	Keyword  string
+	Found    time.Time
+}
+
+func (s store) watch(tenderID string) error {
+	_, err := s.db.Exec("insert into watches (tender_id, added) values (?, ?) on conflict do nothing", tenderID, time.Now())
+	if err != nil {
+		return fmt.Errorf("watching %s: %v", tenderID, err)
+	}
+	return nil
+}
+
+func (s store) unwatch(tenderID string) error {
+	_, err := s.db.Exec("delete from watches where tender_id = ?", tenderID)
+	if err != nil {
+		return fmt.Errorf("unwatching %s: %v", tenderID, err)
+	}
+	return nil
+}
+
+// checkDocumentAlerts records an alert for each of keywords that appears
+// in text, if doc belongs to a watched tender. Matching ignores case and
+// differences in whitespace.
+func (s store) checkDocumentAlerts(doc document, text string, keywords []string) ([]documentAlert, error) {
+	if len(keywords) == 0 {
+		return nil, nil
+	}
+
+	var watched bool
+	if err := s.db.QueryRow("select exists (select 1 from watches where tender_id = ?)", doc.TenderID).Scan(&watched); err != nil {
+		return nil, err
+	}
+	if !watched {
+		return nil, nil
+	}
+
+	norm := strings.ToLower(squeezeRe.ReplaceAllString(text, " "))
+
+	var alerts []documentAlert
+	for _, kw := range keywords {
+		if !strings.Contains(norm, strings.ToLower(squeezeRe.ReplaceAllString(kw, " "))) {
+			continue
+		}
+		a := documentAlert{TenderID: doc.TenderID, Name: doc.Name, Version: doc.Version, Keyword: kw, Found: time.Now()}
+		res, err := s.db.Exec("insert into document_alerts (tender_id, name, version, keyword, found) values (?, ?, ?, ?, ?)", a.TenderID, a.Name, a.Version, a.Keyword, a.Found)
+		if err != nil {
+			return nil, fmt.Errorf("insert document alert: %v", err)
+		}
+		if a.ID, err = res.LastInsertId(); err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, a)
+	}
+	return alerts, nil
+}
+
+// pendingDocumentAlerts returns alerts that haven't been notified yet.
+func (s store) pendingDocumentAlerts() ([]documentAlert, error) {
+	rows, err := s.db.Query("select id, tender_id, name, version, keyword, found from document_alerts where notified is null order by id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var alerts []documentAlert
+	for rows.Next() {
+		var a documentAlert
+		if err := rows.Scan(&a.ID, &a.TenderID, &a.Name, &a.Version, &a.Keyword, &a.Found); err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, a)
+	}
+	return alerts, rows.Err()
+}
+
+func (s store) markDocumentAlertsNotified(alerts []documentAlert) error {
+	now := time.Now()
+	for _, a := range alerts {
+		if _, err := s.db.Exec("update document_alerts set notified = ? where id = ?", now, a.ID); err != nil {
+			return fmt.Errorf("marking alert %d notified: %v", a.ID, err)
+		}
+	}
+	return nil
+}
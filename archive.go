@@ -0,0 +1,370 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// archivedTender is a tender as recorded in the store.
+type archivedTender struct {
+	Tender
+	FirstObserved time.Time
+}
+
+// recentTenders returns up to limit tenders, most recently observed first.
+func (s store) recentTenders(limit int) ([]archivedTender, error) {
+	rows, err := s.db.Query("select id, url, description, agency, issued, close, first_observed from tenders order by first_observed desc, id limit ?", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []archivedTender
+	for rows.Next() {
+		var t archivedTender
+		if err := rows.Scan(&t.ID, &t.URL, &t.Description, &t.Agency, &t.IssuedDate, &t.CloseDate, &t.FirstObserved); err != nil {
+			return nil, err
+		}
+		res = append(res, t)
+	}
+	return res, rows.Err()
+}
+
+// tenderQuery narrows down the tenders browsed in serve's archive.
+type tenderQuery struct {
+	// Search has words that must all appear in the description, ignoring
+	// case, or not appear if prefixed with -, as in saved searches.
+	Search string
+	Agency string
+	// ClosesFrom and ClosesTo bound the close date, inclusive, if set.
+	ClosesFrom, ClosesTo time.Time
+}
+
+// queryTenders returns up to limit tenders matching q, most recently
+// observed first, skipping the first offset, along with how many match in
+// all.
+func (s store) queryTenders(q tenderQuery, limit, offset int) ([]archivedTender, int, error) {
+	var where []string
+	var args []any
+	for _, term := range strings.Fields(strings.ToLower(q.Search)) {
+		if neg, ok := strings.CutPrefix(term, "-"); ok && neg != "" {
+			where = append(where, "instr(lower(description), ?) = 0")
+			args = append(args, neg)
+			continue
+		}
+		where = append(where, "instr(lower(description), ?) > 0")
+		args = append(args, term)
+	}
+	if q.Agency != "" {
+		where = append(where, "agency = ?")
+		args = append(args, q.Agency)
+	}
+	if !q.ClosesFrom.IsZero() {
+		where = append(where, "close >= ?")
+		args = append(args, q.ClosesFrom.Format(dateFormat))
+	}
+	if !q.ClosesTo.IsZero() {
+		// Close dates may read back with a time, so compare with the next day.
+		where = append(where, "close < ?")
+		args = append(args, q.ClosesTo.AddDate(0, 0, 1).Format(dateFormat))
+	}
+	cond := ""
+	if len(where) > 0 {
+		cond = " where " + strings.Join(where, " and ")
+	}
+
+	var total int
+	if err := s.db.QueryRow("select count(*) from tenders"+cond, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := s.db.Query("select id, url, description, agency, issued, close, first_observed from tenders"+cond+" order by first_observed desc, id limit ? offset ?",
+		append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var res []archivedTender
+	for rows.Next() {
+		var t archivedTender
+		if err := rows.Scan(&t.ID, &t.URL, &t.Description, &t.Agency, &t.IssuedDate, &t.CloseDate, &t.FirstObserved); err != nil {
+			return nil, 0, err
+		}
+		res = append(res, t)
+	}
+	return res, total, rows.Err()
+}
+
+// agencies returns the agencies of stored tenders, by name.
+func (s store) agencies() ([]string, error) {
+	rows, err := s.db.Query("select distinct agency from tenders where agency != '' order by agency")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []string
+	for rows.Next() {
+		var a string
+		if err := rows.Scan(&a); err != nil {
+			return nil, err
+		}
+		res = append(res, a)
+	}
+	return res, rows.Err()
+}
+
+// archivedTender returns the tender with id, or sql.ErrNoRows.
+func (s store) archivedTender(id string) (archivedTender, error) {
+	var t archivedTender
+	err := s.db.QueryRow("select id, url, description, agency, issued, close, first_observed, length(close) = 10 from tenders where id = ?", id).
+		Scan(&t.ID, &t.URL, &t.Description, &t.Agency, &t.IssuedDate, &t.CloseDate, &t.FirstObserved, &t.closeDateOnly)
+	return t, err
+}
+
+// loadDetails fills in what's stored about t beyond the tenders table:
+// events, bid security, trade terms, UNSPSC codes, contacts and its detail
+// page.
+func (s store) loadDetails(t *Tender) error {
+	rows, err := s.db.Query("select kind, at, mandatory from tender_events where tender_id = ? order by at", t.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e tenderEvent
+		if err := rows.Scan(&e.Kind, &e.At, &e.Mandatory); err != nil {
+			return err
+		}
+		t.Events = append(t.Events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	var b bidSecurity
+	err = s.db.QueryRow("select amount, percent from bid_security where tender_id = ?", t.ID).Scan(&b.Amount, &b.Percent)
+	if err == nil {
+		t.BidSecurity = &b
+	} else if err != sql.ErrNoRows {
+		return err
+	}
+
+	var tt tradeTerms
+	var agreements string
+	err = s.db.QueryRow("select agreements, local_only from trade_terms where tender_id = ?", t.ID).Scan(&agreements, &tt.LocalOnly)
+	if err == nil {
+		if agreements != "" {
+			tt.Agreements = strings.Split(agreements, ",")
+		}
+		t.TradeTerms = &tt
+	} else if err != sql.ErrNoRows {
+		return err
+	}
+
+	codes, err := s.db.Query("select code from tender_unspsc where tender_id = ? order by code", t.ID)
+	if err != nil {
+		return err
+	}
+	defer codes.Close()
+	for codes.Next() {
+		var c string
+		if err := codes.Scan(&c); err != nil {
+			return err
+		}
+		t.UNSPSC = append(t.UNSPSC, c)
+	}
+	if err := codes.Err(); err != nil {
+		return err
+	}
+
+	contacts, err := s.db.Query("select c.email, c.name from tender_contacts tc join contacts c on c.email = tc.email where tc.tender_id = ? order by c.email", t.ID)
+	if err != nil {
+		return err
+	}
+	defer contacts.Close()
+	for contacts.Next() {
+		var c contact
+		if err := contacts.Scan(&c.Email, &c.Name); err != nil {
+			return err
+		}
+		t.Contacts = append(t.Contacts, c)
+	}
+	if err := contacts.Err(); err != nil {
+		return err
+	}
+
+	t.Detail, err = s.detail(t.ID)
+	return err
+}
+
+// tendersSince returns tenders first observed at or after since, oldest
+// first.
+func (s store) tendersSince(since time.Time) ([]archivedTender, error) {
+	rows, err := s.db.Query("select id, url, description, agency, issued, close, first_observed from tenders where first_observed >= ? order by first_observed, id", since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []archivedTender
+	for rows.Next() {
+		var t archivedTender
+		if err := rows.Scan(&t.ID, &t.URL, &t.Description, &t.Agency, &t.IssuedDate, &t.CloseDate, &t.FirstObserved); err != nil {
+			return nil, err
+		}
+		res = append(res, t)
+	}
+	return res, rows.Err()
+}
+
+// pendingTenders returns tenders that haven't been notified about yet,
+// oldest first. Those found only in alert emails wait until a scrape fills
+// in their dates.
+func (s store) pendingTenders() ([]Tender, error) {
+	return s.selectTenders("select " + tenderColumns + ` from tenders
+		where id not in (select tender_id from notified_tenders) and id not in (select tender_id from tender_retractions)
+		and id not in (select tender_id from alert_tenders where reconciled is null)
+		order by first_observed, id`)
+}
+
+// tenderColumns are the columns of tenders selectTenders takes. A close
+// date stored before times of day were kept is just the date's 10
+// characters.
+const tenderColumns = "id, url, description, agency, issued, close, coalesce(source, ''), length(close) = 10"
+
+// selectTenders returns the tenders query selects, with their details. It
+// selects tenderColumns.
+func (s store) selectTenders(query string, args ...any) ([]Tender, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	var res []Tender
+	for rows.Next() {
+		var t Tender
+		if err := rows.Scan(&t.ID, &t.URL, &t.Description, &t.Agency, &t.IssuedDate, &t.CloseDate, &t.source, &t.closeDateOnly); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		res = append(res, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range res {
+		if err := s.loadDetails(&res[i]); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// markTendersNotified records that ts have been dealt with, whether they
+// were sent or filtered out.
+func (s store) markTendersNotified(ts []Tender) error {
+	now := time.Now()
+	for _, t := range ts {
+		if _, err := s.db.Exec("insert into notified_tenders (tender_id, at) values (?, ?) on conflict do nothing", t.ID, now); err != nil {
+			return fmt.Errorf("marking %s notified: %v", t.ID, err)
+		}
+		// Its announcement has whatever changed since it was stored.
+		if _, err := s.db.Exec("update tender_changes set notified = ? where tender_id = ? and notified is null", now, t.ID); err != nil {
+			return fmt.Errorf("marking %s changes notified: %v", t.ID, err)
+		}
+	}
+	return nil
+}
+
+// openTenders returns the tenders in ts that close after now's date.
+func openTenders(ts []archivedTender, now time.Time) []archivedTender {
+	today := now.Format(dateFormat)
+	var res []archivedTender
+	for _, t := range ts {
+		if t.CloseDate.Format(dateFormat) > today {
+			res = append(res, t)
+		}
+	}
+	return res
+}
+
+// printTenders writes ts to w, one per line.
+func printTenders(w io.Writer, ts []archivedTender) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tFIRST SEEN\tCLOSES\tAGENCY\tDESCRIPTION")
+	for _, t := range ts {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", t.ID, t.FirstObserved.Format(dateFormat), t.CloseDate.Format(dateFormat), t.Agency, t.Description)
+	}
+	return tw.Flush()
+}
+
+// exportTenders writes ts to w as JSON, one object per line, with
+// everything stored about them but what rd redacts for exports.
+func exportTenders(w io.Writer, st store, ts []archivedTender, rd redactions) error {
+	enc := json.NewEncoder(w)
+	for _, t := range ts {
+		if err := st.loadDetails(&t.Tender); err != nil {
+			return fmt.Errorf("%s: %w", t.ID, err)
+		}
+		rd.apply("export", &t.Tender)
+		if err := enc.Encode(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportTendersCSV writes ts to w as CSV with a header row and everything
+// stored about them but what rd redacts for exports, with lists joined by
+// "; ".
+func exportTendersCSV(w io.Writer, st store, ts []archivedTender, rd redactions) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"id", "url", "description", "agency", "issued", "close", "first_observed",
+		"events", "bid_security", "trade_terms", "unspsc", "contacts", "scope", "documents", "addenda"})
+	for _, t := range ts {
+		if err := st.loadDetails(&t.Tender); err != nil {
+			return fmt.Errorf("%s: %w", t.ID, err)
+		}
+		rd.apply("export", &t.Tender)
+		var events, contacts, documents, addenda []string
+		for _, e := range t.Events {
+			events = append(events, e.String())
+		}
+		for _, c := range t.Contacts {
+			contacts = append(contacts, c.String())
+		}
+		var bidSecurity, tradeTerms, scope string
+		if t.BidSecurity != nil {
+			bidSecurity = t.BidSecurity.String()
+		}
+		if t.TradeTerms != nil {
+			tradeTerms = t.TradeTerms.String()
+		}
+		if d := t.Detail; d != nil {
+			scope = d.Scope
+			for _, f := range d.Documents {
+				documents = append(documents, f.Name)
+			}
+			for _, f := range d.Addenda {
+				addenda = append(addenda, f.Name)
+			}
+		}
+		cw.Write([]string{
+			t.ID, t.URL, t.Description, t.Agency,
+			t.IssuedDate.Format(dateFormat), t.CloseDate.Format(dateFormat), t.FirstObserved.Format(time.RFC3339),
+			strings.Join(events, "; "), bidSecurity, tradeTerms, strings.Join(t.UNSPSC, "; "),
+			strings.Join(contacts, "; "), scope, strings.Join(documents, "; "), strings.Join(addenda, "; "),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+// The benchmarks measure the layers between a portal response and the
+// store over the search response in testdata/search.json: decoding it,
+// parsing its items into tenders, normalizing descriptions, and storing
+// the tenders in a fresh database.
+
+// benchCorpus returns the raw search response in testdata and its items.
+func benchCorpus(b *testing.B) ([]byte, []RawTender) {
+	b.Helper()
+	body, err := os.ReadFile("testdata/search.json")
+	if err != nil {
+		b.Fatal(err)
+	}
+	var rts RawTenders
+	if err := json.Unmarshal(body, &rts); err != nil {
+		b.Fatal(err)
+	}
+	return body, rts.Data
+}
+
+func benchClient(b *testing.B) *Client {
+	b.Helper()
+	cl, err := NewClient(portalURL, portalAgency)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return cl
+}
+
+func BenchmarkDecode(b *testing.B) {
+	body, corpus := benchCorpus(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		var n int
+		_, err := decodeSearch(bytes.NewReader(body), func(RawTender) error {
+			n++
+			return nil
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+		if n != len(corpus) {
+			b.Fatalf("decoded %d items, want %d", n, len(corpus))
+		}
+	}
+}
+
+func BenchmarkParse(b *testing.B) {
+	_, corpus := benchCorpus(b)
+	cl := benchClient(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		for _, d := range corpus {
+			if _, err := cl.parse(d); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkNormalize(b *testing.B) {
+	_, corpus := benchCorpus(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		for _, d := range corpus {
+			seriesKey(cleanText(d.Title))
+		}
+	}
+}
+
+func BenchmarkStore(b *testing.B) {
+	_, corpus := benchCorpus(b)
+	cl := benchClient(b)
+	var ts []Tender
+	for _, d := range corpus {
+		t, err := cl.parse(d)
+		if err != nil {
+			b.Fatal(err)
+		}
+		t.raw, _ = json.Marshal(d)
+		ts = append(ts, t)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		b.StopTimer()
+		st, closeDB := benchStore(b)
+		b.StartTimer()
+		for _, t := range ts {
+			if _, _, err := storeTender(context.Background(), nil, st, t); err != nil {
+				b.Fatal(err)
+			}
+		}
+		b.StopTimer()
+		closeDB()
+		b.StartTimer()
+	}
+}
+
+// benchStore returns a store in a fresh in-memory database.
+func benchStore(b *testing.B) (store, func()) {
+	b.Helper()
+	db, err := sql.Open("sqlite", "file::memory:?_time_format=sqlite")
+	if err != nil {
+		b.Fatal(err)
+	}
+	// Each connection would get a database of its own.
+	db.SetMaxOpenConns(1)
+	if err := migrate(db); err != nil {
+		db.Close()
+		b.Fatal(err)
+	}
+	return store{db: db}, func() { db.Close() }
+}
@@ -0,0 +1,839 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/playwright-community/playwright-go"
+)
+
+// Client is a Source for a bids&tenders portal, such as
+// halifax.bidsandtenders.ca, driven with a headless browser.
+type Client struct {
+	u           *url.URL
+	agency      string
+	idPrefix    string
+	pw          *playwright.Playwright
+	b           playwright.Browser
+	p           playwright.Page
+	dp          playwright.Page // for detail pages
+	ready       bool
+	strict      bool
+	egress      egress
+	browser     browserConfig
+	unspsc      unspscMap
+	seen        int
+	initTimeout time.Duration
+	pageTimeout time.Duration
+	direct      bool // list with plain HTTP requests, see listDirect
+	// backdate sets tenders' observed to when the portal says they were
+	// made available.
+	backdate bool
+	hc       *http.Client
+	page     int    // pages listed so far
+	lastPage string // item IDs on the last page, to spot repeats
+	// short is set once listing stops without getting through it all,
+	// for stoppedShort.
+	short bool
+	// resume is set after listing a page with the browser failed and it
+	// was closed, so the next List pages back to where it was.
+	resume bool
+	// responses are search response bodies waiting to be listed, kept
+	// undecoded since decoding them all up front would hold every item.
+	responses responseQueue
+	// unlisted counts the responses dropped and merged by the queue, for
+	// the run's record, since it's drained each time the browser closes.
+	unlisted responseCounts
+	// handlers tracks the current page's response handlers reading bodies.
+	handlers *responseHandlers
+	// session, if set, is the browser to open a context in rather than
+	// starting one, left running on Close.
+	session *browserSession
+	// archive, if set, gets each search response as it arrived.
+	archive *responseArchive
+}
+
+const (
+	portalURL    = "https://halifax.bidsandtenders.ca/Module/Tenders/en"
+	portalAgency = "Halifax Regional Municipality"
+)
+
+// NewClient returns a Client for the portal's tender module at baseURL,
+// listing tenders as issued by agency.
+func NewClient(baseURL, agency string) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{u: u, agency: agency, responses: responseQueue{max: maxQueuedResponses}}, nil
+}
+
+func (c *Client) Name() string {
+	return c.u.String()
+}
+
+// List lists a page, giving up after the client's timeouts.
+func (c *Client) List(ctx context.Context, token string) (_ []Tender, nextToken string, _ error) {
+	if c.direct {
+		var ts []Tender
+		var next string
+		err := runStage(ctx, fmt.Sprintf("listing page %d directly", c.page+1), c.pageTimeout, func(ctx context.Context) error {
+			var err error
+			ts, next, err = c.listDirect(ctx, token)
+			return err
+		})
+		if err == nil {
+			return ts, next, nil
+		}
+		if token != "" {
+			return nil, "", err
+		}
+		// The browser can only start from the first page.
+		slog.Warn("listing directly failed, falling back to the browser", "source", c.Name(), "err", err)
+		c.direct = false
+		c.page, c.seen, c.lastPage, c.short = 0, 0, "", false
+	}
+
+	if !c.ready {
+		if err := runStage(ctx, "starting browser", c.initTimeout, c.init); err != nil {
+			return nil, "", err
+		}
+	}
+	if c.resume {
+		if err := runStage(ctx, fmt.Sprintf("paging back to page %d", c.page), c.pageTimeout*time.Duration(c.page), c.pageBack); err != nil {
+			c.reset()
+			return nil, "", err
+		}
+	}
+
+	// Results go through locals, since listPage keeps running if it
+	// times out.
+	var ts []Tender
+	var next string
+	err := runStage(ctx, fmt.Sprintf("listing page %d", c.page+1), c.pageTimeout, func(ctx context.Context) error {
+		var err error
+		ts, next, err = c.listPage(ctx, token)
+		return err
+	})
+	if err != nil {
+		var ae anomalyError
+		if !errors.As(err, &ae) {
+			c.reset()
+		}
+		return nil, "", err
+	}
+	return ts, next, nil
+}
+
+// stoppedShort reports whether listing stopped without getting through
+// all of the portal's pages, or listed fewer items than it said it had.
+func (c *Client) stoppedShort() bool {
+	return c.short
+}
+
+// reset closes the browser after listing a page failed, since that may
+// have left it anywhere, so listing the page again starts the portal
+// afresh and pages back to where listing got to.
+func (c *Client) reset() {
+	if err := c.Close(); err != nil {
+		slog.Warn("closing browser after listing failed", "source", c.Name(), "err", err)
+	}
+	c.p, c.dp, c.ready = nil, nil, false
+	c.resume = c.page > 0
+}
+
+// pageBack clicks through the pages already listed on a freshly started
+// portal, dropping their search responses, so the next page listed is
+// the one after them.
+func (c *Client) pageBack(ctx context.Context) error {
+	for i := range c.page {
+		if i > 0 {
+			if err := c.nextEnabled().Click(playwright.LocatorClickOptions{Timeout: pwTimeout(ctx)}); err != nil {
+				return fmt.Errorf("clicking next: %w", err)
+			}
+		}
+		if _, err := c.searchResponse(ctx, i); err != nil {
+			return fmt.Errorf("paging back through page %d: %w", i+1, err)
+		}
+	}
+	c.resume = false
+	return nil
+}
+
+// listTableSelector is the table of tenders on the portal's listing.
+const listTableSelector = "#myRepeater > div.repeater-viewport > div.repeater-canvas.borderless-grid > div > div > table > tbody"
+
+// searchResponseTimeout is how long after loading a page of the listing
+// its search response may take to arrive.
+const searchResponseTimeout = 30 * time.Second
+
+// nextEnabledTimeout is how long the next page button may take to enable
+// once a page is listed, when the portal says there are more.
+const nextEnabledTimeout = 10 * time.Second
+
+var errNoSearchResponse = errors.New("no search response")
+
+// maxSearchResponseSize is the most of a search response that's listed,
+// so a handful of queued responses can't take all the memory there is.
+// Even backfill pages of every item run to a few MiB.
+const maxSearchResponseSize = 32 << 20
+
+var errSearchResponseTooLarge = fmt.Errorf("search response larger than %d MiB", maxSearchResponseSize>>20)
+
+var errInvalidSearchResponse = errors.New("invalid search response JSON")
+
+// searchResponse waits for the search response for page index of the
+// listing, rather than for some fixed time, so pages are listed as soon
+// as they arrive.
+func (c *Client) searchResponse(ctx context.Context, index int) ([]byte, error) {
+	wctx, cancel := context.WithTimeout(ctx, searchResponseTimeout)
+	defer cancel()
+	body, err := c.responses.wait(wctx, index)
+	if err != nil && ctx.Err() == nil {
+		return nil, fmt.Errorf("%w after %v", errNoSearchResponse, searchResponseTimeout)
+	}
+	return body, err
+}
+
+// nextEnabled is the portal's next page button once it's enabled. The
+// pager is rendered after the search response arrives, so this is waited
+// for rather than the button checked the moment the response is in.
+func (c *Client) nextEnabled() playwright.Locator {
+	return c.p.GetByLabel("next page").And(c.p.Locator(":enabled"))
+}
+
+func (c *Client) listPage(ctx context.Context, token string) (_ []Tender, nextToken string, _ error) {
+	if token != "" {
+		if err := c.nextEnabled().Click(playwright.LocatorClickOptions{Timeout: pwTimeout(ctx)}); err != nil {
+			return nil, "", fmt.Errorf("clicking next: %w", err)
+		}
+	}
+
+	body, err := c.searchResponse(ctx, c.page)
+	if errors.Is(err, errNoSearchResponse) && token != "" && !c.responses.wasRequested(c.page) {
+		// Some portals leave next enabled past the last page without
+		// loading anything. A page that was searched for but whose
+		// response went missing fails, to be retried.
+		c.short = true
+		return nil, "", c.warn("next page %d sent no search, stopping", c.page+1)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	err = c.p.Locator(listTableSelector).WaitFor(playwright.LocatorWaitForOptions{Timeout: pwTimeout(ctx)})
+	if err != nil {
+		return nil, "", fmt.Errorf("waiting for table: %w", err)
+	}
+
+	r, err := c.decodePage(bytes.NewReader(body))
+	if err != nil {
+		return nil, "", err
+	}
+	tenders, stop, err := c.listed(token, r)
+	if err != nil || stop {
+		return nil, "", err
+	}
+
+	// Going by the total rather than the button, which may not have been
+	// rendered for this page yet. A next button that never enables while
+	// the total says there's more is caught by checkTotal.
+	if c.seen < r.total {
+		err := c.nextEnabled().WaitFor(playwright.LocatorWaitForOptions{Timeout: pwTimeout(ctx, nextEnabledTimeout)})
+		if err == nil {
+			nextToken = "next"
+		} else if ctx.Err() != nil {
+			return nil, "", ctx.Err()
+		} else if !errors.Is(err, playwright.ErrTimeout) {
+			return nil, "", fmt.Errorf("waiting for next to enable: %w", err)
+		}
+	}
+
+	if err := c.checkTotal(nextToken, r.total); err != nil {
+		return nil, "", err
+	}
+	return tenders, nextToken, nil
+}
+
+// saveResponse archives body, a search response, logging rather than
+// failing if it can't be.
+func (c *Client) saveResponse(body []byte) {
+	if err := c.archive.save(c.u.Host, time.Now(), body); err != nil {
+		slog.Error("archiving search response", "host", c.u.Host, "err", err)
+	}
+}
+
+// searchPage is a search response with its items parsed.
+type searchPage struct {
+	success bool
+	total   int
+	// ids are the portal's IDs of the items, in order, including any that
+	// couldn't be parsed.
+	ids     []string
+	tenders []Tender
+}
+
+// decodePage decodes and parses the search response in body an item at a
+// time, so the response's items are never all held at once.
+func (c *Client) decodePage(body io.Reader) (searchPage, error) {
+	var p searchPage
+	r, err := decodeSearch(body, func(d RawTender) error {
+		p.ids = append(p.ids, d.ID)
+		raw, _ := json.Marshal(d)
+		t, err := c.parse(d)
+		if err != nil {
+			return c.warn("skipping unparseable item: %v: %s", err, raw)
+		}
+		t.raw = raw
+		p.tenders = append(p.tenders, t)
+		return nil
+	})
+	if err != nil {
+		return searchPage{}, fmt.Errorf("decoding search response: %w", err)
+	}
+	p.success, p.total = r.Success, r.Total
+	return p, nil
+}
+
+// listed checks r, the search response for the page after token, and
+// returns its tenders. stop is set if the portal has run out of pages
+// without saying so.
+func (c *Client) listed(token string, r searchPage) (_ []Tender, stop bool, _ error) {
+	sig := strings.Join(r.ids, ",")
+	if token != "" && (len(r.ids) == 0 || sig == c.lastPage) {
+		// Or they serve an empty page, or the last page again.
+		c.short = true
+		return nil, true, c.warn("next page %d was empty or repeated page %d, stopping", c.page+1, c.page)
+	}
+	c.page++
+	c.lastPage = sig
+
+	if !r.success {
+		if err := c.warn("search response not marked successful (total %d, %d items)", r.total, len(r.ids)); err != nil {
+			return nil, false, err
+		}
+	}
+	if token == "" && len(r.ids) == 0 {
+		if err := c.warn("no tenders listed on first page (total %d)", r.total); err != nil {
+			return nil, false, err
+		}
+	}
+	c.seen += len(r.ids)
+	return r.tenders, false, nil
+}
+
+// checkTotal checks, after the last page, that as many items were listed
+// as the portal said there were.
+func (c *Client) checkTotal(nextToken string, total int) error {
+	if nextToken == "" && c.seen != total {
+		c.short = true
+		return c.warn("listed %d items across all pages but portal reported total %d", c.seen, total)
+	}
+	return nil
+}
+
+// anomalyError is a data-quality anomaly, failing the run in strict mode.
+type anomalyError struct {
+	msg string
+}
+
+func (e anomalyError) Error() string { return e.msg }
+
+// warn reports a data-quality anomaly. In strict mode it is returned as an
+// error so the run fails, otherwise it is logged and the run continues.
+func (c *Client) warn(format string, args ...any) error {
+	msg := fmt.Sprintf(format, args...)
+	if c.strict {
+		return anomalyError{msg}
+	}
+	slog.Warn(msg, "source", c.Name())
+	return nil
+}
+
+func (c *Client) parse(d RawTender) (Tender, error) {
+	var t Tender
+
+	id, rest, ok := strings.Cut(d.Title, " ")
+	if !ok {
+		return Tender{}, fmt.Errorf("cutting title %q", d.Title)
+	}
+
+	rest = strings.TrimSpace(rest)
+	rest = strings.TrimPrefix(rest, "-")
+	rest = cleanText(rest)
+
+	t.ID = c.idPrefix + id
+	t.detailID = d.ID
+	t.cancelled = strings.Contains(strings.ToLower(d.Status), "cancel")
+	t.status = d.Status
+	t.addenda = d.Addendums
+	t.URL = c.u.ResolveReference(&url.URL{Path: "/Module/Tenders/en/Tender/Detail/" + d.ID}).String()
+	t.Description = rest
+	t.Agency = c.agency
+	t.Events = detectEvents(d.Scope + "\n" + d.Description)
+	t.BidSecurity = detectBidSecurity(d.Scope + "\n" + d.Description)
+	t.TradeTerms = detectTradeTerms(d.Scope + "\n" + d.Description)
+	t.UNSPSC = c.unspsc.codes(t.Description + "\n" + d.Scope)
+	t.Contacts = detectContacts(d.Scope + "\n" + d.Description)
+
+	// The display dates are wall clock times where the portal is.
+	loc := labelLocation(d.TimeZoneLabel)
+	var err error
+	t.IssuedDate, err = time.ParseInLocation("Mon Jan 2, 2006 3:04:05 PM", d.DateAvailableDisplay, loc)
+	if err != nil {
+		return Tender{}, fmt.Errorf("parsing issued date: %w", err)
+	}
+
+	t.CloseDate, err = time.ParseInLocation("Mon Jan 2, 2006 3:04:05 PM", d.DateClosingDisplay, loc)
+	if err != nil {
+		return Tender{}, fmt.Errorf("parsing close date: %w", err)
+	}
+
+	if c.backdate && t.IssuedDate.Year() != 9999 {
+		t.observed = availableAt(d, t.IssuedDate)
+	}
+
+	now := time.Now()
+	if t.IssuedDate.Year() == 9999 {
+		t.IssuedDate = now
+	}
+	if t.CloseDate.Year() == 9999 {
+		t.CloseDate = now
+		t.closeUnknown = true
+	}
+
+	return t, nil
+}
+
+func (c *Client) Close() error {
+	// Wait for responses still being read so they're counted below rather
+	// than queued after.
+	if c.handlers != nil {
+		c.handlers.close()
+		c.handlers = nil
+	}
+	if unlisted, dropped, merged := c.responses.drain(); unlisted+dropped+merged > 0 {
+		slog.Info("search responses not listed", "source", c.Name(), "unlisted", unlisted, "dropped", dropped, "merged", merged)
+		c.unlisted.Dropped += dropped
+		c.unlisted.Merged += merged
+	}
+	if c.session != nil && c.p != nil {
+		err := c.p.Context().Close()
+		c.p, c.dp, c.ready = nil, nil, false
+		return err
+	}
+	if c.b != nil {
+		if err := c.b.Close(); err != nil {
+			return err
+		}
+		c.b = nil
+	}
+	if c.pw != nil {
+		if err := c.pw.Stop(); err != nil {
+			return err
+		}
+		c.pw = nil
+	}
+	return nil
+}
+
+func (c *Client) init(ctx context.Context) error {
+	if c.ready {
+		return nil
+	}
+
+	var pw *playwright.Playwright
+	var browser playwright.Browser
+	var err error
+	if c.session != nil {
+		browser, err = c.session.browser()
+	} else {
+		pw, browser, err = launchBrowser(c.egress, c.browser)
+	}
+	if err != nil {
+		return err
+	}
+	bctx, err := browser.NewContext(c.browser.contextOptions())
+	if err != nil {
+		return fmt.Errorf("creating context: %w", err)
+	}
+	page, err := bctx.NewPage()
+	if err != nil {
+		return fmt.Errorf("creating page: %w", err)
+	}
+
+	page.On("request", func(r playwright.Request) {
+		defer recoverHandler(c.Name())
+		if !isSearchURL(r.URL()) || !strings.EqualFold(searchStatus(r), "all") {
+			return
+		}
+		if index, ok := searchPageIndex(r); ok {
+			c.responses.request(index)
+		}
+	})
+	handlers := &responseHandlers{}
+	page.On("response", func(r playwright.Response) {
+		defer recoverHandler(c.Name())
+		if !isSearchURL(r.URL()) {
+			return
+		}
+		// Only listings of every status are listed, not the default view
+		// the portal loads with before init clicks all.
+		if status := searchStatus(r.Request()); !strings.EqualFold(status, "all") {
+			slog.Debug("ignoring search response not for all statuses", "source", c.Name(), "status", status)
+			return
+		}
+		index, ok := searchPageIndex(r.Request())
+		if !ok {
+			slog.Warn("ignoring search response for no page", "source", c.Name())
+			return
+		}
+		if !handlers.start() {
+			slog.Debug("ignoring search response that arrived after closing", "source", c.Name())
+			return
+		}
+
+		go func() {
+			defer handlers.done()
+			defer recoverHandler(c.Name())
+			b, err := r.Body()
+			if err != nil {
+				slog.Error("reading search response", "source", c.Name(), "err", err)
+				return
+			}
+			c.saveResponse(b)
+			if len(b) > maxSearchResponseSize {
+				slog.Error("search response too large to list", "source", c.Name(), "page", index+1, "size", len(b))
+				c.responses.fail(index, errSearchResponseTooLarge)
+				return
+			}
+			if !json.Valid(b) {
+				slog.Error("search response isn't valid JSON", "source", c.Name(), "page", index+1, "size", len(b))
+				c.responses.fail(index, errInvalidSearchResponse)
+				return
+			}
+			c.responses.push(index, b)
+		}()
+	})
+	if c.handlers != nil {
+		c.handlers.close()
+	}
+	c.handlers = handlers
+
+	if _, err = page.Goto(c.u.String(), playwright.PageGotoOptions{Timeout: pwTimeout(ctx)}); err != nil {
+		return fmt.Errorf("going to page: %w", err)
+	}
+
+	// page.get_by_role("button", name="Open Toggle Filters").click()
+	if err := page.GetByRole(*playwright.AriaRoleButton, playwright.PageGetByRoleOptions{Name: "Open Toggle Filters"}).Click(playwright.LocatorClickOptions{Timeout: pwTimeout(ctx)}); err != nil {
+		return fmt.Errorf("clicking open toggle filters: %w", err)
+	}
+	// page.get_by_label("all", exact=True).click()
+	if err := c.clickAll(ctx, page); err != nil {
+		return err
+	}
+
+	if c.session == nil {
+		c.pw = pw
+		c.b = browser
+	}
+	c.p = page
+	c.ready = true
+	return nil
+}
+
+// isSearchURL reports whether u is the portal's search endpoint, which the
+// listing loads its pages from.
+func isSearchURL(u string) bool {
+	return strings.Contains(u, "/Module/Tenders/en/Tender/Search/")
+}
+
+// searchStatus returns the status filter the search request r sent, or
+// "" if it didn't send one.
+func searchStatus(r playwright.Request) string {
+	data, err := r.PostData()
+	if err != nil {
+		return ""
+	}
+	form, err := url.ParseQuery(data)
+	if err != nil {
+		return ""
+	}
+	return form.Get("status")
+}
+
+// searchPageIndex returns the page index the search request r asked for,
+// counting from 0, and whether it asked for one.
+func searchPageIndex(r playwright.Request) (int, bool) {
+	data, err := r.PostData()
+	if err != nil {
+		return 0, false
+	}
+	form, err := url.ParseQuery(data)
+	if err != nil {
+		return 0, false
+	}
+	index, err := strconv.Atoi(form.Get("pageIndex"))
+	return index, err == nil && index >= 0
+}
+
+// allFilterTimeout is how long after clicking the all status filter the
+// search for all statuses may take to be sent, and allFilterAttempts how
+// many times it's clicked before giving up.
+const (
+	allFilterTimeout  = 15 * time.Second
+	allFilterAttempts = 3
+)
+
+// clickAll clicks the all status filter and checks it took by waiting for
+// the search request it sends to ask for all statuses, clicking again if
+// it doesn't. A click that doesn't take leaves the portal's default view
+// of open tenders, which hides most of them while looking like it worked.
+func (c *Client) clickAll(ctx context.Context, page playwright.Page) error {
+	all := page.GetByLabel("all", playwright.PageGetByLabelOptions{Exact: ptr(true)})
+	for attempt := 1; ; attempt++ {
+		// The searches sent instead, for the error.
+		var mu sync.Mutex
+		var statuses []string
+		_, err := page.ExpectRequest(func(r playwright.Request) bool {
+			if !isSearchURL(r.URL()) {
+				return false
+			}
+			status := searchStatus(r)
+			mu.Lock()
+			statuses = append(statuses, status)
+			mu.Unlock()
+			return strings.EqualFold(status, "all")
+		}, func() error {
+			return all.Click(playwright.LocatorClickOptions{Timeout: pwTimeout(ctx)})
+		}, playwright.PageExpectRequestOptions{Timeout: pwTimeout(ctx, allFilterTimeout)})
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil || !errors.Is(err, playwright.ErrTimeout) {
+			return fmt.Errorf("clicking all: %w", err)
+		}
+		mu.Lock()
+		sent := slices.Clone(statuses)
+		mu.Unlock()
+		if attempt == allFilterAttempts {
+			return fmt.Errorf("status filter didn't apply after clicking all %d times, searches sent statuses %q", attempt, sent)
+		}
+		slog.Warn("status filter didn't apply, clicking all again", "source", c.Name(), "attempt", attempt, "statuses", sent)
+	}
+}
+
+func launchBrowser(e egress, bc browserConfig) (*playwright.Playwright, playwright.Browser, error) {
+	err := playwright.Install(&playwright.RunOptions{Verbose: false, Browsers: []string{bc.name()}})
+	if err != nil {
+		return nil, nil, fmt.Errorf("installing playwright: %w", err)
+	}
+
+	pw, err := playwright.Run()
+	if err != nil {
+		return nil, nil, fmt.Errorf("running playwright: %w", err)
+	}
+	opts := e.launchOptions()
+	opts.Headless = ptr(!bc.headful)
+	browser, err := bc.browserType(pw).Launch(opts)
+	if err != nil {
+		pw.Stop()
+		return nil, nil, fmt.Errorf("launching browser: %w", err)
+	}
+	return pw, browser, nil
+}
+
+// browserSession is a browser kept running across scrapes, as run does
+// between runs, so each client opens a context in it instead of starting
+// a browser of its own.
+type browserSession struct {
+	egress egress
+	config browserConfig
+
+	mu sync.Mutex
+	pw *playwright.Playwright
+	b  playwright.Browser
+}
+
+// browser returns the session's browser, starting it if it isn't running
+// or has gone away.
+func (s *browserSession) browser() (playwright.Browser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.b != nil && s.b.IsConnected() {
+		return s.b, nil
+	}
+	if s.b != nil {
+		slog.Warn("browser disconnected, starting another")
+		s.close()
+	}
+	pw, b, err := launchBrowser(s.egress, s.config)
+	if err != nil {
+		return nil, err
+	}
+	s.pw, s.b = pw, b
+	return b, nil
+}
+
+func (s *browserSession) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.close()
+}
+
+func (s *browserSession) close() error {
+	if s.b != nil {
+		s.b.Close()
+		s.b = nil
+	}
+	if s.pw != nil {
+		if err := s.pw.Stop(); err != nil {
+			return err
+		}
+		s.pw = nil
+	}
+	return nil
+}
+
+// decodeSearch decodes the search response in r, calling fn with each
+// item as it's decoded rather than collecting them in Data, which is left
+// empty. Decoding stops at the first error from fn.
+func decodeSearch(r io.Reader, fn func(RawTender) error) (RawTenders, error) {
+	dec := json.NewDecoder(r)
+	var res RawTenders
+	if err := expectDelim(dec, '{'); err != nil {
+		return res, err
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return res, err
+		}
+		// As with Unmarshal, keys match field names ignoring case.
+		switch key, _ := tok.(string); strings.ToLower(key) {
+		case "data":
+			if err := decodeItems(dec, fn); err != nil {
+				return res, err
+			}
+		case "success":
+			err = dec.Decode(&res.Success)
+		case "total":
+			err = dec.Decode(&res.Total)
+		default:
+			var skip json.RawMessage
+			err = dec.Decode(&skip)
+		}
+		if err != nil {
+			return res, err
+		}
+	}
+	return res, expectDelim(dec, '}')
+}
+
+// decodeItems decodes the array of items dec is at, calling fn with each.
+func decodeItems(dec *json.Decoder, fn func(RawTender) error) error {
+	tok, err := dec.Token()
+	if err != nil || tok == nil {
+		return err
+	}
+	if d, ok := tok.(json.Delim); !ok || d != '[' {
+		return fmt.Errorf("data is %v, not an array", tok)
+	}
+	for dec.More() {
+		var d RawTender
+		if err := dec.Decode(&d); err != nil {
+			return err
+		}
+		if err := fn(d); err != nil {
+			return err
+		}
+	}
+	return expectDelim(dec, ']')
+}
+
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if d, ok := tok.(json.Delim); !ok || d != want {
+		return fmt.Errorf("got %v, want %v", tok, want)
+	}
+	return nil
+}
+
+type RawTenders struct {
+	Success bool        `json:"success"`
+	Data    []RawTender `json:"data"`
+	Total   int         `json:"total"`
+}
+
+// availableAt returns when d says it was made available, from
+// DateAvailable in whichever of the forms the portal has used, or else
+// issued, its already parsed DateAvailableDisplay. Times without a zone
+// are in issued's location.
+func availableAt(d RawTender, issued time.Time) time.Time {
+	s := d.DateAvailable
+	if ms, ok := strings.CutPrefix(s, "/Date("); ok {
+		// /Date(1731038400000)/, optionally with an offset after the
+		// milliseconds, which are UTC regardless.
+		ms, _, _ = strings.Cut(strings.TrimSuffix(ms, ")/"), "-")
+		ms, _, _ = strings.Cut(ms, "+")
+		if n, err := strconv.ParseInt(ms, 10, 64); err == nil {
+			return time.UnixMilli(n)
+		}
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t
+	}
+	if t, err := time.ParseInLocation("2006-01-02T15:04:05.999999999", s, issued.Location()); err == nil {
+		return t
+	}
+	return issued
+}
+
+type RawTender struct {
+	ID                                         string `json:"Id"`
+	Title                                      string `json:"Title"`
+	Scope                                      string `json:"Scope"`
+	Status                                     string `json:"Status"`
+	Description                                string `json:"Description"`
+	DateAvailable                              string `json:"DateAvailable"`
+	DateAvailableDisplay                       string `json:"DateAvailableDisplay"` // Fri Nov 8, 2024 12:00:00 AM
+	DatePlannedIssue                           any    `json:"DatePlannedIssue"`
+	DatePlannedIssueDisplay                    string `json:"DatePlannedIssueDisplay"`
+	DateClosing                                string `json:"DateClosing"`
+	DateClosingDisplay                         string `json:"DateClosingDisplay"` // Mon Nov 25, 2024 2:00:59 PM
+	DaysLeft                                   int    `json:"DaysLeft"`
+	DaysLeftPublish                            int    `json:"DaysLeftPublish"`
+	Submitted                                  int    `json:"Submitted"`
+	PlanTakers                                 int    `json:"PlanTakers"`
+	Advertisements                             int    `json:"Advertisements"`
+	Documents                                  int    `json:"Documents"`
+	Addendums                                  int    `json:"Addendums"`
+	ShowSubmitted                              bool   `json:"ShowSubmitted"`
+	ShowPlanTakers                             bool   `json:"ShowPlanTakers"`
+	VendorIsRegistered                         bool   `json:"VendorIsRegistered"`
+	VendorHasBidInProgress                     bool   `json:"VendorHasBidInProgress"`
+	VendorHasMultipleActiveSubmissions         bool   `json:"VendorHasMultipleActiveSubmissions"`
+	FirstSubmissionID                          string `json:"FirstSubmissionId"`
+	ShowSubmitOnline                           bool   `json:"ShowSubmitOnline"`
+	ShowRegisterAsPlanTaker                    bool   `json:"ShowRegisterAsPlanTaker"`
+	AllowBidQuestionSubmission                 bool   `json:"AllowBidQuestionSubmission"`
+	OnlyRegisteredPlantakersCanSubmitQuestions bool   `json:"OnlyRegisteredPlantakersCanSubmitQuestions"`
+	IncludeSeconds                             bool   `json:"IncludeSeconds"`
+	TimeZoneLabel                              string `json:"TimeZoneLabel"`
+	IsEmployee                                 bool   `json:"IsEmployee"`
+}
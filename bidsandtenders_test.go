@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDecodeSearch(t *testing.T) {
+	body, err := os.ReadFile("testdata/search.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want RawTenders
+	if err := json.Unmarshal(body, &want); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open("testdata/search.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var ids []string
+	res, err := decodeSearch(f, func(d RawTender) error {
+		ids = append(ids, d.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Success || res.Total != want.Total {
+		t.Errorf("got success %v, total %d, want true, %d", res.Success, res.Total, want.Total)
+	}
+	if len(ids) != len(want.Data) {
+		t.Fatalf("decoded %d items, want %d", len(ids), len(want.Data))
+	}
+	for i, d := range want.Data {
+		if ids[i] != d.ID {
+			t.Errorf("item %d is %s, want %s", i, ids[i], d.ID)
+		}
+	}
+}
+
+func TestDecodeSearchErrors(t *testing.T) {
+	// The truncated copy of testdata/search.json ends partway through
+	// its third item.
+	truncated, err := os.ReadFile("testdata/search-truncated.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		name  string
+		body  string
+		items int
+	}{
+		{"truncated", string(truncated), 2},
+		{"not an object", `[{"Id": "a"}]`, 0},
+		{"data not an array", `{"success": true, "data": {"Id": "a"}}`, 0},
+		{"bad item", `{"data": [{"Id": "a"}, {"Id": 7}]}`, 1},
+		{"unclosed", `{"data": [{"Id": "a"}]`, 1},
+	} {
+		var n int
+		_, err := decodeSearch(strings.NewReader(tt.body), func(RawTender) error {
+			n++
+			return nil
+		})
+		if err == nil {
+			t.Errorf("%s: decoded without error", tt.name)
+		}
+		if n != tt.items {
+			t.Errorf("%s: decoded %d items before the error, want %d", tt.name, n, tt.items)
+		}
+	}
+}
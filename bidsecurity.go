@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// bidSecurity is a bid bond or deposit a tender requires, either as a fixed
+// amount in dollars or as a percentage of the bid price.
+type bidSecurity struct {
+	Amount  float64
+	Percent float64
+}
+
+var (
+	bidSecurityRe     = regexp.MustCompile(`(?i)\b(?:bid\s+(?:bond|security|deposit)|tender\s+(?:security|deposit)|security\s+deposit)`)
+	bidSecurityNoneRe = regexp.MustCompile(`(?i)\b(?:no|not|nor)\s+(?:\w+\s+){0,3}$`)
+	bidSecurityAmtRe  = regexp.MustCompile(`\$\s?(\d[\d,]*(?:\.\d{2})?)|(\d+(?:\.\d+)?)\s?%`)
+)
+
+// detectBidSecurity finds the first bid security requirement stated in
+// text, returning nil if there is none.
+func detectBidSecurity(text string) *bidSecurity {
+	for _, loc := range bidSecurityRe.FindAllStringIndex(text, -1) {
+		if bidSecurityNoneRe.MatchString(text[max(0, loc[0]-30):loc[0]]) {
+			continue
+		}
+		rest := text[loc[1]:min(len(text), loc[1]+150)]
+		if i := strings.IndexAny(rest, "\n"); i >= 0 {
+			rest = rest[:i]
+		}
+		m := bidSecurityAmtRe.FindStringSubmatch(rest)
+		if m == nil {
+			continue
+		}
+		if m[1] != "" {
+			amt, err := strconv.ParseFloat(strings.ReplaceAll(m[1], ",", ""), 64)
+			if err == nil {
+				return &bidSecurity{Amount: amt}
+			}
+			continue
+		}
+		pct, err := strconv.ParseFloat(m[2], 64)
+		if err == nil && pct > 0 && pct <= 100 {
+			return &bidSecurity{Percent: pct}
+		}
+	}
+	return nil
+}
+
+func (b bidSecurity) String() string {
+	if b.Percent > 0 {
+		return strconv.FormatFloat(b.Percent, 'f', -1, 64) + "% of bid price"
+	}
+	whole, cents, _ := strings.Cut(strconv.FormatFloat(b.Amount, 'f', 2, 64), ".")
+	for i := len(whole) - 3; i > 0; i -= 3 {
+		whole = whole[:i] + "," + whole[i:]
+	}
+	return "$" + whole + "." + cents
+}
+
+// exceeds reports whether b is more than maxAmount dollars or maxPercent
+// percent. Zero limits are ignored.
+func (b bidSecurity) exceeds(maxAmount, maxPercent float64) bool {
+	if maxAmount > 0 && b.Amount > maxAmount {
+		return true
+	}
+	if maxPercent > 0 && b.Percent > maxPercent {
+		return true
+	}
+	return false
+}
+
+// withoutProhibitiveBidSecurity returns ts without the tenders whose bid
+// security exceeds the limits.
+func withoutProhibitiveBidSecurity(ts []Tender, maxAmount, maxPercent float64) []Tender {
+	var res []Tender
+	for _, t := range ts {
+		if why := bidSecurityExclusion(t, maxAmount, maxPercent); why != "" {
+			slog.Info("leaving out tender", "tender", t.ID, "reason", why)
+			continue
+		}
+		res = append(res, t)
+	}
+	return res
+}
+
+// bidSecurityExclusion returns why t's bid security leaves it out, or ""
+// if it doesn't.
+func bidSecurityExclusion(t Tender, maxAmount, maxPercent float64) string {
+	if t.BidSecurity != nil && t.BidSecurity.exceeds(maxAmount, maxPercent) {
+		return fmt.Sprintf("bid security %v is over the limit", t.BidSecurity)
+	}
+	return ""
+}
+
+func (s store) setBidSecurity(tenderID string, b *bidSecurity) error {
+	if b == nil {
+		return nil
+	}
+	_, err := s.db.Exec("insert into bid_security (tender_id, amount, percent) values (?, ?, ?) on conflict (tender_id) do update set amount = excluded.amount, percent = excluded.percent",
+		tenderID, b.Amount, b.Percent,
+	)
+	if err != nil {
+		return fmt.Errorf("insert bid security: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+
+	"github.com/playwright-community/playwright-go"
+)
+
+// browserConfig is how the browser scraping portals is launched, set with
+// -browser, -headless and -user-agent. The zero value is headless
+// Chromium with its own user agent.
+type browserConfig struct {
+	// engine is chromium, firefox or webkit, or "" for chromium.
+	engine string
+	// headful shows the browser's window, for debugging.
+	headful bool
+	// userAgent, if set, replaces the browser's user agent.
+	userAgent string
+}
+
+func (b *browserConfig) setEngine(s string) error {
+	switch s {
+	case "chromium", "firefox", "webkit":
+		b.engine = s
+		return nil
+	}
+	return fmt.Errorf("unknown browser %q, want chromium, firefox or webkit", s)
+}
+
+func (b browserConfig) name() string {
+	return cmp.Or(b.engine, "chromium")
+}
+
+// browserType returns b's engine in pw.
+func (b browserConfig) browserType(pw *playwright.Playwright) playwright.BrowserType {
+	switch b.engine {
+	case "firefox":
+		return pw.Firefox
+	case "webkit":
+		return pw.WebKit
+	}
+	return pw.Chromium
+}
+
+// contextOptions are the options for b's browser contexts.
+func (b browserConfig) contextOptions() playwright.BrowserNewContextOptions {
+	var opts playwright.BrowserNewContextOptions
+	if b.userAgent != "" {
+		opts.UserAgent = ptr(b.userAgent)
+	}
+	return opts
+}
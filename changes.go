@@ -0,0 +1,162 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// tenderChange is a change to a stored tender seen on a later scrape.
+type tenderChange struct {
+	ID          int64
+	TenderID    string
+	Description string
+	Field       string
+	Old, New    string
+	At          time.Time
+}
+
+func (c tenderChange) String() string {
+	switch c.Field {
+	case "close":
+		return fmt.Sprintf("Close date moved from %s to %s", c.Old, c.New)
+	case "status":
+		return fmt.Sprintf("Status changed from %s to %s", c.Old, c.New)
+	case "addenda":
+		return fmt.Sprintf("Addenda went from %s to %s", c.Old, c.New)
+	}
+	return fmt.Sprintf("%s changed from %q to %q", c.Field, c.Old, c.New)
+}
+
+// splitStatusChanges splits cs into status changes, which every channel
+// shows apart since they're frequent and mostly routine, and the rest.
+func splitStatusChanges(cs []tenderChange) (status, other []tenderChange) {
+	for _, c := range cs {
+		if c.Field == "status" {
+			status = append(status, c)
+		} else {
+			other = append(other, c)
+		}
+	}
+	return status, other
+}
+
+// update brings the stored tender up to date with t, as scraped again,
+// recording its close date, status and addenda count changes. The first
+// time a tender's status and addenda are seen isn't a change.
+func (s store) update(t Tender) ([]tenderChange, error) {
+	// Tenders first found in alert emails have placeholder dates until
+	// they're scraped, so those are filled in rather than compared.
+	if _, err := s.reconcileAlertTender(t); err != nil {
+		return nil, err
+	}
+
+	var desc string
+	var closes time.Time
+	err := s.db.QueryRow("select description, close from tenders where id = ?", t.ID).Scan(&desc, &closes)
+	if err != nil {
+		return nil, err
+	}
+
+	var status sql.NullString
+	var addenda sql.NullInt64
+	err = s.db.QueryRow("select status, addenda from tender_state where tender_id = ?", t.ID).Scan(&status, &addenda)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	now := time.Now()
+	var changes []tenderChange
+	change := func(field, old, new string) {
+		changes = append(changes, tenderChange{TenderID: t.ID, Description: t.Description, Field: field, Old: old, New: new, At: now})
+	}
+	// Close dates stored without a time can only be compared as dates.
+	// If that's all that's the same, the time is filled in quietly.
+	var setClose bool
+	switch {
+	case t.closeUnknown:
+	case dateOnly(closes) && t.CloseDate.Format(dateFormat) == closes.Format(dateFormat):
+		setClose = true
+	case dateOnly(closes) || !t.CloseDate.Equal(closes):
+		change("close", formatStoredTime(closes), formatStoredTime(t.CloseDate))
+		setClose = true
+	}
+	if setClose {
+		if _, err := s.db.Exec("update tenders set close = ? where id = ?", t.CloseDate, t.ID); err != nil {
+			return nil, fmt.Errorf("update close: %v", err)
+		}
+	}
+	if status.Valid && t.status != status.String {
+		change("status", status.String, t.status)
+	}
+	if addenda.Valid && int64(t.addenda) != addenda.Int64 {
+		change("addenda", strconv.FormatInt(addenda.Int64, 10), strconv.Itoa(t.addenda))
+	}
+
+	if t.Description != desc {
+		if _, err := s.db.Exec("update tenders set description = ? where id = ?", t.Description, t.ID); err != nil {
+			return nil, fmt.Errorf("update description: %v", err)
+		}
+	}
+	for i, c := range changes {
+		res, err := s.db.Exec("insert into tender_changes (tender_id, field, old, new, at) values (?, ?, ?, ?, ?)", c.TenderID, c.Field, c.Old, c.New, c.At)
+		if err != nil {
+			return nil, fmt.Errorf("insert change: %v", err)
+		}
+		if changes[i].ID, err = res.LastInsertId(); err != nil {
+			return nil, err
+		}
+		s.events.emit("tender_changed", c.TenderID, changes[i])
+	}
+	return changes, nil
+}
+
+// setState records the status and addenda count t was listed with, for
+// update to compare against next time.
+func (s store) setState(t Tender) error {
+	_, err := s.db.Exec("insert into tender_state (tender_id, status, addenda) values (?, ?, ?) on conflict (tender_id) do update set status = excluded.status, addenda = excluded.addenda",
+		t.ID, t.status, t.addenda)
+	if err != nil {
+		return fmt.Errorf("insert tender state: %v", err)
+	}
+	return nil
+}
+
+// pendingChanges returns changes that haven't been notified yet, to
+// tenders that have been delivered over some channel, oldest first.
+// Changes to tenders still waiting to be announced as new would only
+// repeat what the announcement says, and those to tenders the filters
+// kept out are about tenders nobody was told of.
+func (s store) pendingChanges() ([]tenderChange, error) {
+	rows, err := s.db.Query(`select c.id, c.tender_id, t.description, c.field, c.old, c.new, c.at
+		from tender_changes c
+		join tenders t on t.id = c.tender_id
+		where c.notified is null and c.tender_id not in (select tender_id from tender_retractions)
+			and c.tender_id in (select dt.tender_id from delivery_tenders dt join deliveries d on d.id = dt.delivery_id where d.error is null)
+		order by c.tender_id, c.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []tenderChange
+	for rows.Next() {
+		var c tenderChange
+		if err := rows.Scan(&c.ID, &c.TenderID, &c.Description, &c.Field, &c.Old, &c.New, &c.At); err != nil {
+			return nil, err
+		}
+		res = append(res, c)
+	}
+	return res, rows.Err()
+}
+
+func (s store) markChangesNotified(cs []tenderChange) error {
+	now := time.Now()
+	for _, c := range cs {
+		if _, err := s.db.Exec("update tender_changes set notified = ? where id = ?", now, c.ID); err != nil {
+			return fmt.Errorf("marking change %d notified: %v", c.ID, err)
+		}
+	}
+	return nil
+}
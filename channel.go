@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// channel is a way of getting a digest to people, such as email.
+type channel interface {
+	name() string
+	notify(ctx context.Context, ts []Tender, u updates) error
+}
+
+func (n *notifier) name() string { return "email" }
+
+// channelBacklog is what a channel failed to get while other channels got
+// it, to send on a later run.
+type channelBacklog struct {
+	tenders []Tender
+	updates updates
+}
+
+func (b channelBacklog) empty() bool { return len(b.tenders) == 0 && b.updates.empty() }
+
+// notifyChannels sends the digest of ts and u over each of chs, giving
+// each up to timeout. Each channel also gets its backlog, what it failed
+// to get before. A failing channel is logged and doesn't stop the others.
+// If record is set, each attempt is recorded in the store. It returns the
+// errors of the channels that failed, by name.
+func notifyChannels(ctx context.Context, st store, record bool, chs []channel, timeout time.Duration, ts []Tender, u updates, backlog map[string]channelBacklog) map[string]error {
+	failed := make(map[string]error)
+	for _, ch := range chs {
+		b := backlog[ch.name()]
+		cts := append(slices.Clip(b.tenders), ts...)
+		cu := b.updates.merge(u)
+		err := runSend(ctx, timeout, func(ctx context.Context) error { return ch.notify(ctx, cts, cu) })
+		if record {
+			if rerr := st.recordDelivery(ch.name(), time.Now(), cts, err); rerr != nil {
+				slog.Error("recording delivery", "err", rerr)
+			}
+		}
+		if err != nil {
+			slog.Error("notifying", "channel", ch.name(), "err", err)
+			failed[ch.name()] = err
+		}
+	}
+	return failed
+}
+
+// undelivered returns what channel failed to get while other channels got
+// it, oldest tenders first, leaving out retracted ones.
+func (s store) undelivered(channel string) (channelBacklog, error) {
+	var b channelBacklog
+	var err error
+	b.tenders, err = s.selectTenders("select "+tenderColumns+" from tenders where id in (select tender_id from undelivered_tenders where channel = ?) and id not in (select tender_id from tender_retractions) order by first_observed, id", channel)
+	if err != nil {
+		return b, err
+	}
+	var js []byte
+	err = s.db.QueryRow("select updates from undelivered_updates where channel = ?", channel).Scan(&js)
+	if errors.Is(err, sql.ErrNoRows) {
+		return b, nil
+	}
+	if err != nil {
+		return b, err
+	}
+	if b.updates, err = decodeUpdates(js); err != nil {
+		return b, fmt.Errorf("undelivered updates for %s: %w", channel, err)
+	}
+	return b, nil
+}
+
+// setUndelivered records that channel failed to get add, and got
+// delivered, the backlog it had.
+func (s store) setUndelivered(channel string, add, delivered channelBacklog) error {
+	for _, t := range delivered.tenders {
+		if _, err := s.db.Exec("delete from undelivered_tenders where channel = ? and tender_id = ?", channel, t.ID); err != nil {
+			return fmt.Errorf("delete undelivered tender: %v", err)
+		}
+	}
+	for _, t := range add.tenders {
+		if _, err := s.db.Exec("insert into undelivered_tenders (channel, tender_id) values (?, ?) on conflict do nothing", channel, t.ID); err != nil {
+			return fmt.Errorf("insert undelivered tender: %v", err)
+		}
+	}
+	if !delivered.updates.empty() {
+		if _, err := s.db.Exec("delete from undelivered_updates where channel = ?", channel); err != nil {
+			return fmt.Errorf("delete undelivered updates: %v", err)
+		}
+	}
+	if add.updates.empty() {
+		return nil
+	}
+	cur, err := s.undelivered(channel)
+	if err != nil {
+		return err
+	}
+	js, err := encodeUpdates(cur.updates.merge(add.updates))
+	if err != nil {
+		return err
+	}
+	if _, err := s.db.Exec("insert into undelivered_updates (channel, updates) values (?, ?) on conflict (channel) do update set updates = excluded.updates", channel, js); err != nil {
+		return fmt.Errorf("insert undelivered updates: %v", err)
+	}
+	return nil
+}
+
+// recordDelivery records an attempt to send ts over channel, and which
+// tenders it included.
+func (s store) recordDelivery(channel string, at time.Time, ts []Tender, err error) error {
+	var errText *string
+	if err != nil {
+		errText = ptr(err.Error())
+	}
+	res, xerr := s.db.Exec("insert into deliveries (channel, at, tenders, error) values (?, ?, ?, ?)", channel, at, len(ts), errText)
+	if xerr != nil {
+		return fmt.Errorf("insert delivery: %v", xerr)
+	}
+	id, xerr := res.LastInsertId()
+	if xerr != nil {
+		return xerr
+	}
+	ids := make([]string, 0, len(ts))
+	for _, t := range ts {
+		if _, err := s.db.Exec("insert into delivery_tenders (delivery_id, tender_id) values (?, ?) on conflict do nothing", id, t.ID); err != nil {
+			return fmt.Errorf("insert delivery tender: %v", err)
+		}
+		ids = append(ids, t.ID)
+	}
+	s.events.emit("notified", "", struct {
+		Channel string   `json:"channel"`
+		Tenders []string `json:"tenders"`
+		Error   *string  `json:"error,omitempty"`
+	}{channel, ids, errText})
+	return nil
+}
+
+// tenderDelivery is an attempt to send a tender over a channel.
+type tenderDelivery struct {
+	Channel string
+	At      time.Time
+	Error   string
+}
+
+// tenderDeliveries returns the attempts to send the tender with id, oldest
+// first.
+func (s store) tenderDeliveries(tenderID string) ([]tenderDelivery, error) {
+	rows, err := s.db.Query("select d.channel, d.at, coalesce(d.error, '') from deliveries d join delivery_tenders dt on dt.delivery_id = d.id where dt.tender_id = ? order by d.at", tenderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []tenderDelivery
+	for rows.Next() {
+		var d tenderDelivery
+		if err := rows.Scan(&d.Channel, &d.At, &d.Error); err != nil {
+			return nil, err
+		}
+		res = append(res, d)
+	}
+	return res, rows.Err()
+}
+
+// webhook is a channel that posts the digest as JSON to a URL.
+type webhook struct {
+	url string
+	// out, if set, gets the JSON instead, for notify -dry-run.
+	out io.Writer
+}
+
+func (w webhook) name() string { return "webhook" }
+
+type webhookPayload struct {
+	Tenders     []Tender           `json:"tenders"`
+	Alerts      []documentAlert    `json:"alerts,omitempty"`
+	Reminders   []questionReminder `json:"reminders,omitempty"`
+	Retractions []retraction       `json:"retractions,omitempty"`
+	// Changes leave out status changes, which are in StatusChanges.
+	Changes       []tenderChange `json:"changes,omitempty"`
+	StatusChanges []tenderChange `json:"status_changes,omitempty"`
+}
+
+func (w webhook) notify(ctx context.Context, ts []Tender, u updates) error {
+	if len(ts) == 0 && u.empty() {
+		return nil
+	}
+	p := webhookPayload{Tenders: ts, Alerts: u.alerts, Reminders: u.reminders, Retractions: u.retractions}
+	p.StatusChanges, p.Changes = splitStatusChanges(u.changes)
+	b, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	if w.out != nil {
+		_, err := fmt.Fprintf(w.out, "POST %s\n%s\n\n", w.url, b)
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", w.url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("webhook returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// envNameRe matches the keys of a config file that are environment
+// variables, such as FROM_EMAIL, rather than flags.
+var envNameRe = regexp.MustCompile(`^[A-Z][A-Z0-9_]*$`)
+
+// loadConfig applies the YAML config file at path to fs, which must have
+// been parsed. Keys are flag names without the dash, with - or _ between
+// words, or environment variable names such as FROM_EMAIL. Lists are
+// given to repeatable flags one element at a time and joined with commas
+// otherwise, and maps are given as key=value, so
+//
+//	sources:
+//	  - https://halifax.bidsandtenders.ca/Module/Tenders/en
+//	closing-soon:
+//	  email: 168h
+//	unspsc: [72, 8111]
+//	FROM_EMAIL: tenders@example.com
+//
+// is like -sources ... -closing-soon email=168h -unspsc 72,8111 with
+// FROM_EMAIL set. Flags on the command line and variables in the
+// environment override what the file says, and so do TENDER_DIGEST_*
+// variables for flags, as applied by applyFlagEnv.
+func loadConfig(fs *flag.FlagSet, path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var cfg map[string]any
+	if err := yaml.Unmarshal(b, &cfg); err != nil {
+		return fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	var keys []string
+	for k := range cfg {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		v := cfg[k]
+		if envNameRe.MatchString(k) {
+			if _, ok := os.LookupEnv(k); !ok {
+				os.Setenv(k, configString(v))
+			}
+			continue
+		}
+		name := strings.ReplaceAll(k, "_", "-")
+		f := fs.Lookup(name)
+		if f == nil || name == "config" {
+			return fmt.Errorf("%s: unknown setting %q", path, k)
+		}
+		if _, ok := os.LookupEnv(flagEnvName(name)); ok || set[name] {
+			continue
+		}
+		if err := setConfigFlag(fs, f, v); err != nil {
+			return fmt.Errorf("%s: %s: %w", path, k, err)
+		}
+	}
+	return nil
+}
+
+// applyFlagEnv sets each flag not set on the command line from its
+// TENDER_DIGEST_* environment variable, if there is one. -unspsc-map is
+// TENDER_DIGEST_UNSPSC_MAP, for example.
+func applyFlagEnv(fs *flag.FlagSet) error {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		v, ok := os.LookupEnv(flagEnvName(f.Name))
+		if !ok || set[f.Name] || err != nil {
+			return
+		}
+		if serr := fs.Set(f.Name, v); serr != nil {
+			err = fmt.Errorf("%s: %w", flagEnvName(f.Name), serr)
+		}
+	})
+	return err
+}
+
+func flagEnvName(name string) string {
+	return "TENDER_DIGEST_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// configValue is a flag.Value that takes more from a config file than
+// its flag syntax allows, such as lists of maps.
+type configValue interface {
+	setConfig(v any) error
+}
+
+func setConfigFlag(fs *flag.FlagSet, f *flag.Flag, v any) error {
+	if cv, ok := f.Value.(configValue); ok {
+		return cv.setConfig(v)
+	}
+	switch v := v.(type) {
+	case []any:
+		// Plain string flags take comma-separated lists, where setting
+		// them again would replace what was set.
+		if g, ok := f.Value.(flag.Getter); ok {
+			if _, ok := g.Get().(string); ok {
+				return fs.Set(f.Name, configString(v))
+			}
+		}
+		for _, e := range v {
+			if err := fs.Set(f.Name, configString(e)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case map[string]any:
+		var keys []string
+		for k := range v {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+		for _, k := range keys {
+			if err := fs.Set(f.Name, k+"="+configString(v[k])); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fs.Set(f.Name, configString(v))
+}
+
+// configString returns v as a flag would take it, with lists joined by
+// commas.
+func configString(v any) string {
+	if l, ok := v.([]any); ok {
+		var s []string
+		for _, e := range l {
+			s = append(s, configString(e))
+		}
+		return strings.Join(s, ",")
+	}
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// contact is a buyer or other person to direct questions about a tender
+// to.
+type contact struct {
+	Name  string
+	Email string
+}
+
+var (
+	contactEmailRe = regexp.MustCompile(`(?i)\b[a-z0-9._%+-]+@[a-z0-9.-]+\.[a-z]{2,}\b`)
+	// contactNameRe matches capitalized names such as "Jane Smith" or
+	// "Jean-Paul M. O'Brien".
+	contactNameRe = regexp.MustCompile(`\b[A-Z][a-z]+(?:-[A-Z][a-z]+)?(?:\s+[A-Z]\.)?\s+(?:O'|Mc|Mac)?[A-Z][a-z]+(?:-[A-Z][a-z]+)?\b`)
+	// contactNotNames are capitalized words near addresses that aren't
+	// names, such as titles. They're blanked out before looking for names.
+	contactNotNames = regexp.MustCompile(`(?i)\b(?:email|e-mail|contact|questions|inquiries|enquiries|procurement|purchasing|consultant|officer|manager|coordinator|buyer|halifax|municipality|regional|office|submit|please|all|the)\b`)
+	// sentenceEndRe matches the end of a sentence, but not an initial.
+	sentenceEndRe = regexp.MustCompile(`[a-z0-9]{2}[.!?]\s|\n`)
+)
+
+func (c contact) String() string {
+	if c.Name == "" {
+		return c.Email
+	}
+	return c.Name + " <" + c.Email + ">"
+}
+
+// detectContacts finds email addresses in text, along with the name just
+// before each one in the same sentence if there is one.
+func detectContacts(text string) []contact {
+	var res []contact
+	seen := map[string]bool{}
+	prev := 0
+	for _, loc := range contactEmailRe.FindAllStringIndex(text, -1) {
+		// Only look for a name since the previous address.
+		from := max(prev, loc[0]-80)
+		prev = loc[1]
+
+		email := strings.ToLower(strings.TrimRight(text[loc[0]:loc[1]], "."))
+		if seen[email] {
+			continue
+		}
+		seen[email] = true
+
+		c := contact{Email: email}
+		before := text[from:loc[0]]
+		if ends := sentenceEndRe.FindAllStringIndex(before, -1); len(ends) > 0 {
+			before = before[ends[len(ends)-1][1]:]
+		}
+		before = contactNotNames.ReplaceAllString(before, " ; ")
+		if names := contactNameRe.FindAllString(before, -1); len(names) > 0 {
+			c.Name = names[len(names)-1]
+		}
+		res = append(res, c)
+	}
+	return res
+}
+
+// addContacts records cs as contacts for the tender with id, keeping the
+// latest name seen for each address.
+func (s store) addContacts(tenderID string, cs []contact) error {
+	now := time.Now()
+	for _, c := range cs {
+		_, err := s.db.Exec(`insert into contacts (email, name, first_seen, last_seen) values (?, ?, ?, ?)
+			on conflict (email) do update set name = coalesce(nullif(excluded.name, ''), contacts.name), last_seen = excluded.last_seen`,
+			c.Email, c.Name, now, now)
+		if err != nil {
+			return fmt.Errorf("insert contact: %v", err)
+		}
+		if _, err := s.db.Exec("insert into tender_contacts (tender_id, email) values (?, ?) on conflict do nothing", tenderID, c.Email); err != nil {
+			return fmt.Errorf("insert tender contact: %v", err)
+		}
+	}
+	return nil
+}
+
+func printContacts(w io.Writer, st store) error {
+	rows, err := st.db.Query(`select c.email, c.name, c.last_seen, count(tc.tender_id)
+		from contacts c left join tender_contacts tc on tc.email = c.email
+		group by c.email order by c.name, c.email`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tEMAIL\tTENDERS\tLAST SEEN")
+	for rows.Next() {
+		var email, name string
+		var last time.Time
+		var n int
+		if err := rows.Scan(&email, &name, &last, &n); err != nil {
+			return err
+		}
+		if name == "" {
+			name = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\n", name, email, n, last.Format(dateFormat))
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return tw.Flush()
+}
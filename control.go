@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// fetchHandler scrapes every source right away, regardless of schedule,
+// and responds with the run summary.
+func fetchHandler(st store, sc *scraper) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !sc.mu.TryLock() {
+			http.Error(w, "a fetch is already running", http.StatusConflict)
+			return
+		}
+		defer sc.mu.Unlock()
+
+		// Finish the run even if the caller goes away.
+		sum := sc.scrape(context.WithoutCancel(r.Context()), st, true)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(sum)
+	}
+}
+
+// listenControl serves handler on the unix socket at path, replacing a
+// stale socket left by an earlier process. Only the owner can connect.
+func listenControl(path string, handler http.Handler) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		l.Close()
+		return err
+	}
+	return http.Serve(l, handler)
+}
+
+// controlClient returns an HTTP client that talks to serve over the unix
+// socket at path, whatever host requests are addressed to.
+func controlClient(path string) *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		},
+	}}
+}
+
+// controlStatus is what the status control request reports.
+type controlStatus struct {
+	Started             time.Time      `json:"started"`
+	Fetching            bool           `json:"fetching"`
+	NotificationsPaused time.Time      `json:"notifications_paused,omitzero"`
+	Pending             int            `json:"pending"`
+	Sources             []sourceHealth `json:"sources"`
+}
+
+// controlRoutes registers the control socket's endpoints on mux.
+func controlRoutes(mux *http.ServeMux, st store, sc *scraper, dg *digester) {
+	started := time.Now()
+	mux.HandleFunc("POST /api/fetch", fetchHandler(st, sc))
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+		s := controlStatus{Started: started}
+		if sc.mu.TryLock() {
+			sc.mu.Unlock()
+		} else {
+			s.Fetching = true
+		}
+		var err error
+		if s.NotificationsPaused, err = st.notificationsPaused(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		pending, err := st.pendingTenders()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		s.Pending = len(pending)
+		if s.Sources, err = st.sourceHealth(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s)
+	})
+	mux.HandleFunc("POST /reload", func(w http.ResponseWriter, r *http.Request) {
+		if err := sc.reload(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("POST /notifications/pause", func(w http.ResponseWriter, r *http.Request) {
+		if err := st.pauseNotifications("control"); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("POST /notifications/resume", func(w http.ResponseWriter, r *http.Request) {
+		if err := st.resumeNotifications("control"); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("POST /drain", func(w http.ResponseWriter, r *http.Request) {
+		if err := dg.run(context.WithoutCancel(r.Context()), st, nil); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// control sends op to serve over its control socket at path and writes
+// the result to w.
+func control(w io.Writer, path, op string) error {
+	var method, endpoint string
+	switch op {
+	case "status":
+		method, endpoint = "GET", "/status"
+	case "fetch-now":
+		method, endpoint = "POST", "/api/fetch"
+	case "reload":
+		method, endpoint = "POST", "/reload"
+	case "pause", "resume":
+		method, endpoint = "POST", "/notifications/"+op
+	case "drain":
+		method, endpoint = "POST", "/drain"
+	default:
+		return fmt.Errorf("usage: tender-digest ctl status | fetch-now | reload | pause | resume | drain")
+	}
+
+	req, err := http.NewRequest(method, "http://serve"+endpoint, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := controlClient(path).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		b, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%s: %s: %s", op, resp.Status, strings.TrimSpace(string(b)))
+	}
+
+	switch op {
+	case "status":
+		var s controlStatus
+		if err := json.NewDecoder(resp.Body).Decode(&s); err != nil {
+			return err
+		}
+		return printControlStatus(w, s)
+	case "fetch-now":
+		var sum runSummary
+		if err := json.NewDecoder(resp.Body).Decode(&sum); err != nil {
+			return err
+		}
+		return printRunSummary(w, sum)
+	}
+	return nil
+}
+
+func printControlStatus(w io.Writer, s controlStatus) error {
+	fmt.Fprintf(w, "Up since:      %s\n", s.Started.Format(time.RFC3339))
+	fmt.Fprintf(w, "Fetching:      %v\n", s.Fetching)
+	if s.NotificationsPaused.IsZero() {
+		fmt.Fprintf(w, "Notifications: on\n")
+	} else {
+		fmt.Fprintf(w, "Notifications: paused since %s\n", s.NotificationsPaused.Format(time.RFC3339))
+	}
+	fmt.Fprintf(w, "Pending:       %d tenders\n\n", s.Pending)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SOURCE\tRUNS\tFAILURES\tLAST SUCCESS")
+	for _, h := range s.Sources {
+		last := "never"
+		if !h.LastSuccess.IsZero() {
+			last = h.LastSuccess.Format(time.RFC3339)
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\n", h.Source, h.Runs, h.Failures, last)
+	}
+	return tw.Flush()
+}
+
+func printRunSummary(w io.Writer, sum runSummary) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SOURCE\tNEW\tDURATION\tERROR")
+	for _, r := range sum.Sources {
+		if r.Skipped {
+			fmt.Fprintf(tw, "%s\t-\t-\tskipped\n", r.Source)
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%v\t%s\n", r.Source, r.New, r.Duration.Round(time.Second), r.Error)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// crm is a CRM that bid-worthy tenders become deals or opportunities in.
+type crm interface {
+	name() string
+	// idField is the property or field holding the tender's ID, which
+	// has to be set up in the CRM as a unique or external ID.
+	idField() string
+	// defaultFields are the fields set on records, as crmFields.
+	defaultFields() crmFields
+	// exists reports whether a record with id in idField exists.
+	exists(ctx context.Context, id string) (bool, error)
+	// create creates a record with fields.
+	create(ctx context.Context, fields map[string]string) error
+}
+
+// crmChannel is a channel that creates a record in a CRM for each new
+// tender that passes filter, unless the CRM already has one for it.
+type crmChannel struct {
+	crm    crm
+	filter keywordFilter
+	// fields override crm's default fields.
+	fields crmFields
+	// out, if set, gets the records instead, for notify -dry-run.
+	out io.Writer
+}
+
+func (c crmChannel) name() string { return c.crm.name() }
+
+func (c crmChannel) notify(ctx context.Context, ts []Tender, _ updates) error {
+	fields := c.crm.defaultFields()
+	maps.Copy(fields, c.fields)
+
+	var created int
+	var errs []error
+	for _, g := range groupListings(ts) {
+		t := g[0]
+		if why := c.filter.exclusion(t); why != "" {
+			slog.Debug("not pushing tender to CRM", "tender", t.ID, "crm", c.crm.name(), "reason", why)
+			continue
+		}
+		rec := fields.record(t)
+		rec[c.crm.idField()] = t.ID
+		if c.out != nil {
+			b, err := json.Marshal(rec)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(c.out, "%s record for %s:\n%s\n\n", c.crm.name(), t.ID, b)
+			continue
+		}
+		ok, err := c.crm.exists(ctx, t.ID)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", t.ID, err))
+			continue
+		}
+		if ok {
+			slog.Info("tender already in CRM", "tender", t.ID, "crm", c.crm.name())
+			continue
+		}
+		if err := c.crm.create(ctx, rec); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", t.ID, err))
+			continue
+		}
+		created++
+	}
+	if created > 0 {
+		slog.Info("pushed tenders to CRM", "crm", c.crm.name(), "created", created)
+	}
+	return errors.Join(errs...)
+}
+
+// crmFields are templates for the fields of CRM records, by field name,
+// with {id}, {description}, {agency}, {url}, {issued} and {close} where
+// the tender's go. Dates are like 2006-01-02.
+type crmFields map[string]string
+
+// Set takes field=template. An empty template leaves the field out.
+func (f crmFields) Set(v string) error {
+	k, tmpl, ok := strings.Cut(v, "=")
+	if !ok || k == "" {
+		return fmt.Errorf("want field=template, got %q", v)
+	}
+	f[k] = tmpl
+	return nil
+}
+
+func (f crmFields) String() string {
+	var parts []string
+	for _, k := range slices.Sorted(maps.Keys(f)) {
+		parts = append(parts, k+"="+f[k])
+	}
+	return strings.Join(parts, ",")
+}
+
+// crmFieldOverrides are, per CRM name, the fields overriding its
+// defaults, since each CRM has fields of its own.
+type crmFieldOverrides map[string]crmFields
+
+// crmNames are the CRMs fields can be overridden for.
+var crmNames = []string{"hubspot", "salesforce"}
+
+// Set takes crm.field=template, as -crm-field does.
+func (o crmFieldOverrides) Set(v string) error {
+	name, field, ok := strings.Cut(v, ".")
+	if !ok || !slices.Contains(crmNames, name) {
+		return fmt.Errorf("want crm.field=template with crm one of %s, got %q", strings.Join(crmNames, ", "), v)
+	}
+	if o[name] == nil {
+		o[name] = make(crmFields)
+	}
+	return o[name].Set(field)
+}
+
+func (o crmFieldOverrides) String() string {
+	var parts []string
+	for _, name := range slices.Sorted(maps.Keys(o)) {
+		for _, k := range slices.Sorted(maps.Keys(o[name])) {
+			parts = append(parts, name+"."+k+"="+o[name][k])
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// record returns the fields for t.
+func (f crmFields) record(t Tender) map[string]string {
+	r := strings.NewReplacer(
+		"{id}", t.ID,
+		"{description}", t.Description,
+		"{agency}", t.Agency,
+		"{url}", t.URL,
+		"{issued}", t.IssuedDate.Format(dateFormat),
+		"{close}", t.CloseDate.Format(dateFormat),
+	)
+	res := make(map[string]string)
+	for k, tmpl := range f {
+		if tmpl != "" {
+			res[k] = r.Replace(tmpl)
+		}
+	}
+	return res
+}
+
+// crmHTTPTimeout is how long a CRM API call may take.
+const crmHTTPTimeout = 30 * time.Second
+
+var crmHTTPClient = &http.Client{Timeout: crmHTTPTimeout}
+
+// crmDo sends req, decoding a JSON response into v if it's set. A 404 is
+// reported as errCRMNotFound.
+func crmDo(req *http.Request, v any) error {
+	resp, err := crmHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		io.Copy(io.Discard, resp.Body)
+		return errCRMNotFound
+	}
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s %s returned %s: %s", req.Method, req.URL.Path, resp.Status, strings.TrimSpace(string(body)))
+	}
+	if v == nil {
+		_, err := io.Copy(io.Discard, resp.Body)
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+var errCRMNotFound = errors.New("not found")
+
+// hubspot creates deals in HubSpot, with a private app's access token.
+type hubspot struct {
+	token string
+	// idProperty is the deal property holding the tender's ID, which has
+	// to be set up to require unique values.
+	idProperty string
+	apiBase    string
+}
+
+func (h hubspot) name() string { return "hubspot" }
+
+func (h hubspot) idField() string { return h.idProperty }
+
+func (h hubspot) defaultFields() crmFields {
+	return crmFields{
+		"dealname":    "{description}",
+		"closedate":   "{close}",
+		"description": "{agency}: {url}",
+		"pipeline":    "default",
+		"dealstage":   "appointmentscheduled",
+	}
+}
+
+func (h hubspot) request(ctx context.Context, method, path string, body any) (*http.Request, error) {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, h.apiBase+path, r)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+h.token)
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
+func (h hubspot) exists(ctx context.Context, id string) (bool, error) {
+	req, err := h.request(ctx, "GET", "/crm/v3/objects/deals/"+url.PathEscape(id)+"?idProperty="+url.QueryEscape(h.idProperty), nil)
+	if err != nil {
+		return false, err
+	}
+	err = crmDo(req, nil)
+	if err == errCRMNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (h hubspot) create(ctx context.Context, fields map[string]string) error {
+	req, err := h.request(ctx, "POST", "/crm/v3/objects/deals", map[string]any{"properties": fields})
+	if err != nil {
+		return err
+	}
+	return crmDo(req, nil)
+}
+
+// salesforce creates opportunities in Salesforce, with a connected app's
+// client credentials.
+type salesforce struct {
+	// url is the org's My Domain URL, such as
+	// https://example.my.salesforce.com.
+	url                    string
+	clientID, clientSecret string
+	// externalID is the opportunity field holding the tender's ID, which
+	// has to be set up as an external ID.
+	externalID string
+
+	auth *salesforceAuth
+}
+
+// salesforceAuth is an access token and the instance to use it with.
+type salesforceAuth struct {
+	token, instanceURL string
+	at                 time.Time
+}
+
+// salesforceAPIVersion is the version of the REST API used.
+const salesforceAPIVersion = "v61.0"
+
+// salesforceTokenTTL is how long an access token is used for before
+// getting another. Salesforce doesn't say when they expire, but sessions
+// last at least this long.
+const salesforceTokenTTL = time.Hour
+
+func (s salesforce) name() string { return "salesforce" }
+
+func (s salesforce) idField() string { return s.externalID }
+
+func (s salesforce) defaultFields() crmFields {
+	return crmFields{
+		"Name":        "{description}",
+		"CloseDate":   "{close}",
+		"Description": "{agency}: {url}",
+		"StageName":   "Prospecting",
+	}
+}
+
+// authorize gets an access token, unless it has a recent one.
+func (s salesforce) authorize(ctx context.Context) error {
+	if s.auth.token != "" && time.Since(s.auth.at) < salesforceTokenTTL {
+		return nil
+	}
+	form := url.Values{"grant_type": {"client_credentials"}, "client_id": {s.clientID}, "client_secret": {s.clientSecret}}
+	req, err := http.NewRequestWithContext(ctx, "POST", strings.TrimSuffix(s.url, "/")+"/services/oauth2/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	var tok struct {
+		AccessToken string `json:"access_token"`
+		InstanceURL string `json:"instance_url"`
+	}
+	if err := crmDo(req, &tok); err != nil {
+		return fmt.Errorf("getting salesforce token: %w", err)
+	}
+	*s.auth = salesforceAuth{token: tok.AccessToken, instanceURL: tok.InstanceURL, at: time.Now()}
+	return nil
+}
+
+func (s salesforce) request(ctx context.Context, method, path string, body any) (*http.Request, error) {
+	if err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, s.auth.instanceURL+"/services/data/"+salesforceAPIVersion+path, r)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.auth.token)
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
+func (s salesforce) exists(ctx context.Context, id string) (bool, error) {
+	req, err := s.request(ctx, "GET", "/sobjects/Opportunity/"+url.PathEscape(s.externalID)+"/"+url.PathEscape(id)+"?fields=Id", nil)
+	if err != nil {
+		return false, err
+	}
+	err = crmDo(req, nil)
+	if err == errCRMNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s salesforce) create(ctx context.Context, fields map[string]string) error {
+	req, err := s.request(ctx, "POST", "/sobjects/Opportunity", fields)
+	if err != nil {
+		return err
+	}
+	return crmDo(req, nil)
+}
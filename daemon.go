@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// runOnce scrapes and then notifies about what's pending, as running
+// without a command does. Unless notifyPartial is set, nothing is sent
+// after a run where some sources failed.
+func runOnce(ctx context.Context, st store, sc *scraper, dg *digester, notifyPartial bool) (err error) {
+	started := time.Now()
+	var sum runSummary
+	defer func() { sum.log(started, err) }()
+
+	sum = sc.scrape(ctx, st, false)
+	scraped, failed := sum.scraped(), sum.failed()
+	if scraped == 0 {
+		return nil
+	}
+	if len(failed) > 0 && !notifyPartial {
+		return fmt.Errorf("%d of %d sources failed, not notifying until a run where all succeed", len(failed), scraped)
+	}
+	// Still notify about anything stored before they failed, then fail
+	// the run.
+	if err := dg.run(ctx, st, failed); err != nil {
+		return err
+	}
+	if len(failed) == scraped {
+		return errors.New("all sources failed")
+	}
+	return nil
+}
+
+// runSchedule is when run runs: every interval, or when cron fires if
+// it's set.
+type runSchedule struct {
+	interval time.Duration
+	cron     *schedule
+	holidays holidayCalendar
+}
+
+// Set takes a duration such as 6h or a cron expression, as -schedule
+// does.
+func (s *runSchedule) Set(v string) error {
+	if d, err := time.ParseDuration(v); err == nil {
+		if d <= 0 {
+			return fmt.Errorf("interval must be positive, got %v", d)
+		}
+		s.interval, s.cron = d, nil
+		return nil
+	}
+	sched, err := parseSchedule(v)
+	if err != nil {
+		return fmt.Errorf("want a duration such as 6h or a cron expression: %w", err)
+	}
+	s.interval, s.cron = 0, &sched
+	return nil
+}
+
+func (s *runSchedule) String() string {
+	if s.cron != nil {
+		return s.cron.expr
+	}
+	if s.interval > 0 {
+		return s.interval.String()
+	}
+	return ""
+}
+
+// first returns when the first run is: right away on an interval, or when
+// the cron expression next fires.
+func (s *runSchedule) first(now time.Time) time.Time {
+	if s.cron != nil {
+		return s.cron.next(now, s.holidays)
+	}
+	return now
+}
+
+// after returns when the run after one started at started and finished at
+// now is. A run taking longer than the interval is followed right away.
+func (s *runSchedule) after(started, now time.Time) time.Time {
+	if s.cron != nil {
+		return s.cron.next(now, s.holidays)
+	}
+	if next := started.Add(s.interval); next.After(now) {
+		return next
+	}
+	return now
+}
+
+// daemon calls run on sched until SIGTERM or SIGINT. A signal between runs
+// exits right away. A signal during one lets it finish first, and a
+// second cancels it.
+func daemon(ctx context.Context, sched *runSchedule, run func(context.Context) error) {
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, syscall.SIGTERM, os.Interrupt)
+	defer signal.Stop(sigs)
+
+	next := sched.first(time.Now())
+	for {
+		if wait := time.Until(next); wait > 0 {
+			slog.Info("waiting for next run", "at", next.Format(time.RFC3339))
+			t := time.NewTimer(wait)
+			select {
+			case sig := <-sigs:
+				t.Stop()
+				slog.Info("exiting", "signal", sig)
+				return
+			case <-t.C:
+			}
+		}
+
+		started := time.Now()
+		rctx, cancel := context.WithCancel(ctx)
+		done := make(chan error, 1)
+		go func() { done <- run(rctx) }()
+		var err error
+		stopping := false
+	wait:
+		for {
+			select {
+			case err = <-done:
+				break wait
+			case sig := <-sigs:
+				if stopping {
+					slog.Info("cancelling the run", "signal", sig)
+					cancel()
+					continue
+				}
+				stopping = true
+				slog.Info("exiting after the current run; send it again to cancel the run", "signal", sig)
+			}
+		}
+		cancel()
+		if err != nil {
+			slog.Error("run failed", "err", err)
+		}
+		if stopping {
+			return
+		}
+		next = sched.after(started, time.Now())
+	}
+}
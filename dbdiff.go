@@ -0,0 +1,114 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"slices"
+)
+
+// tenderRows loads every row of the tenders table in the database at path,
+// keyed by id, along with the table's column names.
+func tenderRows(path string) (map[string]map[string]string, []string, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?mode=ro&_time_format=sqlite")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query("select * from tenders")
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	res := make(map[string]map[string]string)
+	for rows.Next() {
+		vals := make([]any, len(cols))
+		ptrs := make([]any, len(cols))
+		for i := range vals {
+			ptrs[i] = &vals[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, nil, err
+		}
+		row := make(map[string]string, len(cols))
+		for i, c := range cols {
+			if vals[i] == nil {
+				row[c] = "NULL"
+			} else {
+				row[c] = fmt.Sprint(vals[i])
+			}
+		}
+		res[row["id"]] = row
+	}
+	return res, cols, rows.Err()
+}
+
+// diffDBs writes the differences between the tenders in the databases at
+// oldPath and newPath to w, reporting whether there were any.
+func diffDBs(w io.Writer, oldPath, newPath string) (bool, error) {
+	oldRows, oldCols, err := tenderRows(oldPath)
+	if err != nil {
+		return false, err
+	}
+	newRows, newCols, err := tenderRows(newPath)
+	if err != nil {
+		return false, err
+	}
+
+	var differ bool
+
+	for _, c := range oldCols {
+		if !slices.Contains(newCols, c) {
+			fmt.Fprintf(w, "column %s only in %s\n", c, oldPath)
+			differ = true
+		}
+	}
+	for _, c := range newCols {
+		if !slices.Contains(oldCols, c) {
+			fmt.Fprintf(w, "column %s only in %s\n", c, newPath)
+			differ = true
+		}
+	}
+
+	var ids []string
+	for id := range oldRows {
+		ids = append(ids, id)
+	}
+	for id := range newRows {
+		if _, ok := oldRows[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+
+	for _, id := range ids {
+		o, inOld := oldRows[id]
+		n, inNew := newRows[id]
+		switch {
+		case !inNew:
+			fmt.Fprintf(w, "- %s %s\n", id, o["description"])
+			differ = true
+		case !inOld:
+			fmt.Fprintf(w, "+ %s %s\n", id, n["description"])
+			differ = true
+		default:
+			for _, c := range oldCols {
+				nv, ok := n[c]
+				if !ok || nv == o[c] {
+					continue
+				}
+				fmt.Fprintf(w, "~ %s %s: %q -> %q\n", id, c, o[c], nv)
+				differ = true
+			}
+		}
+	}
+
+	return differ, nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import "net/url"
+
+// duplicateThreshold is how much of their description terms two listings
+// on different sources must share, along with their close date, to be
+// taken as the same opportunity.
+const duplicateThreshold = 0.8
+
+// groupListings groups ts so that an opportunity listed on several
+// sources, such as a municipal tender mirrored on the provincial portal,
+// is one group. Each group starts with its first listing in ts, and groups
+// are in the order of those.
+func groupListings(ts []Tender) [][]Tender {
+	var groups [][]Tender
+	terms := make([]map[string]bool, len(ts))
+	for i, t := range ts {
+		terms[i] = make(map[string]bool)
+		for _, term := range similarityTerms(t.Description) {
+			terms[i][term] = true
+		}
+	}
+
+	grouped := make([]bool, len(ts))
+	for i, t := range ts {
+		if grouped[i] {
+			continue
+		}
+		g := []Tender{t}
+		hosts := map[string]bool{listingHost(t): true}
+		for j := i + 1; j < len(ts); j++ {
+			o := ts[j]
+			if grouped[j] || hosts[listingHost(o)] || o.CloseDate.Format(dateFormat) != t.CloseDate.Format(dateFormat) {
+				continue
+			}
+			if jaccard(terms[i], terms[j]) < duplicateThreshold {
+				continue
+			}
+			grouped[j] = true
+			hosts[listingHost(o)] = true
+			g = append(g, o)
+		}
+		groups = append(groups, g)
+	}
+	return groups
+}
+
+// firstListings returns the first listing of each opportunity in ts.
+func firstListings(ts []Tender) []Tender {
+	var res []Tender
+	for _, g := range groupListings(ts) {
+		res = append(res, g[0])
+	}
+	return res
+}
+
+func listingHost(t Tender) string {
+	u, err := url.Parse(t.URL)
+	if err != nil {
+		return t.URL
+	}
+	return u.Host
+}
+
+// jaccard returns how much of a and b's terms they share, from 0 to 1.
+func jaccard(a, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	var shared int
+	for term := range a {
+		if b[term] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
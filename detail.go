@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/playwright-community/playwright-go"
+)
+
+// tenderDetail is what a tender's detail page adds to its listing.
+type tenderDetail struct {
+	// Scope is the full scope text, where listings often truncate it.
+	Scope     string
+	Documents []detailFile
+	Addenda   []detailFile
+}
+
+// detailFile is a document or addendum listed on a detail page. Downloading
+// them needs a registered plan taker, so only what's listed is kept.
+type detailFile struct {
+	Name   string
+	Posted string
+}
+
+// detailer is a Source that can fetch a tender's detail page.
+type detailer interface {
+	Detail(ctx context.Context, id string) (*tenderDetail, error)
+}
+
+// detailJS pulls the scope and the document and addenda tables out of a
+// detail page by their headings, since the page has no stable IDs for them.
+const detailJS = `() => {
+	const headings = [...document.querySelectorAll("h1, h2, h3, h4, legend, .panel-title, .card-header")];
+	const after = (re) => {
+		const h = headings.find((h) => re.test(h.innerText.trim()));
+		if (!h) return null;
+		return h.closest(".panel, .card, fieldset, section") || h.parentElement;
+	};
+	const files = (re) => {
+		const el = after(re);
+		if (!el) return [];
+		return [...el.querySelectorAll("tbody tr")].map((tr) => {
+			const cells = [...tr.querySelectorAll("td")].map((td) => td.innerText.trim());
+			return {name: cells[0] || "", posted: cells.find((c, i) => i > 0 && /\d{4}/.test(c)) || ""};
+		}).filter((f) => f.name);
+	};
+	const scope = after(/^scope/i);
+	return {
+		scope: scope ? scope.innerText.replace(/^\s*scope[^\n]*\n/i, "").trim() : "",
+		documents: files(/^documents/i),
+		addenda: files(/^addend/i),
+	};
+}`
+
+// Detail fetches the detail page of the tender with the portal's item id,
+// in a tab of its own so listing isn't disturbed. Listing directly, it
+// returns nil rather than start a browser just for details.
+func (c *Client) Detail(ctx context.Context, id string) (*tenderDetail, error) {
+	if c.direct {
+		return nil, nil
+	}
+	if !c.ready {
+		if err := runStage(ctx, "starting browser", c.initTimeout, c.init); err != nil {
+			return nil, err
+		}
+	}
+
+	var d *tenderDetail
+	err := runStage(ctx, "fetching detail "+id, c.pageTimeout, func(ctx context.Context) error {
+		var err error
+		d, err = c.detail(ctx, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (c *Client) detail(ctx context.Context, id string) (*tenderDetail, error) {
+	if c.dp == nil {
+		dp, err := c.p.Context().NewPage()
+		if err != nil {
+			return nil, fmt.Errorf("creating detail page: %w", err)
+		}
+		c.dp = dp
+	}
+
+	u := c.u.ResolveReference(&url.URL{Path: "/Module/Tenders/en/Tender/Detail/" + id})
+	if _, err := c.dp.Goto(u.String(), playwright.PageGotoOptions{WaitUntil: playwright.WaitUntilStateNetworkidle, Timeout: pwTimeout(ctx)}); err != nil {
+		return nil, fmt.Errorf("going to detail page: %w", err)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	res, err := c.dp.Evaluate(detailJS)
+	if err != nil {
+		return nil, fmt.Errorf("reading detail page: %w", err)
+	}
+	m, _ := res.(map[string]any)
+	d := &tenderDetail{Scope: detailString(m["scope"])}
+	d.Scope = cleanText(d.Scope)
+	d.Documents = detailFiles(m["documents"])
+	d.Addenda = detailFiles(m["addenda"])
+	return d, nil
+}
+
+func detailString(v any) string {
+	s, _ := v.(string)
+	return cleanText(s)
+}
+
+func detailFiles(v any) []detailFile {
+	vs, _ := v.([]any)
+	var fs []detailFile
+	for _, v := range vs {
+		m, _ := v.(map[string]any)
+		f := detailFile{Name: detailString(m["name"]), Posted: detailString(m["posted"])}
+		if f.Name != "" {
+			fs = append(fs, f)
+		}
+	}
+	return fs
+}
+
+// setDetail stores d as the detail of the tender with id, replacing what
+// was stored before.
+func (s store) setDetail(tenderID string, d *tenderDetail) error {
+	if d == nil {
+		return nil
+	}
+	_, err := s.db.Exec("insert into tender_details (tender_id, scope, fetched) values (?, ?, ?) on conflict (tender_id) do update set scope = excluded.scope, fetched = excluded.fetched",
+		tenderID, d.Scope, time.Now())
+	if err != nil {
+		return fmt.Errorf("insert tender detail: %v", err)
+	}
+	if _, err := s.db.Exec("delete from tender_files where tender_id = ?", tenderID); err != nil {
+		return fmt.Errorf("delete tender files: %v", err)
+	}
+	for kind, fs := range map[string][]detailFile{"document": d.Documents, "addendum": d.Addenda} {
+		for i, f := range fs {
+			_, err := s.db.Exec("insert into tender_files (tender_id, kind, position, name, posted) values (?, ?, ?, ?, ?)", tenderID, kind, i, f.Name, f.Posted)
+			if err != nil {
+				return fmt.Errorf("insert tender file: %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+// detail returns the stored detail of the tender with id, or nil if it
+// hasn't been fetched.
+func (s store) detail(tenderID string) (*tenderDetail, error) {
+	var d tenderDetail
+	err := s.db.QueryRow("select scope from tender_details where tender_id = ?", tenderID).Scan(&d.Scope)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query("select kind, name, posted from tender_files where tender_id = ? order by kind, position", tenderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var kind string
+		var f detailFile
+		if err := rows.Scan(&kind, &f.Name, &f.Posted); err != nil {
+			return nil, err
+		}
+		if kind == "addendum" {
+			d.Addenda = append(d.Addenda, f)
+		} else {
+			d.Documents = append(d.Documents, f)
+		}
+	}
+	return &d, rows.Err()
+}
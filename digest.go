@@ -0,0 +1,151 @@
+package main
+
+import (
+	_ "embed"
+	"html/template"
+	"os"
+	"regexp"
+	"slices"
+	texttemplate "text/template"
+	"time"
+)
+
+// digest is the data the digest email template renders.
+type digest struct {
+	// ID identifies the digest, to find it again later.
+	ID string
+	// At is the time of the run the digest is from.
+	At           time.Time
+	FromName     string
+	InlineImages bool
+	Logo         bool
+	Tenders      []digestTender
+	// ClosingReminder is set when Tenders are announced tenders closing
+	// soon, being reminded about, rather than new ones.
+	ClosingReminder bool
+	// OtherAgencies is set when some tenders aren't HRM's, so each
+	// tender's agency is shown.
+	OtherAgencies bool
+	Alerts        []documentAlert
+	Reminders     []questionReminder
+	Retractions   []retraction
+	// Updated are already announced tenders that have changed since,
+	// besides in status.
+	Updated []updatedTender
+	// StatusChanges are already announced tenders whose status on the
+	// portal has changed, such as to closed or awarded.
+	StatusChanges []tenderChange
+	// FailedSources are sources that failed partway through the run, so
+	// their tenders may be incomplete.
+	FailedSources []string
+
+	// brands are how agencies' sections are shown.
+	brands agencyBrands
+}
+
+type updatedTender struct {
+	TenderID    string
+	Description string
+	Changes     []tenderChange
+}
+
+type digestTender struct {
+	Tender
+	// Link is the URL to use in the email, which may have tracking
+	// parameters added.
+	Link string
+	// RecordLink is the URL of the team's own record of the tender, if
+	// -internal-link-template is set.
+	RecordLink  string
+	ClosingSoon bool
+	// AfterHoliday is the holiday the business day before the close date
+	// is, if any. Question deadlines often get compressed around those.
+	AfterHoliday string
+	// AlsoListed are the same opportunity's listings on other sources.
+	AlsoListed []otherListing
+}
+
+type otherListing struct {
+	Agency string
+	Link   string
+}
+
+// Buyer returns the contact to show for the tender, preferring one with a
+// name, or nil if there are none.
+func (t digestTender) Buyer() *contact {
+	for _, c := range t.Contacts {
+		if c.Name != "" {
+			return &c
+		}
+	}
+	if len(t.Contacts) > 0 {
+		return &t.Contacts[0]
+	}
+	return nil
+}
+
+// Agencies groups the tenders by agency, in order of the first of each
+// agency's tenders, with each agency's branding.
+func (d digest) Agencies() []agencyTenders {
+	var as []agencyTenders
+	for _, t := range d.Tenders {
+		i := slices.IndexFunc(as, func(a agencyTenders) bool { return a.Agency == t.Agency })
+		if i < 0 {
+			b := d.brands[t.Agency]
+			a := agencyTenders{Agency: t.Agency, Name: d.brands.Name(t.Agency), Color: b.Color}
+			if d.InlineImages && len(b.logo) > 0 {
+				a.LogoCID = agencyLogoCID(t.Agency)
+			}
+			as = append(as, a)
+			i = len(as) - 1
+		}
+		as[i].Tenders = append(as[i].Tenders, t)
+	}
+	return as
+}
+
+type agencyTenders struct {
+	Agency string
+	// Name, Color and LogoCID are the agency's display name, colour if it
+	// has one and the cid of its inline logo if it has one.
+	Name    string
+	Color   string
+	LogoCID string
+	Tenders []digestTender
+}
+
+var cidUnsafeRe = regexp.MustCompile(`[^A-Za-z0-9-]+`)
+
+// agencyLogoCID returns the cid of agency's logo in messages.
+func agencyLogoCID(agency string) string {
+	return "agency-logo-" + cidUnsafeRe.ReplaceAllString(agency, "-")
+}
+
+// digestHTML lays the digest out with tables and inline styles, which is
+// what Outlook and Gmail reliably render, and switches colours under
+// prefers-color-scheme for clients that support dark mode. It can be
+// replaced with -email-template.
+//
+//go:embed templates/digest.html
+var digestHTML string
+
+// digestText is the plain text alternative to digestHTML, for clients
+// that prefer it or can't show HTML.
+//
+//go:embed templates/digest.txt
+var digestText string
+
+var (
+	digestTmpl     = template.Must(template.New("digest").Parse(digestHTML))
+	digestTextTmpl = texttemplate.Must(texttemplate.New("digest").Parse(digestText))
+)
+
+// loadDigestTemplate parses the HTML digest template in the file at path,
+// which renders a digest.
+func loadDigestTemplate(path string) (*template.Template, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return template.New("digest").Parse(string(b))
+}
@@ -0,0 +1,502 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// digester sends what's pending in the store over the configured
+// channels, and saved search digests, texts and calls.
+type digester struct {
+	// email is the template for the email channel, or nil if email isn't
+	// one of the channels or no provider is configured.
+	email *notifier
+	// filters are -recipient-include and -recipient-exclude, added to
+	// subscribers' own preferences.
+	filters recipientFilters
+	// others are the channels besides email.
+	others []channel
+
+	// ops, if set, sends the operator a daily summary after runs.
+	ops *opsDigest
+
+	sms         smsGateway
+	voice       voiceGateway
+	links       linkShortener
+	closingSoon closingSoonHorizons
+
+	maxBidSecurity, maxBidSecurityPercent float64
+	skipLocalOnly                         bool
+	agreements                            []string
+	unspscPrefixes                        []string
+	keywords                              keywordFilter
+
+	questionReminderWithin time.Duration
+	// closingReminderWithin is how close to closing an announced tender
+	// gets a reminder email of its own; 0 disables them.
+	closingReminderWithin time.Duration
+	notifyTimeout         time.Duration
+	quietPeriod           time.Duration
+	force                 bool
+	// skipNotify writes what's pending to out and marks it notified
+	// instead of sending it.
+	skipNotify bool
+	// dryRun sends to out and marks nothing.
+	dryRun bool
+	out    io.Writer
+
+	// mu keeps runs from overlapping.
+	mu sync.Mutex
+}
+
+// run notifies about what's pending. failed are the sources that failed
+// on the run just before, to mark digests partial.
+func (d *digester) run(ctx context.Context, st store, failed []string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	paused, err := st.notificationsPaused()
+	if err != nil {
+		return err
+	}
+	if !paused.IsZero() && !d.dryRun {
+		slog.Info("notifications paused, leaving what's pending queued", "since", paused.Format(time.RFC3339))
+		return nil
+	}
+
+	pending, nt, upd, err := d.pending(st)
+	if err != nil {
+		return err
+	}
+
+	skip := d.skipNotify
+	if !d.force && !skip && !d.dryRun && len(nt) > 0 {
+		var held []Tender
+		if nt, held, err = d.holdQuiet(st, nt); err != nil {
+			return err
+		}
+		// They stay pending, to be sent once the quiet period is over
+		// or with -force.
+		pending = slices.DeleteFunc(pending, func(t Tender) bool {
+			return slices.ContainsFunc(held, func(h Tender) bool { return h.ID == t.ID })
+		})
+		for _, t := range held {
+			fmt.Fprintln(d.out, t.ID, t.Description)
+		}
+	}
+
+	subs, err := d.subscribers(st)
+	if err != nil {
+		return err
+	}
+
+	var chs []channel
+	var email *notifier
+	if d.email != nil {
+		n := *d.email
+		n.toEmails, n.filters = emailFilters(subs)
+		// Each recipient has its own backlog, so one whose send failed
+		// doesn't hold back the rest.
+		n.backlog = make(map[string]channelBacklog)
+		all := upd
+		for _, to := range n.toEmails {
+			if n.backlog[to], err = st.undelivered("email:" + to); err != nil {
+				return err
+			}
+			all = all.merge(n.backlog[to].updates)
+		}
+		if n.updated, err = st.updatedTenders(all); err != nil {
+			return err
+		}
+		n.failedSources = failed
+		if !d.dryRun {
+			n.st = &st
+		}
+		email = &n
+		chs = append(chs, email)
+	}
+	chs = append(chs, d.others...)
+	chs = append(chs, d.channelsFor(subs)...)
+
+	if len(chs) == 0 || skip {
+		for _, t := range nt {
+			fmt.Fprintln(d.out, t.ID, t.Description)
+		}
+		for _, a := range upd.alerts {
+			fmt.Fprintf(d.out, "%s %s mentions %q\n", a.TenderID, a.Name, a.Keyword)
+		}
+		for _, r := range upd.reminders {
+			fmt.Fprintf(d.out, "%s questions due %s\n", r.TenderID, r.At.Format(time.RFC3339))
+		}
+		for _, r := range upd.retractions {
+			fmt.Fprintf(d.out, "%s retracted, %s\n", r.TenderID, r.Reason)
+		}
+		for _, c := range upd.changes {
+			fmt.Fprintf(d.out, "%s %s\n", c.TenderID, c)
+		}
+		if err := st.markTendersNotified(pending); err != nil {
+			return err
+		}
+		if err := st.markUpdatesNotified(upd); err != nil {
+			return err
+		}
+		return d.remind(ctx, st, skip)
+	}
+
+	backlog := make(map[string]channelBacklog)
+	for _, ch := range chs {
+		if ch == email {
+			continue
+		}
+		if backlog[ch.name()], err = st.undelivered(ch.name()); err != nil {
+			return err
+		}
+	}
+	failedChs := notifyChannels(ctx, st, !d.dryRun, chs, d.notifyTimeout, nt, upd, backlog)
+	var re recipientErrors
+	if errors.As(failedChs["email"], &re) && len(re) < len(email.toEmails) {
+		// Some recipients got it.
+		delete(failedChs, "email")
+	}
+	if len(failedChs) == len(chs) {
+		return errors.New("notifying failed on every channel")
+	}
+	if !d.dryRun {
+		// What a channel or email recipient failed to get stays owed to
+		// it while the others move on.
+		owed := channelBacklog{tenders: nt, updates: upd}
+		for _, ch := range chs {
+			if ch == email {
+				err := failedChs["email"]
+				for _, to := range email.toEmails {
+					add, delivered := owed, email.backlog[to]
+					if err == nil && re[to] == nil {
+						add = channelBacklog{}
+					} else {
+						delivered = channelBacklog{}
+					}
+					if err := st.setUndelivered("email:"+to, add, delivered); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+			add, delivered := owed, backlog[ch.name()]
+			if _, ok := failedChs[ch.name()]; !ok {
+				add = channelBacklog{}
+			} else {
+				delivered = channelBacklog{}
+			}
+			if err := st.setUndelivered(ch.name(), add, delivered); err != nil {
+				return err
+			}
+		}
+		if err := st.markTendersNotified(pending); err != nil {
+			return err
+		}
+		if err := st.markUpdatesNotified(upd); err != nil {
+			return err
+		}
+	}
+
+	if err := d.notifySearches(ctx, st, email, nt); err != nil {
+		return err
+	}
+	return d.remind(ctx, st, false)
+}
+
+// holdQuiet splits ts into the tenders to notify about and those held
+// back because the source that listed them looks newly added, or the
+// store looks freshly created or restored, as quietReason says.
+func (d *digester) holdQuiet(st store, ts []Tender) (send, held []Tender, err error) {
+	reasons := make(map[string]string)
+	counts := make(map[string]int)
+	for _, t := range ts {
+		reason, ok := reasons[t.source]
+		if !ok {
+			if reason, err = st.quietReason(t.source, d.quietPeriod, time.Now()); err != nil {
+				return nil, nil, err
+			}
+			reasons[t.source] = reason
+		}
+		if reason == "" {
+			send = append(send, t)
+			continue
+		}
+		held = append(held, t)
+		counts[t.source]++
+	}
+	for _, source := range slices.Sorted(maps.Keys(counts)) {
+		if source == "" {
+			slog.Warn("not notifying since the store looks recreated or restored; use -force to notify anyway", "tenders", counts[source], "reason", reasons[source])
+			continue
+		}
+		slog.Warn("not notifying about tenders from a source that looks newly added; use -force to notify anyway", "source", source, "tenders", counts[source], "reason", reasons[source])
+	}
+	return send, held, nil
+}
+
+// remind emails subscribers about announced tenders closing within
+// closingReminderWithin, separately from the digest, so a tender announced
+// weeks ago isn't forgotten as its deadline nears. With skip, they're
+// written to out and marked sent instead. Without email, they're only
+// written to out, and stay due in case email is set up later.
+func (d *digester) remind(ctx context.Context, st store, skip bool) error {
+	due, err := st.dueClosingReminders(d.closingReminderWithin, time.Now())
+	if err != nil || len(due) == 0 {
+		return err
+	}
+	ts := d.filter(due)
+
+	if d.email == nil || skip {
+		for _, t := range ts {
+			fmt.Fprintf(d.out, "%s closes %s\n", t.ID, formatStoredTime(t.CloseDate))
+		}
+		if !skip {
+			return nil
+		}
+		return st.markClosingRemindersSent(due)
+	}
+
+	subs, err := d.subscribers(st)
+	if err != nil {
+		return err
+	}
+	n := *d.email
+	n.toEmails, n.filters = emailFilters(subs)
+	n.closingReminder = true
+	if err := runSend(ctx, d.notifyTimeout, func(ctx context.Context) error { return n.notify(ctx, ts, updates{}) }); err != nil {
+		return fmt.Errorf("sending closing reminders: %w", err)
+	}
+	if d.dryRun {
+		return nil
+	}
+	return st.markClosingRemindersSent(due)
+}
+
+// pending returns the tenders waiting to be notified about, those of them
+// that pass the filters, and the pending updates.
+func (d *digester) pending(st store) (pending, filtered []Tender, upd updates, err error) {
+	pending, err = st.pendingTenders()
+	if err != nil {
+		return nil, nil, updates{}, err
+	}
+	filtered = d.filter(pending)
+
+	upd, err = st.pendingUpdates(d.questionReminderWithin, time.Now())
+	if err != nil {
+		return nil, nil, updates{}, err
+	}
+	return pending, filtered, upd, nil
+}
+
+// filter returns the tenders in ts that pass the filters.
+func (d *digester) filter(ts []Tender) []Tender {
+	ts = withoutProhibitiveBidSecurity(ts, d.maxBidSecurity, d.maxBidSecurityPercent)
+	ts = filterTradeTerms(ts, d.skipLocalOnly, d.agreements)
+	ts = filterUNSPSC(ts, d.unspscPrefixes)
+	return filterKeywords(ts, d.keywords)
+}
+
+// preview writes to w what recipient, an email address or phone number,
+// would be sent if notifications went out now: the digest if they're a
+// subscriber, and what each saved search they subscribe to would send
+// them. Nothing is sent or marked notified.
+func (d *digester) preview(ctx context.Context, w io.Writer, st store, recipient string) error {
+	paused, err := st.notificationsPaused()
+	if err != nil {
+		return err
+	}
+	if !paused.IsZero() {
+		fmt.Fprintf(w, "Notifications are paused since %s, so nothing would be sent until they're resumed.\n\n", paused.Format(time.RFC3339))
+	}
+	active, err := st.activeRecipients([]string{recipient})
+	if err != nil {
+		return err
+	}
+	if len(active) == 0 {
+		fmt.Fprintf(w, "%s is paused, so nothing would be sent to them.\n\n", recipient)
+	}
+
+	_, nt, upd, err := d.pending(st)
+	if err != nil {
+		return err
+	}
+	updated, err := st.updatedTenders(upd)
+	if err != nil {
+		return err
+	}
+
+	var email *notifier
+	if d.email != nil {
+		n := *d.email
+		n.provider = printProvider{w}
+		n.sendInterval = 0
+		email = &n
+	}
+
+	subs, err := d.subscribers(st)
+	if err != nil {
+		return err
+	}
+	subscribed := false
+	for _, sub := range subs {
+		if sub.Target != recipient {
+			continue
+		}
+		subscribed = true
+		ts := sub.filter().apply(sub.Target, nt)
+		upd := sub.filter().applyUpdates(updated, upd)
+		switch {
+		case sub.Channel == "email" && email == nil:
+			fmt.Fprintf(w, "%s gets the digest, but email isn't one of the channels or no provider is configured.\n\n", recipient)
+		case len(ts) == 0 && (sub.Channel != "email" || upd.empty()):
+			fmt.Fprintf(w, "%s gets the digest by %s, but nothing pending matches their preferences.\n\n", recipient, sub.Channel)
+		case sub.Channel == "email":
+			fmt.Fprintf(w, "Digest:\n\n")
+			n := *email
+			n.toEmails = []string{recipient}
+			n.filters = nil
+			if err := n.notify(ctx, ts, upd); err != nil {
+				return err
+			}
+			fmt.Fprintln(w)
+		case sub.Channel == "sms":
+			fmt.Fprintf(w, "Digest by sms:\n\n")
+			if err := notifySMS(ctx, printGateway{w}, linkShortener{}, d.closingSoon["sms"], "your subscription", []string{recipient}, firstListings(ts)); err != nil {
+				return err
+			}
+		case sub.Channel == "voice":
+			fmt.Fprintf(w, "Digest by voice:\n\n")
+			if err := notifyVoice(ctx, printGateway{w}, d.closingSoon["voice"], "your subscription", []string{recipient}, firstListings(ts)); err != nil {
+				return err
+			}
+		}
+	}
+
+	searches, err := st.savedSearches()
+	if err != nil {
+		return err
+	}
+	for _, ss := range searches {
+		var matched []Tender
+		for _, t := range nt {
+			if ss.matches(t) {
+				matched = append(matched, t)
+			}
+		}
+		for _, channel := range []string{"email", "sms", "voice"} {
+			if !slices.Contains(ss.targets(channel), recipient) {
+				continue
+			}
+			subscribed = true
+			fmt.Fprintf(w, "Saved search %q by %s: %d matching tenders\n\n", ss.Name, channel, len(matched))
+			if len(matched) == 0 || len(active) == 0 {
+				continue
+			}
+			var err error
+			switch channel {
+			case "email":
+				if email == nil {
+					continue
+				}
+				n := *email
+				n.toEmails = active
+				n.subject = email.subject + " matching " + ss.Name
+				err = n.notify(ctx, matched, updates{})
+			case "sms":
+				err = notifySMS(ctx, printGateway{w}, linkShortener{}, d.closingSoon["sms"], ss.Name, active, firstListings(matched))
+			case "voice":
+				err = notifyVoice(ctx, printGateway{w}, d.closingSoon["voice"], ss.Name, active, firstListings(matched))
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if !subscribed {
+		fmt.Fprintf(w, "%s doesn't get the digest or subscribe to any saved searches.\n", recipient)
+	}
+	return nil
+}
+
+// notifySearches sends each saved search's subscribers the tenders in nt
+// matching it. email is the run's email notifier, if any.
+func (d *digester) notifySearches(ctx context.Context, st store, email *notifier, nt []Tender) error {
+	searches, err := st.savedSearches()
+	if err != nil {
+		return err
+	}
+	for _, ss := range searches {
+		var matched []Tender
+		for _, t := range nt {
+			if ss.matches(t) {
+				matched = append(matched, t)
+			}
+		}
+		emails, err := st.activeRecipients(ss.targets("email"))
+		if err != nil {
+			return err
+		}
+		if email != nil {
+			sn := *email
+			sn.toEmails = emails
+			sn.backlog = nil
+			sn.subject = email.subject + " matching " + ss.Name
+			if err := runSend(ctx, d.notifyTimeout, func(ctx context.Context) error { return sn.notify(ctx, matched, updates{}) }); err != nil {
+				slog.Error("notifying saved search", "search", ss.Name, "err", err)
+			}
+		}
+
+		if len(matched) == 0 {
+			continue
+		}
+		// Texts and calls are short, so just the first listing of each.
+		matched = firstListings(matched)
+
+		phones, err := st.activeRecipients(ss.targets("sms"))
+		if err != nil {
+			return err
+		}
+		if len(phones) > 0 && d.sms == nil {
+			slog.Warn("not texting saved search subscribers since TWILIO_ACCOUNT_SID, TWILIO_AUTH_TOKEN and TWILIO_FROM aren't all set", "search", ss.Name, "subscribers", len(phones))
+		} else if len(phones) > 0 {
+			if err := runSend(ctx, d.notifyTimeout, func(ctx context.Context) error {
+				return notifySMS(ctx, d.sms, d.links, d.closingSoon["sms"], ss.Name, phones, matched)
+			}); err != nil {
+				slog.Error("texting saved search", "search", ss.Name, "err", err)
+			}
+		}
+
+		callees, err := st.activeRecipients(ss.targets("voice"))
+		if err != nil {
+			return err
+		}
+		if len(callees) > 0 && d.voice == nil {
+			slog.Warn("not calling saved search subscribers since TWILIO_ACCOUNT_SID, TWILIO_AUTH_TOKEN and TWILIO_FROM aren't all set", "search", ss.Name, "subscribers", len(callees))
+		} else if len(callees) > 0 {
+			if err := runSend(ctx, d.notifyTimeout, func(ctx context.Context) error {
+				return notifyVoice(ctx, d.voice, d.closingSoon["voice"], ss.Name, callees, matched)
+			}); err != nil {
+				slog.Error("calling saved search", "search", ss.Name, "err", err)
+			}
+		}
+	}
+	return nil
+}
+
+// splitList splits a comma-separated flag value, returning nil for "".
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// digestID returns the ID of the digest of ts sent to toEmails at at. It's
+// short enough to quote, and included in the digest and logs so a digest
+// can be found again.
+func digestID(at time.Time, toEmails []string, ts []Tender) string {
+	h := sha256.New()
+	fmt.Fprintln(h, at.UTC().Format(time.RFC3339Nano))
+	fmt.Fprintln(h, strings.Join(toEmails, ";"))
+	for _, t := range ts {
+		fmt.Fprintln(h, t.ID)
+	}
+	return hex.EncodeToString(h.Sum(nil))[:12]
+}
+
+// digestUpdates is how a digest's updates are stored.
+type digestUpdates struct {
+	Alerts      []documentAlert    `json:"alerts,omitempty"`
+	Reminders   []questionReminder `json:"reminders,omitempty"`
+	Retractions []retraction       `json:"retractions,omitempty"`
+	Changes     []tenderChange     `json:"changes,omitempty"`
+}
+
+func encodeUpdates(u updates) ([]byte, error) {
+	return json.Marshal(digestUpdates{Alerts: u.alerts, Reminders: u.reminders, Retractions: u.retractions, Changes: u.changes})
+}
+
+func decodeUpdates(b []byte) (updates, error) {
+	var du digestUpdates
+	if err := json.Unmarshal(b, &du); err != nil {
+		return updates{}, err
+	}
+	return updates{alerts: du.Alerts, reminders: du.Reminders, retractions: du.Retractions, changes: du.Changes}, nil
+}
+
+// recordDigest records a sent digest, with its tenders in the order given.
+func (s store) recordDigest(id string, at time.Time, subject string, toEmails []string, ts []Tender, u updates, failedSources []string) error {
+	b, err := encodeUpdates(u)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec("insert into digests (id, sent, subject, recipients, failed_sources, updates) values (?, ?, ?, ?, ?, ?)",
+		id, at, subject, strings.Join(toEmails, ";"), strings.Join(failedSources, ","), b)
+	if err != nil {
+		return fmt.Errorf("insert digest: %v", err)
+	}
+	for i, t := range ts {
+		if _, err := s.db.Exec("insert into digest_tenders (digest_id, position, tender_id) values (?, ?, ?)", id, i, t.ID); err != nil {
+			return fmt.Errorf("insert digest tender: %v", err)
+		}
+	}
+	return nil
+}
+
+// sentDigest is a digest as recorded when it was sent.
+type sentDigest struct {
+	ID            string
+	Sent          time.Time
+	Subject       string
+	Recipients    []string
+	FailedSources []string
+	Tenders       []Tender
+	Updates       updates
+}
+
+// digest returns the recorded digest with id, with its tenders as they're
+// stored now, or sql.ErrNoRows.
+func (s store) digest(id string) (sentDigest, error) {
+	d := sentDigest{ID: id}
+	var recipients, failed string
+	var b []byte
+	err := s.db.QueryRow("select sent, subject, recipients, failed_sources, updates from digests where id = ?", id).
+		Scan(&d.Sent, &d.Subject, &recipients, &failed, &b)
+	if err != nil {
+		return d, err
+	}
+	// Split on what they were joined with, since display names can have
+	// commas.
+	if recipients != "" {
+		d.Recipients = strings.Split(recipients, ";")
+	}
+	d.FailedSources = splitList(failed)
+
+	if d.Updates, err = decodeUpdates(b); err != nil {
+		return d, fmt.Errorf("digest %s updates: %w", id, err)
+	}
+
+	rows, err := s.db.Query("select tender_id from digest_tenders where digest_id = ? order by position", id)
+	if err != nil {
+		return d, err
+	}
+	var ids []string
+	for rows.Next() {
+		var tid string
+		if err := rows.Scan(&tid); err != nil {
+			rows.Close()
+			return d, err
+		}
+		ids = append(ids, tid)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return d, err
+	}
+	for _, tid := range ids {
+		t, err := s.archivedTender(tid)
+		if err != nil {
+			return d, fmt.Errorf("digest %s tender %s: %w", id, tid, err)
+		}
+		if err := s.loadDetails(&t.Tender); err != nil {
+			return d, err
+		}
+		d.Tenders = append(d.Tenders, t.Tender)
+	}
+	return d, nil
+}
+
+// resend renders the recorded digest with id again, as of when it was
+// sent, and sends it to to, or its original recipients if to is empty.
+// Tenders are rendered as they're stored now, so details fetched since
+// show up.
+func (d *digester) resend(ctx context.Context, st store, id string, to []string) error {
+	if d.email == nil {
+		return errors.New("resending needs the email channel and a configured provider")
+	}
+	sd, err := st.digest(id)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("no digest %s", id)
+	}
+	if err != nil {
+		return err
+	}
+	if len(to) == 0 {
+		to = sd.Recipients
+	}
+
+	n := *d.email
+	n.failedSources = sd.FailedSources
+	m, err := n.render(sd.ID, sd.Sent, sd.Tenders, sd.Updates)
+	if err != nil {
+		return err
+	}
+	m.subject = sd.Subject
+	for _, te := range to {
+		em, err := mail.ParseAddress(te)
+		if err != nil {
+			return err
+		}
+		m.bcc = append(m.bcc, em)
+	}
+	if err := n.send(ctx, m); err != nil {
+		return err
+	}
+	slog.Info("resent digest", "digest", id, "recipients", len(to))
+	return nil
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// directPageSize is how many tenders listDirect asks for per page.
+const directPageSize = 50
+
+// listDirect lists a page by posting to the portal's search endpoint
+// itself, the way the listing page's script does, rather than driving a
+// browser. The session cookies it needs come from loading the tender
+// module page first. Tokens are page indexes.
+func (c *Client) listDirect(ctx context.Context, token string) (_ []Tender, nextToken string, _ error) {
+	if c.hc == nil {
+		jar, err := cookiejar.New(nil)
+		if err != nil {
+			return nil, "", err
+		}
+		hc := c.egress.httpClient()
+		hc.Jar = jar
+		if err := directGet(ctx, hc, c.u.String()); err != nil {
+			return nil, "", fmt.Errorf("loading tender module: %w", err)
+		}
+		c.hc = hc
+	}
+
+	var index int
+	if token != "" {
+		var err error
+		if index, err = strconv.Atoi(token); err != nil {
+			return nil, "", fmt.Errorf("bad page token %q", token)
+		}
+	}
+
+	// These mirror the options the listing's repeater sends, with the
+	// status filter set to all as init does in the browser.
+	resp, err := c.directSearch(ctx, url.Values{
+		"pageIndex": {strconv.Itoa(index)},
+		"pageSize":  {strconv.Itoa(directPageSize)},
+		"status":    {"All"},
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	// Backfill pages can run to megabytes, so the response is archived
+	// and decoded as it's read rather than read in whole, up to
+	// maxSearchResponseSize.
+	var body io.Reader = &sizeLimitReader{r: resp.Body, n: maxSearchResponseSize}
+	if w := c.archive.writer(c.u.Host, time.Now()); w != nil {
+		defer w.Close()
+		body = io.TeeReader(body, w)
+	}
+	r, err := c.decodePage(body)
+	if err != nil {
+		return nil, "", err
+	}
+	// Archive anything after the response's closing brace too.
+	io.Copy(io.Discard, body)
+	if token == "" && !r.success && len(r.ids) == 0 {
+		// Most likely the session wasn't accepted, which the browser can
+		// deal with.
+		return nil, "", fmt.Errorf("search not successful (total %d)", r.total)
+	}
+	if token == "" {
+		if err := c.checkAllFilter(ctx, r.total); err != nil {
+			return nil, "", err
+		}
+	}
+
+	tenders, stop, err := c.listed(token, r)
+	if err != nil || stop {
+		return nil, "", err
+	}
+	if len(r.ids) > 0 && (index+1)*directPageSize < r.total {
+		nextToken = strconv.Itoa(index + 1)
+	}
+	if err := c.checkTotal(nextToken, r.total); err != nil {
+		return nil, "", err
+	}
+	return tenders, nextToken, nil
+}
+
+// directSearch posts form to the portal's search endpoint, returning the
+// response if it's OK.
+func (c *Client) directSearch(ctx context.Context, form url.Values) (*http.Response, error) {
+	u := c.u.ResolveReference(&url.URL{Path: "/Module/Tenders/en/Tender/Search/"})
+	req, err := http.NewRequestWithContext(ctx, "POST", u.String(), strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=UTF-8")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("X-Requested-With", "XMLHttpRequest")
+	req.Header.Set("Referer", c.u.String())
+
+	resp, err := c.hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("search returned %s: %s", resp.Status, b)
+	}
+	return resp, nil
+}
+
+// checkAllFilter checks that the status filter listDirect sends took, by
+// comparing total, what it listed, with the total of the portal's default
+// view of open tenders, which a filter it didn't take would leave. The
+// all view has more unless every tender on the portal is open, which is
+// unlikely enough that the browser, whose filter is checked as it's
+// clicked, is left to list it instead.
+func (c *Client) checkAllFilter(ctx context.Context, total int) error {
+	resp, err := c.directSearch(ctx, url.Values{
+		"pageIndex": {"0"},
+		"pageSize":  {"1"},
+	})
+	if err != nil {
+		return fmt.Errorf("checking the status filter: %w", err)
+	}
+	defer resp.Body.Close()
+	r, err := decodeSearch(&sizeLimitReader{r: resp.Body, n: maxSearchResponseSize}, func(RawTender) error { return nil })
+	if err != nil {
+		return fmt.Errorf("checking the status filter: decoding search response: %w", err)
+	}
+	if total <= r.Total {
+		return fmt.Errorf("status filter didn't apply: all statuses listed %d tenders, no more than the %d of the default view", total, r.Total)
+	}
+	return nil
+}
+
+// sizeLimitReader reads from r until n bytes have been read, after which
+// it fails with errSearchResponseTooLarge.
+type sizeLimitReader struct {
+	r io.Reader
+	n int64
+}
+
+func (l *sizeLimitReader) Read(p []byte) (int, error) {
+	if l.n <= 0 {
+		return 0, errSearchResponseTooLarge
+	}
+	if int64(len(p)) > l.n {
+		p = p[:l.n]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	return n, err
+}
+
+func directGet(ctx context.Context, hc *http.Client, u string) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", u, resp.Status)
+	}
+	return nil
+}
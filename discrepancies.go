@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+// discrepancy is a tender seen by scraping or in alert emails but not the
+// other.
+type discrepancy struct {
+	TenderID    string
+	Description string
+	Agency      string
+	// Seen is when it was first seen by the one that did.
+	Seen time.Time
+	// MissedBy is what didn't see it: scraping or alert emails.
+	MissedBy string
+}
+
+// discrepancies returns the tenders first seen between from and to that
+// scraping or alert emails saw but the other hasn't, as of now. Only
+// agencies whose alert emails have come in at all are expected to be in
+// them, so scraped tenders from other agencies aren't listed.
+func (s store) discrepancies(from, to time.Time) ([]discrepancy, error) {
+	rows, err := s.db.Query(`select t.id, t.description, t.agency, a.first_received, 'scraping'
+		from alert_sightings a
+		join tenders t on t.id = a.tender_id
+		where datetime(a.first_received) >= datetime(?) and datetime(a.first_received) < datetime(?)
+		and t.id not in (select tender_id from tender_snapshots)
+		union all
+		select t.id, t.description, t.agency, t.first_observed, 'alert emails'
+		from tenders t
+		where datetime(t.first_observed) >= datetime(?) and datetime(t.first_observed) < datetime(?)
+		and t.id in (select tender_id from tender_snapshots)
+		and t.id not in (select tender_id from alert_sightings)
+		and t.agency in (select distinct t.agency from alert_sightings a join tenders t on t.id = a.tender_id)
+		order by 5, 4, 1`, from, to, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []discrepancy
+	for rows.Next() {
+		var d discrepancy
+		if err := rows.Scan(&d.TenderID, &d.Description, &d.Agency, &d.Seen, &d.MissedBy); err != nil {
+			return nil, err
+		}
+		res = append(res, d)
+	}
+	return res, rows.Err()
+}
+
+// printDiscrepancies writes ds to w, one per line, or that there are none.
+func printDiscrepancies(w io.Writer, ds []discrepancy, from, to time.Time) error {
+	if len(ds) == 0 {
+		_, err := fmt.Fprintf(w, "scraping and alert emails agree on tenders first seen from %s to %s\n", from.Format(time.RFC3339), to.Format(time.RFC3339))
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "MISSED BY\tID\tFIRST SEEN\tAGENCY\tDESCRIPTION")
+	for _, d := range ds {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", d.MissedBy, d.TenderID, d.Seen.Format(time.RFC3339), d.Agency, d.Description)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// dkimSigner produces DKIM-Signature header values (RFC 6376) using
+// relaxed/relaxed canonicalization.
+type dkimSigner struct {
+	domain   string
+	selector string
+	key      crypto.Signer
+}
+
+func loadDKIMSigner(keyFile, domain, selector string) (*dkimSigner, error) {
+	b, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data in %s", keyFile)
+	}
+
+	var key any
+	if block.Type == "RSA PRIVATE KEY" {
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	} else {
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", keyFile, err)
+	}
+
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return &dkimSigner{domain: domain, selector: selector, key: k}, nil
+	case ed25519.PrivateKey:
+		return &dkimSigner{domain: domain, selector: selector, key: k}, nil
+	}
+	return nil, fmt.Errorf("unsupported DKIM key type %T", key)
+}
+
+func (s *dkimSigner) sign(hdrs []header, body []byte) (string, error) {
+	algo := "rsa-sha256"
+	if _, ok := s.key.(ed25519.PrivateKey); ok {
+		algo = "ed25519-sha256"
+	}
+
+	var names []string
+	for _, h := range hdrs {
+		names = append(names, strings.ToLower(h.name))
+	}
+
+	bh := sha256.Sum256(relaxedBody(body))
+	sig := fmt.Sprintf("v=1; a=%s; c=relaxed/relaxed; d=%s; s=%s; t=%d; h=%s; bh=%s; b=",
+		algo, s.domain, s.selector, time.Now().Unix(), strings.Join(names, ":"), base64.StdEncoding.EncodeToString(bh[:]))
+
+	var data strings.Builder
+	for _, h := range hdrs {
+		data.WriteString(relaxedHeader(h.name, h.value) + "\r\n")
+	}
+	data.WriteString(relaxedHeader("DKIM-Signature", sig))
+	hash := sha256.Sum256([]byte(data.String()))
+
+	var b []byte
+	var err error
+	switch k := s.key.(type) {
+	case *rsa.PrivateKey:
+		b, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, hash[:])
+	case ed25519.PrivateKey:
+		b = ed25519.Sign(k, hash[:])
+	default:
+		err = errors.New("unsupported key")
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return sig + base64.StdEncoding.EncodeToString(b), nil
+}
+
+var wspRe = regexp.MustCompile(`[ \t]+`)
+
+func relaxedHeader(name, value string) string {
+	value = strings.ReplaceAll(value, "\r\n", "")
+	value = wspRe.ReplaceAllString(value, " ")
+	return strings.ToLower(strings.TrimSpace(name)) + ":" + strings.TrimSpace(value)
+}
+
+func relaxedBody(body []byte) []byte {
+	lines := strings.Split(string(body), "\r\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimRight(wspRe.ReplaceAllString(l, " "), " ")
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(lines, "\r\n") + "\r\n")
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The message, key and signature from RFC 8463 appendix A, signed with
+// ed25519-sha256 and relaxed/relaxed canonicalization.
+const (
+	rfc8463Seed   = "nWGxne/9WmC6hEr0kuwsxERJxWl7MmkZcDusAxyuf2A="
+	rfc8463Public = "11qYAYKxCrfVS/7TyWQHOg7hcvPapiMlrwIaaPcHURo="
+	rfc8463Body   = "Hi.\r\n\r\nWe lost the game.  Are you hungry yet?\r\n\r\nJoe.\r\n"
+	rfc8463Sig    = "v=1; a=ed25519-sha256; c=relaxed/relaxed;\r\n" +
+		" d=football.example.com; i=@football.example.com;\r\n" +
+		" q=dns/txt; s=brisbane; t=1528637909; h=from : to :\r\n" +
+		" subject : date : message-id : from : subject : date;\r\n" +
+		" bh=2jUSOH9NhtVGCQWNr9BrIAPreKQjO6Sn7XIkfJVOzv8=;\r\n" +
+		" b=/gCrinpcQOoIfuHNQIbq4pgh9kyIK3AQUdt9OdqQehSwhEIug4D11Bus\r\n" +
+		" Fa3bT3FY5OsU7ZbnKELq+eXdp1Q1Dw=="
+)
+
+var rfc8463Headers = []header{
+	{"From", "Joe SixPack <joe@football.example.com>"},
+	{"To", "Suzie Q <suzie@shopping.example.net>"},
+	{"Subject", "Is dinner ready?"},
+	{"Date", "Fri, 11 Jul 2003 21:00:37 -0700 (PDT)"},
+	{"Message-ID", "<20030712040037.46341.5F8J@football.example.com>"},
+}
+
+// verifyDKIM checks the DKIM-Signature value sig over hdrs and body with
+// pub, as a receiver would.
+func verifyDKIM(pub crypto.PublicKey, sig string, hdrs []header, body []byte) error {
+	tags := make(map[string]string)
+	for _, tag := range strings.Split(sig, ";") {
+		k, v, _ := strings.Cut(tag, "=")
+		tags[strings.TrimSpace(k)] = strings.Join(strings.Fields(v), "")
+	}
+	if tags["c"] != "relaxed/relaxed" {
+		return fmt.Errorf("canonicalization %q", tags["c"])
+	}
+
+	bh := sha256.Sum256(relaxedBody(body))
+	if got := base64.StdEncoding.EncodeToString(bh[:]); got != tags["bh"] {
+		return fmt.Errorf("body hash %s, signature has %s", got, tags["bh"])
+	}
+
+	// Each name in h takes the next instance of the header, from the
+	// bottom. Names with none left, to prevent adding them, sign nothing.
+	var data strings.Builder
+	used := make(map[int]bool)
+	for _, name := range strings.Split(tags["h"], ":") {
+		for i := len(hdrs) - 1; i >= 0; i-- {
+			if !used[i] && strings.EqualFold(hdrs[i].name, name) {
+				used[i] = true
+				data.WriteString(relaxedHeader(hdrs[i].name, hdrs[i].value) + "\r\n")
+				break
+			}
+		}
+	}
+	// b= is the last tag, and signs the rest of the header without its
+	// value.
+	data.WriteString(relaxedHeader("DKIM-Signature", sig[:strings.LastIndex(sig, "b=")+2]))
+	hash := sha256.Sum256([]byte(data.String()))
+
+	b, err := base64.StdEncoding.DecodeString(tags["b"])
+	if err != nil {
+		return err
+	}
+	switch k := pub.(type) {
+	case ed25519.PublicKey:
+		if tags["a"] != "ed25519-sha256" {
+			return fmt.Errorf("algorithm %q for an ed25519 key", tags["a"])
+		}
+		if !ed25519.Verify(k, hash[:], b) {
+			return fmt.Errorf("bad signature")
+		}
+		return nil
+	case *rsa.PublicKey:
+		if tags["a"] != "rsa-sha256" {
+			return fmt.Errorf("algorithm %q for an rsa key", tags["a"])
+		}
+		return rsa.VerifyPKCS1v15(k, crypto.SHA256, hash[:], b)
+	}
+	return fmt.Errorf("unsupported key %T", pub)
+}
+
+func rfc8463Key(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+	seed, err := base64.StdEncoding.DecodeString(rfc8463Seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := ed25519.NewKeyFromSeed(seed)
+	if got := base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey)); got != rfc8463Public {
+		t.Fatalf("public key %s, want %s", got, rfc8463Public)
+	}
+	return key
+}
+
+// TestDKIMFixture checks the canonicalization against the RFC's signed
+// message.
+func TestDKIMFixture(t *testing.T) {
+	key := rfc8463Key(t)
+	if err := verifyDKIM(key.Public(), rfc8463Sig, rfc8463Headers, []byte(rfc8463Body)); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyDKIM(key.Public(), rfc8463Sig, rfc8463Headers, []byte(rfc8463Body+"P.S.\r\n")); err == nil {
+		t.Error("verified with a changed body")
+	}
+	changed := append([]header(nil), rfc8463Headers...)
+	changed[2].value = "Is lunch ready?"
+	if err := verifyDKIM(key.Public(), rfc8463Sig, changed, []byte(rfc8463Body)); err == nil {
+		t.Error("verified with a changed subject")
+	}
+}
+
+func TestDKIMSign(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		name  string
+		key   crypto.Signer
+		pkcs1 bool
+	}{
+		{"ed25519", rfc8463Key(t), false},
+		{"rsa pkcs8", rsaKey, false},
+		{"rsa pkcs1", rsaKey, true},
+	} {
+		block := &pem.Block{Type: "PRIVATE KEY"}
+		if tt.pkcs1 {
+			block = &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(tt.key.(*rsa.PrivateKey))}
+		} else if block.Bytes, err = x509.MarshalPKCS8PrivateKey(tt.key); err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(t.TempDir(), "key.pem")
+		if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		s, err := loadDKIMSigner(path, "football.example.com", "brisbane")
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+
+		sig, err := s.sign(rfc8463Headers, []byte(rfc8463Body))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		for _, want := range []string{"d=football.example.com;", "s=brisbane;", "h=from:to:subject:date:message-id;", "bh=2jUSOH9NhtVGCQWNr9BrIAPreKQjO6Sn7XIkfJVOzv8=;"} {
+			if !strings.Contains(sig, want) {
+				t.Errorf("%s: signature %q lacks %q", tt.name, sig, want)
+			}
+		}
+		if err := verifyDKIM(tt.key.Public(), sig, rfc8463Headers, []byte(rfc8463Body)); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+	}
+}
+
+func TestRelaxedCanonicalization(t *testing.T) {
+	// The examples from RFC 6376 section 3.4.6.
+	for _, tt := range []struct {
+		name, value, want string
+	}{
+		{"A", "X", "a:X"},
+		{"B ", " Y\t\r\n\tZ  ", "b:Y Z"},
+	} {
+		if got := relaxedHeader(tt.name, tt.value); got != tt.want {
+			t.Errorf("relaxedHeader(%q, %q) = %q, want %q", tt.name, tt.value, got, tt.want)
+		}
+	}
+	for _, tt := range []struct {
+		body, want string
+	}{
+		{" C \r\nD \t E\r\n\r\n\r\n", " C\r\nD E\r\n"},
+		{"", ""},
+		{"\r\n\r\n", ""},
+		{"no newline", "no newline\r\n"},
+	} {
+		if got := string(relaxedBody([]byte(tt.body))); got != tt.want {
+			t.Errorf("relaxedBody(%q) = %q, want %q", tt.body, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// docStore keeps tender documents on disk by content hash, so the same
+// file attached to several tenders, or re-fetched unchanged, is stored
+// once. The blobs table counts references to each file and the documents
+// table records each version of each named document per tender.
+type docStore struct {
+	dir        string
+	st         store
+	extractors extractors
+	// alertKeywords are checked against the text of new documents for
+	// watched tenders.
+	alertKeywords []string
+}
+
+type document struct {
+	TenderID string
+	Name     string
+	Version  int
+	Hash     string
+	Size     int64
+	Stored   time.Time
+}
+
+func (d docStore) path(hash string) string {
+	return filepath.Join(d.dir, "sha256", hash[:2], hash[2:])
+}
+
+// put stores the contents of r as the latest version of the document name
+// for tenderID. It reports whether that created a new version, which is the
+// case unless the contents are unchanged from the previous version.
+func (d docStore) put(tenderID, name string, r io.Reader) (document, bool, error) {
+	if err := os.MkdirAll(d.dir, 0o755); err != nil {
+		return document{}, false, err
+	}
+	tmp, err := os.CreateTemp(d.dir, ".incoming-")
+	if err != nil {
+		return document{}, false, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), r)
+	if err != nil {
+		return document{}, false, fmt.Errorf("writing %s: %w", name, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return document{}, false, err
+	}
+	hash := hex.EncodeToString(h.Sum(nil))
+
+	var prev document
+	err = d.st.db.QueryRow("select version, hash from documents where tender_id = ? and name = ? order by version desc limit 1", tenderID, name).Scan(&prev.Version, &prev.Hash)
+	if err != nil && err != sql.ErrNoRows {
+		return document{}, false, err
+	}
+	if prev.Hash == hash {
+		prev.TenderID, prev.Name, prev.Size = tenderID, name, size
+		return prev, false, nil
+	}
+
+	p := d.path(hash)
+	if _, err := os.Stat(p); os.IsNotExist(err) {
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			return document{}, false, err
+		}
+		if err := os.Rename(tmp.Name(), p); err != nil {
+			return document{}, false, err
+		}
+	} else if err != nil {
+		return document{}, false, err
+	}
+
+	doc := document{TenderID: tenderID, Name: name, Version: prev.Version + 1, Hash: hash, Size: size, Stored: time.Now()}
+
+	tx, err := d.st.db.Begin()
+	if err != nil {
+		return document{}, false, err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("insert into blobs (hash, size, refs) values (?, ?, 1) on conflict (hash) do update set refs = refs + 1", hash, size); err != nil {
+		return document{}, false, fmt.Errorf("insert blob: %v", err)
+	}
+	if _, err := tx.Exec("insert into documents (tender_id, name, version, hash, stored) values (?, ?, ?, ?, ?)", doc.TenderID, doc.Name, doc.Version, doc.Hash, doc.Stored); err != nil {
+		return document{}, false, fmt.Errorf("insert document: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return document{}, false, err
+	}
+
+	return doc, true, nil
+}
+
+// index extracts the text of doc into the document_text full text index.
+// Documents of types without an extractor are skipped.
+func (d docStore) index(doc document) error {
+	text, err := d.extractors.extract(d.path(doc.Hash), doc.Name)
+	if errors.Is(err, errNoExtractor) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("extracting text from %s: %w", doc.Name, err)
+	}
+	_, err = d.st.db.Exec("insert into document_text (tender_id, name, version, text) values (?, ?, ?, ?)", doc.TenderID, doc.Name, doc.Version, text)
+	if err != nil {
+		return fmt.Errorf("insert document text: %v", err)
+	}
+	alerts, err := d.st.checkDocumentAlerts(doc, text, d.alertKeywords)
+	if err != nil {
+		return err
+	}
+	for _, a := range alerts {
+		slog.Info("watched tender document mentions keyword", "tender", a.TenderID, "document", a.Name, "keyword", a.Keyword)
+	}
+	return nil
+}
+
+type documentMatch struct {
+	TenderID string
+	Name     string
+	Version  int
+	Snippet  string
+}
+
+// search returns documents whose text matches the FTS5 query q, best
+// matches first.
+func (d docStore) search(q string) ([]documentMatch, error) {
+	rows, err := d.st.db.Query("select tender_id, name, version, snippet(document_text, 3, '[', ']', '...', 12) from document_text where document_text match ? order by rank", q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []documentMatch
+	for rows.Next() {
+		var m documentMatch
+		if err := rows.Scan(&m.TenderID, &m.Name, &m.Version, &m.Snippet); err != nil {
+			return nil, err
+		}
+		res = append(res, m)
+	}
+	return res, rows.Err()
+}
+
+// documents returns every version of every document stored for tenderID.
+func (d docStore) documents(tenderID string) ([]document, error) {
+	rows, err := d.st.db.Query("select d.name, d.version, d.hash, b.size, d.stored from documents d join blobs b on b.hash = d.hash where d.tender_id = ? order by d.name, d.version", tenderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var docs []document
+	for rows.Next() {
+		doc := document{TenderID: tenderID}
+		if err := rows.Scan(&doc.Name, &doc.Version, &doc.Hash, &doc.Size, &doc.Stored); err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	return docs, rows.Err()
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// printProvider is an emailProvider that writes messages to w instead of
+// sending them, for notify -dry-run.
+type printProvider struct {
+	w io.Writer
+}
+
+func (p printProvider) send(_ context.Context, m message) error {
+	fmt.Fprintf(p.w, "From: %s\n", m.from)
+	for _, a := range m.bcc {
+		fmt.Fprintf(p.w, "Bcc: %s\n", a)
+	}
+	fmt.Fprintf(p.w, "Subject: %s\n", m.subject)
+	for _, i := range m.inline {
+		fmt.Fprintf(p.w, "Inline: %s (%s, %d bytes)\n", i.cid, i.contentType, len(i.data))
+	}
+	for _, a := range m.attachments {
+		fmt.Fprintf(p.w, "Attachment: %s (%s, %d bytes)\n", a.filename, a.contentType, len(a.data))
+	}
+	fmt.Fprintf(p.w, "\n%s\n", m.html)
+	if m.text != "" {
+		fmt.Fprintf(p.w, "\n%s\n", m.text)
+	}
+	return nil
+}
+
+// printGateway is an smsGateway and voiceGateway that writes texts and
+// calls to w instead of sending or placing them.
+type printGateway struct {
+	w io.Writer
+}
+
+func (g printGateway) sendSMS(_ context.Context, to, body string) error {
+	fmt.Fprintf(g.w, "SMS to %s:\n%s\n\n", to, body)
+	return nil
+}
+
+func (g printGateway) call(_ context.Context, to, message string) error {
+	fmt.Fprintf(g.w, "Call to %s:\n%s\n\n", to, message)
+	return nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/playwright-community/playwright-go"
+)
+
+// egress controls how the browser reaches the portal, for when the
+// machine's own address gets blocked and requests need to go out another
+// way, such as through a SOCKS proxy on a home connection.
+type egress struct {
+	// proxy is an http://, https:// or socks5:// proxy URL.
+	proxy string
+	// resolve maps host names to the addresses to connect to instead of
+	// what DNS says. An IPv6 address selects IPv6 egress for that host.
+	resolve map[string]string
+}
+
+func (e *egress) setProxy(s string) error {
+	u, err := url.Parse(s)
+	if err != nil {
+		return err
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return fmt.Errorf("unsupported proxy scheme %q, want http, https or socks5", u.Scheme)
+	}
+	e.proxy = s
+	return nil
+}
+
+// addResolve parses a host=address override.
+func (e *egress) addResolve(s string) error {
+	host, addr, ok := strings.Cut(s, "=")
+	if !ok || host == "" {
+		return fmt.Errorf("want host=address, got %q", s)
+	}
+	if net.ParseIP(addr) == nil {
+		return fmt.Errorf("%q is not an IP address", addr)
+	}
+	if e.resolve == nil {
+		e.resolve = make(map[string]string)
+	}
+	e.resolve[host] = addr
+	return nil
+}
+
+func (e egress) launchOptions() playwright.BrowserTypeLaunchOptions {
+	var opts playwright.BrowserTypeLaunchOptions
+	if e.proxy != "" {
+		u, _ := url.Parse(e.proxy)
+		p := &playwright.Proxy{Server: u.Scheme + "://" + u.Host}
+		if u.User != nil {
+			p.Username = ptr(u.User.Username())
+			if pw, ok := u.User.Password(); ok {
+				p.Password = ptr(pw)
+			}
+		}
+		opts.Proxy = p
+	}
+	if len(e.resolve) > 0 {
+		var rules []string
+		for host, addr := range e.resolve {
+			if strings.Contains(addr, ":") {
+				addr = "[" + addr + "]"
+			}
+			rules = append(rules, "MAP "+host+" "+addr)
+		}
+		sort.Strings(rules)
+		opts.Args = []string{"--host-resolver-rules=" + strings.Join(rules, ",")}
+	}
+	return opts
+}
+
+// httpClient returns an HTTP client that goes out the same way the
+// browser does.
+func (e egress) httpClient() *http.Client {
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	if e.proxy != "" {
+		u, _ := url.Parse(e.proxy)
+		tr.Proxy = http.ProxyURL(u)
+	}
+	if len(e.resolve) > 0 {
+		var d net.Dialer
+		tr.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			host, port, err := net.SplitHostPort(addr)
+			if err != nil {
+				return nil, err
+			}
+			if ip, ok := e.resolve[host]; ok {
+				addr = net.JoinHostPort(ip, port)
+			}
+			return d.DialContext(ctx, network, addr)
+		}
+	}
+	return &http.Client{Transport: tr}
+}
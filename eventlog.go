@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// eventLog appends pipeline events to a JSON lines file, for tools to tail
+// and to rebuild the store from if it comes to that. When the file grows
+// past maxSize it's rotated to path.1, path.1 to path.2 and so on, keeping
+// keep old files. A nil *eventLog discards events.
+type eventLog struct {
+	path    string
+	maxSize int64
+	keep    int
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+// event is a line of the event log.
+type event struct {
+	Time     time.Time `json:"time"`
+	Type     string    `json:"type"`
+	TenderID string    `json:"tender_id,omitempty"`
+	Data     any       `json:"data,omitempty"`
+}
+
+// openEventLog opens the event log at path for appending.
+func openEventLog(path string, maxSize int64, keep int) (*eventLog, error) {
+	l := &eventLog{path: path, maxSize: maxSize, keep: keep}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *eventLog) open() error {
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	l.f, l.size = f, fi.Size()
+	return nil
+}
+
+// emit appends an event of typ about the tender with tenderID, if any,
+// with data. Failing to write is logged rather than failing what's being
+// logged.
+func (l *eventLog) emit(typ, tenderID string, data any) {
+	if l == nil {
+		return
+	}
+	b, err := json.Marshal(event{Time: time.Now().UTC(), Type: typ, TenderID: tenderID, Data: data})
+	if err != nil {
+		slog.Error("encoding event", "type", typ, "err", err)
+		return
+	}
+	b = append(b, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.maxSize > 0 && l.size > 0 && l.size+int64(len(b)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			slog.Error("rotating event log", "err", err)
+		}
+	}
+	if l.f == nil {
+		return
+	}
+	n, err := l.f.Write(b)
+	l.size += int64(n)
+	if err != nil {
+		slog.Error("writing event", "type", typ, "err", err)
+	}
+}
+
+func (l *eventLog) rotate() error {
+	if err := l.f.Close(); err != nil {
+		return err
+	}
+	l.f = nil
+	os.Remove(fmt.Sprintf("%s.%d", l.path, l.keep))
+	for i := l.keep - 1; i >= 1; i-- {
+		if err := os.Rename(fmt.Sprintf("%s.%d", l.path, i), fmt.Sprintf("%s.%d", l.path, i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if l.keep > 0 {
+		if err := os.Rename(l.path, l.path+".1"); err != nil {
+			return err
+		}
+	} else if err := os.Remove(l.path); err != nil {
+		return err
+	}
+	return l.open()
+}
+
+func (l *eventLog) Close() error {
+	if l == nil || l.f == nil {
+		return nil
+	}
+	return l.f.Close()
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// tenderEvent is a dated event or deadline bidders need to meet before a
+// tender closes, such as a site visit or the deadline for questions.
+type tenderEvent struct {
+	Kind string
+	// At is the wall clock time given in the scope, in UTC since the
+	// scope doesn't say its zone.
+	At        time.Time
+	Mandatory bool
+}
+
+var (
+	eventRe = regexp.MustCompile(`(?i)\b(?:(site\s+(?:visit|meeting|tour|walk-?through))|(pre-?(?:bid|tender|proposal|submission)\s+(?:meeting|conference|session))|((?:deadline|last day|cut-?off)\s+(?:date\s+)?for\s+(?:questions|inquiries|enquiries)|(?:questions|inquiries|enquiries)\s+(?:deadline|cut-?off|must be (?:received|submitted)|(?:are|will be accepted until|shall be submitted)\b)))`)
+	// eventDateRe matches dates like "Thursday, November 14, 2024 at
+	// 10:00 a.m." or "Nov 14 2024, 2 PM", with the time optional.
+	eventDateRe = regexp.MustCompile(`(?i)\b(jan|feb|mar|apr|may|jun|jul|aug|sep|sept|oct|nov|dec)[a-z]*\.?\s+(\d{1,2})(?:st|nd|rd|th)?,?\s+(\d{4})(?:\s*(?:at|@|,|-)?\s*(\d{1,2})(?::(\d{2}))?\s*([ap])\.?\s*m\b\.?)?`)
+	mandatoryRe = regexp.MustCompile(`(?i)\b(?:mandatory|compulsory|required)\b`)
+)
+
+// questionDeadline is the kind of event for the last day bidders can ask
+// questions, which is often the real first deadline for a tender.
+const questionDeadline = "question deadline"
+
+var eventMonths = map[string]time.Month{
+	"jan": time.January, "feb": time.February, "mar": time.March, "apr": time.April,
+	"may": time.May, "jun": time.June, "jul": time.July, "aug": time.August,
+	"sep": time.September, "sept": time.September, "oct": time.October, "nov": time.November, "dec": time.December,
+}
+
+// detectEvents finds site visits and pre-bid meetings mentioned in text
+// along with the first date following each mention.
+func detectEvents(text string) []tenderEvent {
+	var events []tenderEvent
+	for _, loc := range eventRe.FindAllStringSubmatchIndex(text, -1) {
+		kind := "pre-bid meeting"
+		switch {
+		case loc[2] >= 0:
+			kind = "site visit"
+		case loc[6] >= 0:
+			kind = questionDeadline
+		}
+
+		// Look for the date in the rest of the sentence-ish window after
+		// the mention.
+		rest := text[loc[1]:min(len(text), loc[1]+200)]
+		dm := eventDateRe.FindStringSubmatch(rest)
+		if dm == nil {
+			continue
+		}
+		at, err := parseEventDate(dm)
+		if err != nil {
+			continue
+		}
+
+		before := text[max(0, loc[0]-40):loc[0]]
+		if i := strings.LastIndexAny(before, ".\n"); i >= 0 {
+			before = before[i+1:]
+		}
+		ev := tenderEvent{Kind: kind, At: at}
+		if kind != questionDeadline {
+			ev.Mandatory = mandatoryRe.MatchString(before + text[loc[0]:loc[1]+len(dm[0])])
+		}
+
+		dup := false
+		for _, e := range events {
+			if e.Kind == ev.Kind && e.At.Equal(ev.At) {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			events = append(events, ev)
+		}
+	}
+	return events
+}
+
+func parseEventDate(m []string) (time.Time, error) {
+	month, ok := eventMonths[strings.ToLower(m[1])]
+	if !ok {
+		return time.Time{}, fmt.Errorf("unknown month %q", m[1])
+	}
+	day, _ := strconv.Atoi(m[2])
+	year, _ := strconv.Atoi(m[3])
+	var hour, minute int
+	if m[4] != "" {
+		hour, _ = strconv.Atoi(m[4])
+		minute, _ = strconv.Atoi(m[5])
+		if strings.EqualFold(m[6], "p") && hour < 12 {
+			hour += 12
+		} else if strings.EqualFold(m[6], "a") && hour == 12 {
+			hour = 0
+		}
+	}
+	t := time.Date(year, month, day, hour, minute, 0, 0, time.UTC)
+	if t.Day() != day {
+		return time.Time{}, fmt.Errorf("invalid date %q", m[0])
+	}
+	return t, nil
+}
+
+func (e tenderEvent) String() string {
+	s := e.Kind
+	if e.Mandatory {
+		s = "mandatory " + s
+	}
+	layout := "Mon, 02 Jan 2006 15:04"
+	if e.At.Hour() == 0 && e.At.Minute() == 0 {
+		layout = "Mon, 02 Jan 2006"
+	}
+	return s + " " + e.At.Format(layout)
+}
+
+func (s store) addEvents(tenderID string, events []tenderEvent) error {
+	for _, e := range events {
+		_, err := s.db.Exec("insert into tender_events (tender_id, kind, at, mandatory) values (?, ?, ?, ?) on conflict do nothing",
+			tenderID, e.Kind, e.At, e.Mandatory,
+		)
+		if err != nil {
+			return fmt.Errorf("insert event: %v", err)
+		}
+	}
+	return nil
+}
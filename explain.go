@@ -0,0 +1,179 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// explain writes to w why the tender with id was or would be notified
+// about: whether it's been dealt with, which filters pass or leave it out,
+// which saved searches it matches, and which channels it went out on or
+// would go out on. Filters are named by the flags that set them and saved
+// searches by their IDs.
+func (d *digester) explain(w io.Writer, st store, id string) error {
+	t, err := st.archivedTender(id)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("no tender %s", id)
+	}
+	if err != nil {
+		return err
+	}
+	if err := st.loadDetails(&t.Tender); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "%s %s\n", t.ID, t.Description)
+	fmt.Fprintf(w, "%s, closes %s, first seen %s\n\n", t.Agency, t.CloseDate.Format(dateFormat), t.FirstObserved.Format(time.RFC3339))
+
+	notified, err := st.tenderNotified(t.ID)
+	if err != nil {
+		return err
+	}
+	retracted, err := st.retraction(t.ID)
+	if err != nil {
+		return err
+	}
+	switch {
+	case retracted != nil:
+		fmt.Fprintf(w, "Retracted %s, %s, so it isn't announced.\n", retracted.At.Format(time.RFC3339), retracted.Reason)
+	case !notified.IsZero():
+		fmt.Fprintf(w, "Dealt with %s.\n", notified.Format(time.RFC3339))
+	default:
+		fmt.Fprintf(w, "Pending, to go out on the next run.\n")
+	}
+
+	fmt.Fprintf(w, "\nFilters:\n")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	excluded := false
+	filter := func(rule, why string, set bool) {
+		switch {
+		case !set:
+			fmt.Fprintf(tw, "  %s\tnot set\n", rule)
+		case why != "":
+			fmt.Fprintf(tw, "  %s\tleaves it out, %s\n", rule, why)
+			excluded = true
+		default:
+			fmt.Fprintf(tw, "  %s\tpasses\n", rule)
+		}
+	}
+	filter("-max-bid-security, -max-bid-security-percent", bidSecurityExclusion(t.Tender, d.maxBidSecurity, d.maxBidSecurityPercent), d.maxBidSecurity > 0 || d.maxBidSecurityPercent > 0)
+	filter("-skip-local-only, -require-agreement", tradeTermsExclusion(t.Tender, d.skipLocalOnly, d.agreements), d.skipLocalOnly || len(d.agreements) > 0)
+	filter("-unspsc", unspscExclusion(t.Tender, d.unspscPrefixes), len(d.unspscPrefixes) > 0)
+	filter("-include, -exclude", d.keywords.exclusion(t.Tender), !d.keywords.empty())
+	subs, err := d.subscribers(st)
+	if err != nil {
+		return err
+	}
+	for _, sub := range subs {
+		f := sub.filter()
+		if f.empty() {
+			continue
+		}
+		if why := f.exclusion(t.Tender); why != "" {
+			fmt.Fprintf(tw, "  subscriber %s %s\tleaves it out of what they're sent, %s\n", sub.Channel, sub.Target, why)
+		} else {
+			fmt.Fprintf(tw, "  subscriber %s %s\tpasses\n", sub.Channel, sub.Target)
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	searches, err := st.savedSearches()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "\nSaved searches:\n")
+	if len(searches) == 0 {
+		fmt.Fprintf(w, "  none\n")
+	}
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	var matched []savedSearch
+	for _, ss := range searches {
+		if !ss.matches(t.Tender) {
+			fmt.Fprintf(tw, "  #%d %s\tdoesn't match %q\n", ss.ID, ss.Name, ss.Query)
+			continue
+		}
+		matched = append(matched, ss)
+		var subs []string
+		for _, sub := range ss.Subscriptions {
+			subs = append(subs, sub.Channel+" "+sub.Target)
+		}
+		to := "no subscribers"
+		if len(subs) > 0 {
+			to = "to " + strings.Join(subs, ", ")
+		}
+		fmt.Fprintf(tw, "  #%d %s\tmatches %q, %s\n", ss.ID, ss.Name, ss.Query, to)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "\nChannels:\n")
+	ds, err := st.tenderDeliveries(t.ID)
+	if err != nil {
+		return err
+	}
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, dl := range ds {
+		result := "delivered"
+		if dl.Error != "" {
+			result = "failed: " + dl.Error
+		}
+		fmt.Fprintf(tw, "  %s\t%s\t%s\n", dl.Channel, dl.At.Format(time.RFC3339), result)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if !notified.IsZero() || retracted != nil {
+		if len(ds) == 0 {
+			fmt.Fprintf(w, "  not sent on any channel\n")
+		}
+		return nil
+	}
+	if excluded {
+		fmt.Fprintf(w, "  none, since a filter leaves it out\n")
+		return nil
+	}
+	var names []string
+	for _, sub := range subs {
+		if sub.Channel == "email" && d.email == nil {
+			continue
+		}
+		if sub.filter().exclusion(t.Tender) == "" {
+			names = append(names, fmt.Sprintf("%s to %s", sub.Channel, sub.Target))
+		}
+	}
+	for _, ch := range d.others {
+		names = append(names, ch.name())
+	}
+	for _, ss := range matched {
+		for _, sub := range ss.Subscriptions {
+			if s := fmt.Sprintf("%s to %s for #%d", sub.Channel, sub.Target, ss.ID); !slices.Contains(names, s) {
+				names = append(names, s)
+			}
+		}
+	}
+	if len(names) == 0 {
+		fmt.Fprintf(w, "  none configured\n")
+	}
+	for _, n := range names {
+		fmt.Fprintf(w, "  would go out by %s\n", n)
+	}
+	return nil
+}
+
+// tenderNotified returns when the tender with id was dealt with, or the
+// zero time if it hasn't been.
+func (s store) tenderNotified(tenderID string) (time.Time, error) {
+	var at time.Time
+	err := s.db.QueryRow("select at from notified_tenders where tender_id = ?", tenderID).Scan(&at)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	return at, err
+}
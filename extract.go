@@ -0,0 +1,150 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// textExtractor pulls plain text out of a document file.
+type textExtractor interface {
+	extractText(path string) (string, error)
+}
+
+// errNoExtractor is returned for documents whose type has no extractor.
+var errNoExtractor = errors.New("no text extractor for document type")
+
+// extractors picks a textExtractor by lower case file extension,
+// including the dot.
+type extractors map[string]textExtractor
+
+func defaultExtractors() extractors {
+	return extractors{
+		".txt":  plainTextExtractor{},
+		".docx": docxExtractor{},
+		".pdf":  commandExtractor{"pdftotext", "-q", "{}", "-"},
+	}
+}
+
+// Set implements flag.Value, taking ext=command, where {} in command is
+// replaced by the document's path. An empty command removes the extractor.
+func (e extractors) Set(s string) error {
+	ext, cmd, ok := strings.Cut(s, "=")
+	if !ok || !strings.HasPrefix(ext, ".") {
+		return fmt.Errorf("want .ext=command, got %q", s)
+	}
+	ext = strings.ToLower(ext)
+	if f := strings.Fields(cmd); len(f) > 0 {
+		e[ext] = commandExtractor(f)
+	} else {
+		delete(e, ext)
+	}
+	return nil
+}
+
+func (e extractors) String() string {
+	var s []string
+	for ext, x := range e {
+		if c, ok := x.(commandExtractor); ok {
+			s = append(s, ext+"="+strings.Join(c, " "))
+		}
+	}
+	return strings.Join(s, ",")
+}
+
+// extract extracts text from the file at path, picking the extractor by the
+// extension of name.
+func (e extractors) extract(path, name string) (string, error) {
+	x, ok := e[strings.ToLower(filepath.Ext(name))]
+	if !ok {
+		return "", errNoExtractor
+	}
+	return x.extractText(path)
+}
+
+type plainTextExtractor struct{}
+
+func (plainTextExtractor) extractText(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	return string(b), err
+}
+
+// docxExtractor reads the paragraphs of word/document.xml from a .docx.
+type docxExtractor struct{}
+
+func (docxExtractor) extractText(path string) (string, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return "", err
+	}
+	defer zr.Close()
+
+	f, err := zr.Open("word/document.xml")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	var b strings.Builder
+	dec := xml.NewDecoder(f)
+	inText := false
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				b.WriteString("\t")
+			case "br":
+				b.WriteString("\n")
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				b.WriteString("\n")
+			}
+		case xml.CharData:
+			if inText {
+				b.Write(t)
+			}
+		}
+	}
+	return b.String(), nil
+}
+
+// commandExtractor runs an external command such as pdftotext or an OCR
+// tool and uses its standard output. Arguments of {} are replaced by the
+// document's path.
+type commandExtractor []string
+
+func (c commandExtractor) extractText(path string) (string, error) {
+	args := make([]string, len(c)-1)
+	for i, a := range c[1:] {
+		args[i] = strings.ReplaceAll(a, "{}", path)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(c[0], args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("running %s: %w: %s", c[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+)
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomEntry struct {
+	ID      string   `xml:"id"`
+	Title   string   `xml:"title"`
+	Updated string   `xml:"updated"`
+	Link    atomLink `xml:"link"`
+	Author  string   `xml:"author>name"`
+	Summary string   `xml:"summary"`
+}
+
+// feedLimit is how many of the most recently seen tenders a feed has.
+const feedLimit = 100
+
+// writeFeed writes the most recently seen tenders to w as an Atom feed
+// titled title, with what rd redacts for the public left out. self is the
+// feed's own URL, if known.
+func writeFeed(w io.Writer, st store, title, self string, rd redactions) error {
+	ts, err := st.recentTenders(feedLimit)
+	if err != nil {
+		return err
+	}
+
+	f := atomFeed{ID: "urn:tender-digest:tenders", Title: title, Updated: time.Now().UTC().Format(time.RFC3339)}
+	if len(ts) > 0 {
+		f.Updated = ts[0].FirstObserved.UTC().Format(time.RFC3339)
+	}
+	if self != "" {
+		f.Links = append(f.Links, atomLink{Rel: "self", Href: self})
+	}
+	for _, t := range ts {
+		rd.apply("public", &t.Tender)
+		f.Entries = append(f.Entries, atomEntry{
+			ID:      t.URL,
+			Title:   t.Description,
+			Updated: t.FirstObserved.UTC().Format(time.RFC3339),
+			Link:    atomLink{Href: t.URL},
+			Author:  t.Agency,
+			Summary: fmt.Sprintf("Issued %s and closing %s.", t.IssuedDate.Format("Mon, 02 Jan 2006"), t.CloseDate.Format("Mon, 02 Jan 2006")),
+		})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(f); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+type sourceHealth struct {
+	Source       string
+	Runs         int
+	Failures     int
+	LastSuccess  time.Time
+	AvgDuration  time.Duration
+	RecentErrors []runError
+}
+
+type runError struct {
+	Started time.Time
+	Error   string
+}
+
+func (h sourceHealth) SuccessPercent() float64 {
+	if h.Runs == 0 {
+		return 0
+	}
+	return 100 * float64(h.Runs-h.Failures) / float64(h.Runs)
+}
+
+func (s store) recordRun(source string, started time.Time, dur time.Duration, l listing, rc responseCounts, newTenders int, anomaly string, runErr error) error {
+	var errText sql.NullString
+	if runErr != nil {
+		errText = sql.NullString{String: runErr.Error(), Valid: true}
+	}
+	_, err := s.db.Exec("insert into runs (source, started, duration_ms, pages, tenders, responses_dropped, responses_merged, new_tenders, anomaly, error) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		source, started, dur.Milliseconds(), l.Pages, l.Tenders, rc.Dropped, rc.Merged, newTenders, sql.NullString{String: anomaly, Valid: anomaly != ""}, errText,
+	)
+	if err != nil {
+		return fmt.Errorf("insert: %v", err)
+	}
+	return nil
+}
+
+// quietReason returns why notifications about tenders source listed
+// should be held back because the source looks newly added, or "" if
+// there's no reason to. That's the case when it has no run history, or
+// when its history starts within period of now, so what its first runs
+// list waits until it has a history to be judged on. For source "",
+// tenders whose source isn't
+// known, it's whether the store as a whole looks freshly created or
+// restored.
+func (s store) quietReason(source string, period time.Duration, now time.Time) (string, error) {
+	var first time.Time
+	var err error
+	if source == "" {
+		err = s.db.QueryRow("select started from runs order by started limit 1").Scan(&first)
+	} else {
+		err = s.db.QueryRow("select started from runs where source = ? order by started limit 1", source).Scan(&first)
+	}
+	if err == sql.ErrNoRows {
+		return "there is no run history", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if now.Sub(first) < period {
+		return "run history only starts at " + first.Format(time.RFC3339), nil
+	}
+	return "", nil
+}
+
+func (s store) sourceHealth() ([]sourceHealth, error) {
+	rows, err := s.db.Query("select source, count(*), count(error), avg(duration_ms) from runs group by source order by source")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hs []sourceHealth
+	for rows.Next() {
+		var h sourceHealth
+		var avgMS float64
+		if err := rows.Scan(&h.Source, &h.Runs, &h.Failures, &avgMS); err != nil {
+			return nil, err
+		}
+		h.AvgDuration = time.Duration(avgMS) * time.Millisecond
+		hs = append(hs, h)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i, h := range hs {
+		var last sql.NullTime
+		err := s.db.QueryRow("select started from runs where source = ? and error is null order by started desc limit 1", h.Source).Scan(&last)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, err
+		}
+		hs[i].LastSuccess = last.Time
+
+		hs[i].RecentErrors, err = s.recentErrors(h.Source, 5)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return hs, nil
+}
+
+func (s store) recentErrors(source string, limit int) ([]runError, error) {
+	rows, err := s.db.Query("select started, error from runs where source = ? and error is not null order by started desc limit ?", source, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []runError
+	for rows.Next() {
+		var re runError
+		if err := rows.Scan(&re.Started, &re.Error); err != nil {
+			return nil, err
+		}
+		res = append(res, re)
+	}
+	return res, rows.Err()
+}
+
+func printSources(w io.Writer, st store) error {
+	hs, err := st.sourceHealth()
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SOURCE\tRUNS\tSUCCESS\tLAST SUCCESS\tAVG DURATION\tLAST ERROR")
+	for _, h := range hs {
+		lastSuccess := "never"
+		if !h.LastSuccess.IsZero() {
+			lastSuccess = h.LastSuccess.Format(time.RFC3339)
+		}
+		lastError := "-"
+		if len(h.RecentErrors) > 0 {
+			lastError = h.RecentErrors[0].Error
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%.0f%%\t%s\t%s\t%s\n", h.Source, h.Runs, h.SuccessPercent(), lastSuccess, h.AvgDuration.Round(time.Second), lastError)
+	}
+	return tw.Flush()
+}
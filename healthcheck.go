@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// healthcheck is a check on a monitoring service that expects a ping for
+// each run and alerts when one is late or fails: a healthchecks.io ping
+// URL, or a Cronitor telemetry URL on cronitor.link.
+type healthcheck struct {
+	u *url.URL
+}
+
+// parseHealthcheck parses a -healthcheck-url.
+func parseHealthcheck(raw string) (*healthcheck, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	if (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, fmt.Errorf("want an http(s) URL, got %q", raw)
+	}
+	return &healthcheck{u: u}, nil
+}
+
+// healthcheckTimeout is how long a ping may take.
+const healthcheckTimeout = 10 * time.Second
+
+// start pings that a run has started, so the service can tell how long it
+// takes and alert if it never finishes. h may be nil.
+func (h *healthcheck) start() {
+	h.ping("start", "")
+}
+
+// finish pings that the run succeeded, or failed with err. h may be nil.
+func (h *healthcheck) finish(err error) {
+	if err != nil {
+		h.ping("fail", err.Error())
+		return
+	}
+	h.ping("success", "")
+}
+
+// ping sends state, one of start, success or fail, with msg. A ping that
+// fails is logged rather than failing the run.
+func (h *healthcheck) ping(state, msg string) {
+	if h == nil {
+		return
+	}
+	u := *h.u
+	if strings.HasSuffix(u.Hostname(), "cronitor.link") {
+		q := u.Query()
+		q.Set("state", map[string]string{"start": "run", "success": "complete", "fail": "fail"}[state])
+		if msg != "" {
+			q.Set("message", msg)
+		}
+		u.RawQuery = q.Encode()
+	} else if state != "success" {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/" + state
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), healthcheckTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", u.String(), strings.NewReader(msg))
+	if err != nil {
+		slog.Warn("pinging healthcheck", "state", state, "err", err)
+		return
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		// Keep the check's URL, which is as good as a password, out of logs.
+		if uerr, ok := err.(*url.Error); ok {
+			err = uerr.Err
+		}
+		slog.Warn("pinging healthcheck", "state", state, "err", err)
+		return
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		slog.Warn("pinging healthcheck", "state", state, "status", resp.Status)
+		return
+	}
+	slog.Debug("pinged healthcheck", "state", state)
+}
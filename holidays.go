@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// holidayCalendar maps dates, in dateFormat, to holiday names.
+type holidayCalendar map[string]string
+
+func (c holidayCalendar) holiday(t time.Time) (string, bool) {
+	name, ok := c[t.Format(dateFormat)]
+	return name, ok
+}
+
+// add adds the holidays from spec, which is either "ns" for the Nova
+// Scotia holidays HRM observes, or a file with a date and name per line.
+func (c holidayCalendar) add(spec string) error {
+	if spec == "ns" {
+		now := time.Now()
+		for y := now.Year() - 1; y <= now.Year()+2; y++ {
+			for d, name := range novaScotiaHolidays(y) {
+				c[d] = name
+			}
+		}
+		return nil
+	}
+
+	f, err := os.Open(spec)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		l := strings.TrimSpace(sc.Text())
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+		date, name, _ := strings.Cut(l, " ")
+		if _, err := time.Parse(dateFormat, date); err != nil {
+			return fmt.Errorf("%s:%d: %w", spec, line, err)
+		}
+		name = strings.TrimSpace(name)
+		if name == "" {
+			name = "holiday"
+		}
+		c[date] = name
+	}
+	return sc.Err()
+}
+
+// afterHoliday returns the holiday falling on the business day before t,
+// skipping back over a weekend, if there is one.
+func (c holidayCalendar) afterHoliday(t time.Time) (string, bool) {
+	d := time.Date(t.Year(), t.Month(), t.Day()-1, 0, 0, 0, 0, time.UTC)
+	for d.Weekday() == time.Saturday || d.Weekday() == time.Sunday {
+		d = d.AddDate(0, 0, -1)
+	}
+	return c.holiday(d)
+}
+
+// novaScotiaHolidays returns the Nova Scotia statutory holidays and the
+// additional days HRM closes for in year, on the days they're observed.
+func novaScotiaHolidays(year int) holidayCalendar {
+	date := func(m time.Month, d int) time.Time { return time.Date(year, m, d, 0, 0, 0, 0, time.UTC) }
+	nthMonday := func(m time.Month, n int) time.Time {
+		d := date(m, 1)
+		for d.Weekday() != time.Monday {
+			d = d.AddDate(0, 0, 1)
+		}
+		return d.AddDate(0, 0, 7*(n-1))
+	}
+	// Victoria Day is the Monday before May 25.
+	victoria := date(time.May, 24)
+	for victoria.Weekday() != time.Monday {
+		victoria = victoria.AddDate(0, 0, -1)
+	}
+
+	c := make(holidayCalendar)
+	// observe moves holidays falling on a weekend, or on a day already
+	// taken by a moved holiday, to the next weekday.
+	observe := func(d time.Time, name string) {
+		for d.Weekday() == time.Saturday || d.Weekday() == time.Sunday || c[d.Format(dateFormat)] != "" {
+			d = d.AddDate(0, 0, 1)
+		}
+		c[d.Format(dateFormat)] = name
+	}
+	observe(date(time.January, 1), "New Year's Day")
+	observe(nthMonday(time.February, 3), "Heritage Day")
+	observe(easter(year).AddDate(0, 0, -2), "Good Friday")
+	observe(victoria, "Victoria Day")
+	observe(date(time.July, 1), "Canada Day")
+	observe(nthMonday(time.August, 1), "Natal Day")
+	observe(nthMonday(time.September, 1), "Labour Day")
+	observe(date(time.September, 30), "National Day for Truth and Reconciliation")
+	observe(nthMonday(time.October, 2), "Thanksgiving")
+	observe(date(time.November, 11), "Remembrance Day")
+	observe(date(time.December, 25), "Christmas Day")
+	observe(date(time.December, 26), "Boxing Day")
+	return c
+}
+
+// easter returns the date of Easter Sunday in year, using the anonymous
+// Gregorian algorithm.
+func easter(year int) time.Time {
+	a := year % 19
+	b, c := year/100, year%100
+	d, e := b/4, b%4
+	f := (b + 8) / 25
+	g := (b - f + 1) / 3
+	h := (19*a + b - d - g + 15) % 30
+	i, k := c/4, c%4
+	l := (32 + 2*e + 2*i - h - k) % 7
+	m := (a + 11*h + 22*l) / 451
+	month := (h + l - 7*m + 114) / 31
+	day := (h+l-7*m+114)%31 + 1
+	return time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+}
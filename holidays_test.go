@@ -0,0 +1,143 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEaster(t *testing.T) {
+	for year, want := range map[int]string{
+		2019: "2019-04-21",
+		2024: "2024-03-31",
+		2025: "2025-04-20",
+		2026: "2026-04-05",
+		2038: "2038-04-25",
+	} {
+		if got := easter(year).Format(dateFormat); got != want {
+			t.Errorf("easter(%d) = %s, want %s", year, got, want)
+		}
+	}
+}
+
+func TestNovaScotiaHolidays(t *testing.T) {
+	for _, tt := range []struct {
+		year int
+		want map[string]string
+	}{
+		{2025, map[string]string{
+			"2025-01-01": "New Year's Day",
+			"2025-02-17": "Heritage Day",
+			"2025-04-18": "Good Friday",
+			"2025-05-19": "Victoria Day",
+			"2025-07-01": "Canada Day",
+			"2025-08-04": "Natal Day",
+			"2025-09-01": "Labour Day",
+			"2025-09-30": "National Day for Truth and Reconciliation",
+			"2025-10-13": "Thanksgiving",
+			"2025-11-11": "Remembrance Day",
+			"2025-12-25": "Christmas Day",
+			"2025-12-26": "Boxing Day",
+		}},
+		// Holidays on weekends move to the next free weekday: Christmas on
+		// Sunday to Monday, pushing Boxing Day to Tuesday.
+		{2022, map[string]string{
+			"2022-01-03": "New Year's Day",
+			"2022-02-21": "Heritage Day",
+			"2022-04-15": "Good Friday",
+			"2022-05-23": "Victoria Day",
+			"2022-07-01": "Canada Day",
+			"2022-08-01": "Natal Day",
+			"2022-09-05": "Labour Day",
+			"2022-09-30": "National Day for Truth and Reconciliation",
+			"2022-10-10": "Thanksgiving",
+			"2022-11-11": "Remembrance Day",
+			"2022-12-26": "Christmas Day",
+			"2022-12-27": "Boxing Day",
+		}},
+	} {
+		got := novaScotiaHolidays(tt.year)
+		for date, name := range tt.want {
+			if got[date] != name {
+				t.Errorf("%d: %s is %q, want %q", tt.year, date, got[date], name)
+			}
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%d: got %d holidays, want %d: %v", tt.year, len(got), len(tt.want), got)
+		}
+	}
+}
+
+func TestHolidayFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "holidays")
+	if err := os.WriteFile(path, []byte("# closures\n2025-12-24 Christmas Eve\n\n2025-12-31\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c := make(holidayCalendar)
+	if err := c.add(path); err != nil {
+		t.Fatal(err)
+	}
+	for date, want := range map[string]string{"2025-12-24": "Christmas Eve", "2025-12-31": "holiday"} {
+		if c[date] != want {
+			t.Errorf("%s is %q, want %q", date, c[date], want)
+		}
+	}
+
+	if err := os.WriteFile(path, []byte("2025-12-24 Christmas Eve\nDec 31 New Year's Eve\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := make(holidayCalendar).add(path); err == nil {
+		t.Error("adding a file with a bad date succeeded")
+	}
+}
+
+func TestAfterHoliday(t *testing.T) {
+	c := novaScotiaHolidays(2025)
+	for _, tt := range []struct {
+		date, want string
+	}{
+		// The day after Canada Day.
+		{"2025-07-02", "Canada Day"},
+		// The Tuesday after Victoria Day.
+		{"2025-05-20", "Victoria Day"},
+		// Monday, back over the weekend to Good Friday.
+		{"2025-04-21", "Good Friday"},
+		// An ordinary Monday after an ordinary Friday.
+		{"2025-06-09", ""},
+	} {
+		d, err := time.Parse(dateFormat, tt.date)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := c.afterHoliday(d.Add(14 * time.Hour)); got != tt.want {
+			t.Errorf("afterHoliday(%s) = %q, want %q", tt.date, got, tt.want)
+		}
+	}
+}
+
+func TestScheduleHolidays(t *testing.T) {
+	c := novaScotiaHolidays(2025)
+	for _, tt := range []struct {
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		// Weekday schedules skip holidays like weekends: Good Friday
+		// through Easter Sunday to Monday.
+		{"CRON_TZ=UTC 0 6 * * 1-5", time.Date(2025, 4, 17, 12, 0, 0, 0, time.UTC), time.Date(2025, 4, 21, 6, 0, 0, 0, time.UTC)},
+		// Weekend schedules fire on holidays too.
+		{"CRON_TZ=UTC 0 6 * * 6", time.Date(2025, 4, 16, 12, 0, 0, 0, time.UTC), time.Date(2025, 4, 18, 6, 0, 0, 0, time.UTC)},
+		// Schedules not restricted to days of the week ignore holidays.
+		{"CRON_TZ=UTC 0 6 * * *", time.Date(2025, 4, 17, 12, 0, 0, 0, time.UTC), time.Date(2025, 4, 18, 6, 0, 0, 0, time.UTC)},
+	} {
+		s, err := parseSchedule(tt.expr)
+		if err != nil {
+			t.Errorf("parseSchedule(%q): %v", tt.expr, err)
+			continue
+		}
+		if got := s.next(tt.from, c); !got.Equal(tt.want) {
+			t.Errorf("%q next after %v = %v, want %v", tt.expr, tt.from, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// calendar renders ts as an iCalendar file with an event for each close
+// date and each of their events, such as site visits and question
+// deadlines, so recipients can add them to their calendars from the
+// email.
+func calendar(ts []Tender, now time.Time) []byte {
+	var b strings.Builder
+	line := func(s string) {
+		// Fold lines longer than 75 octets, as RFC 5545 requires.
+		for len(s) > 75 {
+			n := 75
+			for n > 0 && s[n]&0xc0 == 0x80 {
+				n-- // don't split UTF-8 sequences
+			}
+			b.WriteString(s[:n] + "\r\n")
+			s = " " + s[n:]
+		}
+		b.WriteString(s + "\r\n")
+	}
+	// Wall clock times in UTC are really the portal's.
+	event := func(uid, summary, url string, at time.Time, wallClock bool) {
+		if wallClock {
+			at = time.Date(at.Year(), at.Month(), at.Day(), at.Hour(), at.Minute(), at.Second(), 0, portalLocation)
+		}
+		line("BEGIN:VEVENT")
+		line("UID:" + uid + "@tender-digest")
+		line("DTSTAMP:" + now.UTC().Format("20060102T150405Z"))
+		line("DTSTART:" + at.UTC().Format("20060102T150405Z"))
+		line("DTEND:" + at.UTC().Format("20060102T150405Z"))
+		line("SUMMARY:" + icsEscape(summary))
+		line("URL:" + url)
+		line("TRANSP:TRANSPARENT")
+		line("END:VEVENT")
+	}
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//tender-digest//EN")
+	line("METHOD:PUBLISH")
+	for _, t := range ts {
+		event(t.ID+"-close", "Closes: "+t.Description, t.URL, t.CloseDate, t.closeDateOnly)
+		for _, e := range t.Events {
+			if e.Kind == questionDeadline {
+				event(fmt.Sprintf("%s-questions-%d", t.ID, e.At.Unix()), "Questions due: "+t.Description, t.URL, e.At, true)
+				continue
+			}
+			kind := e.Kind
+			if e.Mandatory {
+				kind = "mandatory " + kind
+			}
+			summary := strings.ToUpper(kind[:1]) + kind[1:] + ": " + t.Description
+			event(fmt.Sprintf("%s-%s-%d", t.ID, strings.ReplaceAll(e.Kind, " ", "-"), e.At.Unix()), summary, t.URL, e.At, true)
+		}
+	}
+	line("END:VCALENDAR")
+	return []byte(b.String())
+}
+
+// calendarAttachment is which tenders a digest's iCalendar attachment
+// covers. As a flag it takes closing-soon or true, all, or none or false.
+type calendarAttachment string
+
+const (
+	noCalendar          calendarAttachment = ""
+	closingSoonCalendar calendarAttachment = "closing-soon"
+	allCalendar         calendarAttachment = "all"
+)
+
+func (c *calendarAttachment) Set(v string) error {
+	switch v {
+	case "true", string(closingSoonCalendar):
+		*c = closingSoonCalendar
+	case "false", "none":
+		*c = noCalendar
+	case string(allCalendar):
+		*c = allCalendar
+	default:
+		return fmt.Errorf("unknown calendar attachment %q, want closing-soon, all or none", v)
+	}
+	return nil
+}
+
+func (c *calendarAttachment) String() string {
+	if c == nil {
+		return ""
+	}
+	return string(*c)
+}
+
+var icsEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`)
+
+func icsEscape(s string) string {
+	return icsEscaper.Replace(s)
+}
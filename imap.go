@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// mailbox is an IMAP folder a portal's alert emails are delivered to, as
+// a URL like imaps://user@host/Folder, with the password kept out of it.
+// With imap:// the connection is upgraded with STARTTLS before logging in.
+type mailbox struct {
+	u        *url.URL
+	password string
+}
+
+// parseMailbox parses an -imap URL.
+func parseMailbox(raw, password string) (*mailbox, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	if (u.Scheme != "imaps" && u.Scheme != "imap") || u.Host == "" || u.User == nil {
+		return nil, fmt.Errorf("want imaps://user@host/folder, got %q", raw)
+	}
+	return &mailbox{u: u, password: password}, nil
+}
+
+func (mb *mailbox) String() string {
+	return mb.u.Redacted()
+}
+
+// imapPollTimeout is how long polling a mailbox may take.
+const imapPollTimeout = 2 * time.Minute
+
+// poll passes each unseen message in the mailbox to handle, as it was
+// received, marking it seen unless handle fails. It returns how many
+// messages were handled.
+func (mb *mailbox) poll(ctx context.Context, handle func(raw []byte) error) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, imapPollTimeout)
+	defer cancel()
+
+	c, err := dialIMAP(ctx, mb.u)
+	if err != nil {
+		return 0, err
+	}
+	defer c.close()
+
+	if _, err := c.cmd("LOGIN %s %s", imapQuote(mb.u.User.Username()), imapQuote(mb.password)); err != nil {
+		return 0, err
+	}
+	folder := strings.TrimPrefix(mb.u.Path, "/")
+	if folder == "" {
+		folder = "INBOX"
+	}
+	if _, err := c.cmd("SELECT %s", imapQuote(folder)); err != nil {
+		return 0, err
+	}
+	resps, err := c.cmd("UID SEARCH UNSEEN")
+	if err != nil {
+		return 0, err
+	}
+	var uids []string
+	for _, r := range resps {
+		if rest, ok := strings.CutPrefix(r.line, "* SEARCH"); ok {
+			uids = append(uids, strings.Fields(rest)...)
+		}
+	}
+
+	var n int
+	for _, uid := range uids {
+		resps, err := c.cmd("UID FETCH %s BODY.PEEK[]", uid)
+		if err != nil {
+			return n, err
+		}
+		var raw []byte
+		for _, r := range resps {
+			if strings.Contains(r.line, "FETCH") && len(r.literals) > 0 {
+				raw = r.literals[0]
+			}
+		}
+		if raw == nil {
+			slog.Warn("no body fetching message", "uid", uid, "mailbox", mb)
+			continue
+		}
+		if err := handle(raw); err != nil {
+			slog.Warn("handling message, leaving it unseen", "uid", uid, "mailbox", mb, "err", err)
+			continue
+		}
+		if _, err := c.cmd(`UID STORE %s +FLAGS.SILENT (\Seen)`, uid); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// imapConn is a minimal IMAP4rev1 client, just enough to read a folder.
+type imapConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	tag  int
+}
+
+// imapResponse is an untagged response line, with the contents of any
+// literals it had.
+type imapResponse struct {
+	line     string
+	literals [][]byte
+}
+
+var imapLiteralRe = regexp.MustCompile(`\{(\d+)\}$`)
+
+func dialIMAP(ctx context.Context, u *url.URL) (*imapConn, error) {
+	addr := u.Host
+	if u.Port() == "" {
+		port := "993"
+		if u.Scheme == "imap" {
+			port = "143"
+		}
+		addr = net.JoinHostPort(u.Hostname(), port)
+	}
+	var conn net.Conn
+	var err error
+	if u.Scheme == "imaps" {
+		d := tls.Dialer{Config: &tls.Config{ServerName: u.Hostname()}}
+		conn, err = d.DialContext(ctx, "tcp", addr)
+	} else {
+		var d net.Dialer
+		conn, err = d.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if dl, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(dl)
+	}
+	c := &imapConn{conn: conn, r: bufio.NewReader(conn)}
+	greeting, err := c.read()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !strings.HasPrefix(greeting.line, "* OK") {
+		conn.Close()
+		return nil, fmt.Errorf("imap: unexpected greeting %q", greeting.line)
+	}
+	if u.Scheme == "imap" {
+		// The password is never sent in the clear, so a server that
+		// can't upgrade the connection fails here.
+		if _, err := c.cmd("STARTTLS"); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		if c.r.Buffered() > 0 {
+			conn.Close()
+			return nil, fmt.Errorf("imap STARTTLS: unexpected data before the handshake")
+		}
+		tc := tls.Client(conn, &tls.Config{ServerName: u.Hostname()})
+		if err := tc.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("imap STARTTLS: %w", err)
+		}
+		c.conn, c.r = tc, bufio.NewReader(tc)
+	}
+	return c, nil
+}
+
+// cmd sends a command and returns its untagged responses, or an error if
+// it didn't complete OK.
+func (c *imapConn) cmd(format string, args ...any) ([]imapResponse, error) {
+	c.tag++
+	tag := "a" + strconv.Itoa(c.tag)
+	cmd := fmt.Sprintf(format, args...)
+	if _, err := fmt.Fprintf(c.conn, "%s %s\r\n", tag, cmd); err != nil {
+		return nil, err
+	}
+	// Keep credentials out of errors.
+	name, _, _ := strings.Cut(cmd, " ")
+	var res []imapResponse
+	for {
+		r, err := c.read()
+		if err != nil {
+			return nil, fmt.Errorf("imap %s: %w", name, err)
+		}
+		if status, ok := strings.CutPrefix(r.line, tag+" "); ok {
+			if !strings.HasPrefix(status, "OK") {
+				return nil, fmt.Errorf("imap %s: %s", name, status)
+			}
+			return res, nil
+		}
+		res = append(res, r)
+	}
+}
+
+// read reads a response, which continues past the end of a line after
+// each literal.
+func (c *imapConn) read() (imapResponse, error) {
+	var r imapResponse
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return r, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		r.line += line
+		m := imapLiteralRe.FindStringSubmatch(line)
+		if m == nil {
+			return r, nil
+		}
+		n, err := strconv.Atoi(m[1])
+		if err != nil {
+			return r, err
+		}
+		b := make([]byte, n)
+		if _, err := io.ReadFull(c.r, b); err != nil {
+			return r, err
+		}
+		r.literals = append(r.literals, b)
+	}
+}
+
+func (c *imapConn) close() {
+	c.cmd("LOGOUT")
+	c.conn.Close()
+}
+
+// imapQuote quotes s as an IMAP quoted string.
+func imapQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// emailBodies returns the first plain text and HTML parts of the raw
+// email message, decoded to UTF-8.
+func emailBodies(raw []byte) (text, html string, err error) {
+	m, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return "", "", err
+	}
+	err = walkParts(m.Header.Get("Content-Type"), m.Header.Get("Content-Transfer-Encoding"), m.Body, &text, &html)
+	return text, html, err
+}
+
+func walkParts(contentType, encoding string, body io.Reader, text, html *string) error {
+	if contentType == "" {
+		contentType = "text/plain"
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return err
+	}
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			p, err := mr.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := walkParts(p.Header.Get("Content-Type"), p.Header.Get("Content-Transfer-Encoding"), p, text, html); err != nil {
+				return err
+			}
+		}
+	}
+
+	var dst *string
+	switch mediaType {
+	case "text/plain":
+		dst = text
+	case "text/html":
+		dst = html
+	}
+	if dst == nil || *dst != "" {
+		return nil
+	}
+	switch strings.ToLower(encoding) {
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	}
+	if cs := params["charset"]; cs != "" && !strings.EqualFold(cs, "utf-8") && !strings.EqualFold(cs, "us-ascii") {
+		if enc, err := htmlindex.Get(cs); err == nil {
+			body = enc.NewDecoder().Reader(body)
+		}
+	}
+	b, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	*dst = string(b)
+	return nil
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// alertListing is a tender found in one of a portal's own alert emails.
+type alertListing struct {
+	url      *url.URL
+	detailID string
+	title    string
+}
+
+var (
+	// alertLinkRe matches links to tender detail pages in alert email
+	// HTML, with the link text.
+	alertLinkRe = regexp.MustCompile(`(?is)<a\s[^>]*href=["']([^"']*/Module/Tenders/en/Tender/Detail/([0-9a-f-]{36})[^"']*)["'][^>]*>(.*?)</a>`)
+	// alertURLRe matches tender detail page URLs in alert email text.
+	alertURLRe = regexp.MustCompile(`(?i)https?://[^\s<>"]*/Module/Tenders/en/Tender/Detail/([0-9a-f-]{36})`)
+	tagRe      = regexp.MustCompile(`<[^>]*>`)
+)
+
+// parseAlertEmail returns the tenders listed in an alert email from a
+// bids&tenders portal, from its HTML if it has any, otherwise its text,
+// where the title is on the line before each link.
+func parseAlertEmail(text, htmlBody string) []alertListing {
+	var res []alertListing
+	seen := make(map[string]bool)
+	add := func(rawURL, detailID, title string) {
+		u, err := url.Parse(html.UnescapeString(rawURL))
+		title = squeezeRe.ReplaceAllString(strings.TrimSpace(title), " ")
+		if err != nil || title == "" || seen[detailID] {
+			return
+		}
+		seen[detailID] = true
+		res = append(res, alertListing{url: u, detailID: detailID, title: title})
+	}
+
+	if htmlBody != "" {
+		for _, m := range alertLinkRe.FindAllStringSubmatch(htmlBody, -1) {
+			add(m[1], m[2], html.UnescapeString(tagRe.ReplaceAllString(m[3], "")))
+		}
+		return res
+	}
+
+	var prev string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if m := alertURLRe.FindStringSubmatch(line); m != nil {
+			// The title may share the URL's line, or be the line before.
+			title := strings.TrimSpace(strings.Trim(strings.Replace(line, m[0], "", 1), "<>:-"))
+			if title == "" {
+				title = prev
+			}
+			add(m[0], m[1], title)
+		}
+		if line != "" {
+			prev = line
+		}
+	}
+	return res
+}
+
+// inboundHandler takes a portal's alert emails, as posted by an inbound
+// parse webhook such as SendGrid's with the message's text and html as
+// form fields, and stores the tenders they list from the configured
+// sources that haven't been seen yet. It's a backup for when scraping
+// fails, so tenders get into the next digest regardless.
+func inboundHandler(st store, sc *scraper) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		found, added, err := addAlertListings(st, sc, "webhook", parseAlertEmail(r.FormValue("text"), r.FormValue("html")))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		slog.Info("inbound email", "from", r.FormValue("from"), "tenders", found, "new", len(added))
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			Found int `json:"found"`
+			New   int `json:"new"`
+		}{found, len(added)})
+	}
+}
+
+// addAlertListings stores the tenders in listings from sc's sources that
+// haven't been seen yet, returning how many were from its sources and the
+// ones added. via is how the email came in. Their dates aren't in alert
+// emails, so they're stored as now, and held out of digests, until a
+// scrape lists them.
+func addAlertListings(st store, sc *scraper, via string, listings []alertListing) (int, []Tender, error) {
+	var found int
+	var added []Tender
+	for _, l := range listings {
+		var cl *Client
+		for _, spec := range sc.sources {
+			c, err := spec.client()
+			if err == nil && c.u.Host == l.url.Host {
+				cl = c
+				break
+			}
+		}
+		if cl == nil {
+			slog.Info("ignoring alert email listing, which isn't one of -sources", "url", l.url)
+			continue
+		}
+		id, rest, ok := strings.Cut(l.title, " ")
+		if !ok {
+			slog.Info("ignoring alert email listing with no tender number", "url", l.url, "title", l.title)
+			continue
+		}
+		found++
+
+		now := time.Now()
+		_, err := st.db.Exec("insert into alert_sightings (tender_id, via, first_received, last_received) values (?, ?, ?, ?) on conflict (tender_id) do update set last_received = excluded.last_received",
+			cl.idPrefix+id, via, now, now)
+		if err != nil {
+			return found, added, fmt.Errorf("insert alert sighting: %v", err)
+		}
+		t := Tender{
+			ID:          cl.idPrefix + id,
+			URL:         cl.u.ResolveReference(&url.URL{Path: "/Module/Tenders/en/Tender/Detail/" + l.detailID}).String(),
+			Description: cleanText(strings.TrimPrefix(strings.TrimSpace(rest), "-")),
+			Agency:      cl.agency,
+			IssuedDate:  now,
+			CloseDate:   now,
+		}
+		// Only add what hasn't been seen; the email has too little to
+		// update a tender with, and the next scrape fills in the rest.
+		isNew, err := st.add(t)
+		if err == nil && isNew {
+			err = st.setSeries(t.ID, t.Description)
+		}
+		if err == nil && isNew {
+			_, err = st.db.Exec("insert into alert_tenders (tender_id, via, received) values (?, ?, ?)", t.ID, via, now)
+		}
+		if err != nil {
+			return found, added, err
+		}
+		if isNew {
+			st.events.emit("tender_observed", t.ID, t)
+			added = append(added, t)
+		}
+	}
+	return found, added, nil
+}
+
+// reconcileAlertTender fills in the dates of t, as just scraped, if it was
+// first found in an alert email and this is the first time it's been
+// scraped since, reporting whether it was.
+func (s store) reconcileAlertTender(t Tender) (bool, error) {
+	res, err := s.db.Exec("update alert_tenders set reconciled = ? where tender_id = ? and reconciled is null", time.Now(), t.ID)
+	if err != nil {
+		return false, fmt.Errorf("update alert tender: %v", err)
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+	if _, err := s.db.Exec("update tenders set issued = ? where id = ?", t.IssuedDate, t.ID); err != nil {
+		return false, fmt.Errorf("update issued: %v", err)
+	}
+	if !t.closeUnknown {
+		if _, err := s.db.Exec("update tenders set close = ? where id = ?", t.CloseDate, t.ID); err != nil {
+			return false, fmt.Errorf("update close: %v", err)
+		}
+	}
+	return true, nil
+}
+
+// pollMailbox adds the tenders listed in the unseen alert emails in sc's
+// mailbox, if it has one, that scraping hasn't found, warning about each
+// as missed by the scraper.
+func (sc *scraper) pollMailbox(ctx context.Context, st store) {
+	if sc.mailbox == nil {
+		return
+	}
+	var found, missed int
+	n, err := sc.mailbox.poll(ctx, func(raw []byte) error {
+		text, html, err := emailBodies(raw)
+		if err != nil {
+			return err
+		}
+		f, added, err := addAlertListings(st, sc, "imap", parseAlertEmail(text, html))
+		found += f
+		missed += len(added)
+		for _, t := range added {
+			slog.Warn("in an alert email but scraping hasn't found it, adding it from there", "tender", t.ID)
+			st.events.emit("tender_missed", t.ID, t)
+		}
+		return err
+	})
+	if err != nil {
+		slog.Error("polling mailbox", "mailbox", sc.mailbox, "err", err)
+	}
+	if n > 0 {
+		slog.Info("read alert emails", "mailbox", sc.mailbox, "emails", n, "tenders", found, "missed", missed)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+)
+
+// keywordFilter keeps tenders whose description or scope mentions one of
+// include, if there are any, and none of exclude. Matching ignores case.
+type keywordFilter struct {
+	include, exclude []string
+}
+
+func (f keywordFilter) empty() bool {
+	return len(f.include) == 0 && len(f.exclude) == 0
+}
+
+// exclusion returns why f leaves t out, or "" if it doesn't.
+func (f keywordFilter) exclusion(t Tender) string {
+	text := strings.ToLower(t.Description)
+	if t.Detail != nil {
+		text += "\n" + strings.ToLower(t.Detail.Scope)
+	}
+	if i := slices.IndexFunc(f.exclude, func(k string) bool { return strings.Contains(text, k) }); i >= 0 {
+		return fmt.Sprintf("mentions %q", f.exclude[i])
+	}
+	if len(f.include) > 0 && !slices.ContainsFunc(f.include, func(k string) bool { return strings.Contains(text, k) }) {
+		return "mentions none of " + strings.Join(f.include, ", ")
+	}
+	return ""
+}
+
+// filterKeywords returns the tenders in ts that f keeps.
+func filterKeywords(ts []Tender, f keywordFilter) []Tender {
+	if f.empty() {
+		return ts
+	}
+	return leaveOut(ts, f.exclusion)
+}
+
+// leaveOut returns the tenders in ts that exclusion gives no reason to
+// leave out, logging the others with attrs.
+func leaveOut(ts []Tender, exclusion func(Tender) string, attrs ...any) []Tender {
+	var res []Tender
+	for _, t := range ts {
+		if why := exclusion(t); why != "" {
+			slog.Info("leaving out tender", append([]any{"tender", t.ID, "reason", why}, attrs...)...)
+			continue
+		}
+		res = append(res, t)
+	}
+	return res
+}
+
+// keywordList splits a comma-separated list of keywords, lowercased for
+// matching.
+func keywordList(s string) []string {
+	var res []string
+	for _, k := range strings.Split(s, ",") {
+		if k = strings.ToLower(strings.TrimSpace(k)); k != "" {
+			res = append(res, k)
+		}
+	}
+	return res
+}
+
+// recipientFilter narrows down what one recipient is sent, on top of the
+// filters for everyone.
+type recipientFilter struct {
+	keywordFilter
+	// agencies, if set, are the only agencies whose tenders are sent.
+	agencies []string
+}
+
+func (f recipientFilter) empty() bool {
+	return f.keywordFilter.empty() && len(f.agencies) == 0
+}
+
+// exclusion adds leaving out other agencies' tenders to the keyword
+// filter's exclusion.
+func (f recipientFilter) exclusion(t Tender) string {
+	if why := f.keywordFilter.exclusion(t); why != "" {
+		return why
+	}
+	if len(f.agencies) > 0 && !slices.ContainsFunc(f.agencies, func(a string) bool { return strings.EqualFold(a, t.Agency) }) {
+		return "not from " + strings.Join(f.agencies, ", ")
+	}
+	return ""
+}
+
+// apply returns the tenders in ts that f keeps for to.
+func (f recipientFilter) apply(to string, ts []Tender) []Tender {
+	if f.empty() {
+		return ts
+	}
+	return leaveOut(ts, f.exclusion, "recipient", to)
+}
+
+// applyUpdates returns the updates in u about tenders f keeps. updated
+// are the tenders u is about, by ID; updates about others are kept.
+func (f recipientFilter) applyUpdates(updated map[string]Tender, u updates) updates {
+	if f.empty() {
+		return u
+	}
+	return u.only(func(id string) bool {
+		t, ok := updated[id]
+		return !ok || f.exclusion(t) == ""
+	})
+}
+
+// recipientFilters is, per recipient, a filter applied to what they're
+// sent.
+type recipientFilters map[string]recipientFilter
+
+// recipientKeywordsFlag sets the include or exclude keywords of
+// recipientFilters, taking email=keyword,keyword.
+type recipientKeywordsFlag struct {
+	m       recipientFilters
+	exclude bool
+}
+
+func (f recipientKeywordsFlag) Set(s string) error {
+	email, keywords, ok := strings.Cut(s, "=")
+	if !ok || email == "" {
+		return fmt.Errorf("want email=keyword,keyword, got %q", s)
+	}
+	rf := f.m[email]
+	if f.exclude {
+		rf.exclude = append(rf.exclude, keywordList(keywords)...)
+	} else {
+		rf.include = append(rf.include, keywordList(keywords)...)
+	}
+	f.m[email] = rf
+	return nil
+}
+
+func (f recipientKeywordsFlag) String() string {
+	var s []string
+	for email, rf := range f.m {
+		ks := rf.include
+		if f.exclude {
+			ks = rf.exclude
+		}
+		if len(ks) > 0 {
+			s = append(s, email+"="+strings.Join(ks, ","))
+		}
+	}
+	slices.Sort(s)
+	return strings.Join(s, " ")
+}
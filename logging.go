@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+// setupLogging makes logs structured, at level and above, as format: text
+// for logfmt-style lines or json for one object per line. Anything still
+// logged with the log package goes through it at info level.
+func setupLogging(level slog.Level, format string) error {
+	opts := &slog.HandlerOptions{Level: level}
+	var h slog.Handler
+	switch format {
+	case "text":
+		h = slog.NewTextHandler(os.Stderr, opts)
+	case "json":
+		h = slog.NewJSONHandler(os.Stderr, opts)
+	default:
+		return fmt.Errorf("unknown -log-format %q, want text or json", format)
+	}
+	slog.SetDefault(slog.New(h))
+	return nil
+}
+
+// atExit are called by exit, last added first, since os.Exit skips
+// deferred calls.
+var atExit []func()
+
+// exit calls atExit and exits with code.
+func exit(code int) {
+	for i := len(atExit) - 1; i >= 0; i-- {
+		atExit[i]()
+	}
+	os.Exit(code)
+}
+
+// fatal logs err and exits, for errors main can't go on from.
+func fatal(err error) {
+	slog.Error(err.Error())
+	exit(1)
+}
+
+// fatalf is fatal with a formatted message.
+func fatalf(format string, args ...any) {
+	fatal(fmt.Errorf(format, args...))
+}
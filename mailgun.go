@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strings"
+)
+
+type mailgunProvider struct {
+	apiKey string
+	domain string
+	// apiBase is the API endpoint, https://api.eu.mailgun.net for
+	// domains in the EU region.
+	apiBase string
+}
+
+func (p mailgunProvider) send(ctx context.Context, m message) error {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("from", m.from.String())
+	mw.WriteField("to", m.from.String())
+	for _, a := range m.bcc {
+		mw.WriteField("bcc", a.String())
+	}
+	mw.WriteField("subject", m.subject)
+	if m.text != "" {
+		mw.WriteField("text", m.text)
+	}
+	mw.WriteField("html", m.html)
+	if m.disableClickTracking {
+		mw.WriteField("o:tracking-clicks", "no")
+	}
+	for _, i := range m.inline {
+		// Mailgun uses the file name as the Content-ID.
+		h := make(textproto.MIMEHeader)
+		h.Set("Content-Disposition", mime.FormatMediaType("form-data", map[string]string{"name": "inline", "filename": i.cid}))
+		h.Set("Content-Type", i.contentType)
+		w, err := mw.CreatePart(h)
+		if err != nil {
+			return err
+		}
+		w.Write(i.data)
+	}
+	for _, f := range m.attachments {
+		h := make(textproto.MIMEHeader)
+		h.Set("Content-Disposition", mime.FormatMediaType("form-data", map[string]string{"name": "attachment", "filename": f.filename}))
+		h.Set("Content-Type", f.contentType)
+		w, err := mw.CreatePart(h)
+		if err != nil {
+			return err
+		}
+		w.Write(f.data)
+	}
+	if err := mw.Close(); err != nil {
+		return err
+	}
+
+	u := strings.TrimSuffix(p.apiBase, "/") + "/v3/" + url.PathEscape(p.domain) + "/messages"
+	req, err := http.NewRequestWithContext(ctx, "POST", u, &body)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth("api", p.apiKey)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 300 {
+		return nil
+	}
+
+	b, _ := io.ReadAll(resp.Body)
+	pe := &providerError{provider: "mailgun", status: resp.StatusCode, msg: strings.TrimSpace(string(b))}
+	var res struct {
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(b, &res) == nil && res.Message != "" {
+		pe.msg = res.Message
+	}
+
+	switch resp.StatusCode {
+	case http.StatusUnauthorized:
+		pe.msg = "API key rejected, check MAILGUN_API_KEY and that MAILGUN_API_BASE matches the domain's region: " + pe.msg
+	case http.StatusForbidden:
+		pe.msg = "forbidden, sandbox domains can only send to authorized recipients: " + pe.msg
+	case http.StatusNotFound:
+		pe.msg = "domain " + p.domain + " not found, check MAILGUN_DOMAIN and region: " + pe.msg
+	case http.StatusTooManyRequests:
+		pe.rateLimited = true
+		pe.retryAfter = retryAfter(resp.Header)
+	}
+	return pe
+}
@@ -1,21 +1,23 @@
 package main
 
 import (
+	"cmp"
 	"context"
 	"database/sql"
-	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"log/slog"
+	"net/mail"
 	"net/url"
 	"os"
+	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
-	"github.com/playwright-community/playwright-go"
 	_ "modernc.org/sqlite"
 )
 
@@ -25,264 +27,1042 @@ import (
 
 func main() {
 	fs := flag.NewFlagSet("tender-digest", flag.ExitOnError)
-	var dbFile string
+	var configFile string
+	var logLevel slog.Level
+	var logFormat string
+	var dbFile, shadowDB string
+	var eventsFile string
+	var eventsMaxSize, eventsKeep int
+	var responsesDir string
+	var responsesKeep time.Duration
+	var replayDir string
 	var skipNotify bool
+	var strict bool
+	var direct bool
+	var backdate bool
+	var listen, publicListen, controlSocket string
+	var metricsFile string
+	var sendInterval time.Duration
+	var emailProviderName string
+	var channelNames string
+	var mxHelo, dkimKey, dkimSelector, dkimDomain string
+	var sesRegion, sesConfigurationSet string
+	var inlineImages bool
+	var logoFile string
+	var emailTemplate string
+	var utm string
+	var force bool
+	var documentsDir string
+	docExtractors := defaultExtractors()
+	var docAlerts []string
+	var maxBidSecurity, maxBidSecurityPercent float64
+	var skipLocalOnly bool
+	var requireAgreements string
+	var unspscFile, unspscFilter string
+	var includeKeywords, excludeKeywords string
+	recipientFilters := recipientFilters{}
+	var quietPeriod time.Duration
+	var runTimeout, maxRunDuration, initTimeout, pageTimeout, notifyTimeout time.Duration
+	var questionReminderWithin, closingReminderWithin time.Duration
+	var notifyPartial bool
+	var disableClickTracking bool
+	var attachCalendar calendarAttachment
+	closingSoonWithin := defaultClosingSoonHorizons()
+	var shortLinkBase string
+	var imapURL string
+	var healthcheckURL string
+	var recordLink recordLinkTemplate
+	var egr egress
+	var browser browserConfig
+	var sources sourceSpecs
+	var schedules []schedule
+	holidays := make(holidayCalendar)
+	redact := make(redactions)
+	fs.StringVar(&configFile, "config", "", "YAML file of flag and environment variable settings, overridden by the command line and environment; see loadConfig")
+	fs.TextVar(&logLevel, "log-level", slog.LevelInfo, "least severe level to log: debug, info, warn or error")
+	fs.BoolFunc("v", "log at debug level, such as each page listed; short for -log-level debug", func(v string) error {
+		debug, err := strconv.ParseBool(v)
+		if debug {
+			logLevel = slog.LevelDebug
+		}
+		return err
+	})
+	fs.StringVar(&logFormat, "log-format", "text", "how to write logs: text, as key=value pairs, or json, one object per line")
 	fs.StringVar(&dbFile, "db-file", "store.db", "sqlite database filename")
+	fs.StringVar(&eventsFile, "events-file", "events.jsonl", "file to append pipeline events to as JSON lines, relative to the directory of -db-file; empty disables it")
+	fs.IntVar(&eventsMaxSize, "events-max-size", 100, "size in MB past which -events-file is rotated; 0 for no limit")
+	fs.IntVar(&eventsKeep, "events-keep", 5, "how many rotated -events-file files to keep")
+	fs.StringVar(&responsesDir, "responses-dir", "responses", "directory to archive portal search responses in as they arrived, relative to the directory of -db-file; empty disables it")
+	fs.StringVar(&replayDir, "replay", "", "with scrape, store the tenders in the search responses archived in this directory, such as -responses-dir, instead of scraping; nothing is fetched")
+	fs.DurationVar(&responsesKeep, "responses-keep", 0, "how long to keep archived search responses, such as 720h; 0 keeps them for good, to re-parse them as the parser improves")
+	fs.StringVar(&shadowDB, "shadow-db", "", "copy -db-file to this new file and write to the copy instead, without notifying or logging events, to rehearse changes; compare the result with db diff")
 	fs.BoolVar(&skipNotify, "skip-notify", false, "skip notification, such as for initializing store")
+	fs.BoolVar(&strict, "strict", false, "fail on data-quality anomalies instead of warning, such as for validating parser changes")
+	fs.BoolVar(&backdate, "backdate-first-observed", false, "record new tenders as first observed when the portal says they were made available rather than when scraped, such as when backfilling history")
+	fs.BoolVar(&direct, "direct", false, "list tenders by calling each portal's search endpoint directly instead of with a browser, falling back to the browser if that fails; detail pages aren't fetched unless it falls back")
+	fs.BoolVar(&force, "force", false, "notify even if the store looks freshly created or restored")
+	fs.DurationVar(&quietPeriod, "quiet-period", 24*time.Hour, "how long after run history starts that notifying requires -force")
+	fs.DurationVar(&questionReminderWithin, "question-reminder", 48*time.Hour, "remind about watched tenders whose question deadline is within this long; 0 disables")
+	fs.DurationVar(&closingReminderWithin, "closing-reminder", 0, "after notifying, email a reminder about tenders from earlier digests closing within this long, once per close date, such as 72h; 0 disables")
+	fs.DurationVar(&maxRunDuration, "max-run-duration", 30*time.Minute, "stop scraping after this long and notify about what was found so far; 0 for no limit")
+	fs.BoolVar(&notifyPartial, "notify-partial", true, "when some sources fail, still notify about the tenders stored before they did, marking the digest partial; otherwise wait for a run where every source succeeds")
+	fs.DurationVar(&runTimeout, "timeout", 0, "give up on a run, failing it, after this long; the process exits a minute later if it's still going; 0 for no limit")
+	fs.DurationVar(&initTimeout, "init-timeout", 5*time.Minute, "how long starting the browser and loading a portal may take")
+	fs.DurationVar(&pageTimeout, "page-timeout", 2*time.Minute, "how long listing a page of tenders may take")
+	scrapeWorkers := fs.Int("scrape-workers", 3, "how many sources to scrape at once, each in a browser context of its own")
+	pageRetries := fs.Int("page-retries", 2, "how many more times to try listing a page that fails, waiting 10s before the first retry and twice as long before each after; the browser is restarted and paged back to where it was first")
+	fs.DurationVar(&notifyTimeout, "notify-timeout", 5*time.Minute, "how long sending a digest may take")
+	fs.StringVar(&documentsDir, "documents-dir", "documents", "directory to store tender documents in, by content hash")
+	fs.Var(docExtractors, "extractor", "command to extract document text for a file type, as .ext=command with {} for the path; repeatable")
+	fs.Func("doc-alert", "keyword to alert on when it appears in a new document for a watched tender; repeatable", func(s string) error {
+		docAlerts = append(docAlerts, s)
+		return nil
+	})
+	fs.Float64Var(&maxBidSecurity, "max-bid-security", 0, "leave tenders requiring a bid bond or deposit over this many dollars out of notifications")
+	fs.Float64Var(&maxBidSecurityPercent, "max-bid-security-percent", 0, "leave tenders requiring a bid bond or deposit over this percent of the bid out of notifications")
+	fs.BoolVar(&skipLocalOnly, "skip-local-only", false, "leave tenders restricted to local suppliers out of notifications")
+	fs.StringVar(&requireAgreements, "require-agreement", "", "comma-separated trade agreements, such as CFTA,CETA; only notify about tenders stating they're subject to one")
+	fs.StringVar(&unspscFile, "unspsc-map", "", "CSV file mapping UNSPSC codes to description keywords, as code,keyword,...")
+	fs.StringVar(&includeKeywords, "include", "", "comma-separated keywords; only notify about tenders whose description or scope mentions one")
+	fs.StringVar(&excludeKeywords, "exclude", "", "comma-separated keywords; leave tenders whose description or scope mentions one out of notifications")
+	fs.Var(recipientKeywordsFlag{m: recipientFilters}, "recipient-include", "like -include, but only for what one email recipient is sent, as email=keyword,keyword; repeatable")
+	fs.Var(recipientKeywordsFlag{m: recipientFilters, exclude: true}, "recipient-exclude", "like -exclude, but only for what one email recipient is sent, as email=keyword,keyword; repeatable")
+	fs.StringVar(&unspscFilter, "unspsc", "", "comma-separated UNSPSC code prefixes; only notify about tenders mapped to one")
+	fs.Func("schedule", "cron expression, optionally prefixed by CRON_TZ=<zone>, of when to scrape; runs between scheduled times exit without scraping; repeatable", func(s string) error {
+		sc, err := parseSchedule(s)
+		if err != nil {
+			return err
+		}
+		schedules = append(schedules, sc)
+		return nil
+	})
+	fs.Var(redact, "redact", "role=fields: leave fields out of tenders a role sees, with roles export (list and export), public (the public archive and feed) and api (the token API) and fields contacts, scope, documents, events, bid_security and trade_terms; repeatable")
+	fs.Func("tz", "time zone portal dates are in when an item's TimeZoneLabel doesn't say, such as America/Halifax, the default", func(v string) error {
+		loc, err := time.LoadLocation(v)
+		if err != nil {
+			return err
+		}
+		portalLocation = loc
+		return nil
+	})
+	fs.Func("holidays", `holidays to treat like weekends in -schedule day-of-week windows and to flag close dates after: "ns" for Nova Scotia holidays, or a file of "YYYY-MM-DD name" lines; repeatable`, holidays.add)
+	fs.Var(&sources, "sources", "comma-separated bids&tenders tender module URLs to scrape, each optionally prefixed by agency=, defaulting to Halifax's; the agency may be followed by ;name=, ;color= and ;logo= for how its sections of digests and its tenders in the archive are shown; repeatable")
+	fs.StringVar(&healthcheckURL, "healthcheck-url", "", "healthchecks.io ping URL, or Cronitor telemetry URL, to ping when scrape, notify or a run starts and when it succeeds or fails, for alerts when runs stop happening or fail")
+	fs.StringVar(&imapURL, "imap", "", "imaps://user@host/folder of a mailbox the portals' alert emails are filtered into, or imap:// to use STARTTLS, with the password in IMAP_PASSWORD, to read after scraping and add the tenders scraping missed from")
+	fs.Func("proxy", "http://, https:// or socks5:// proxy URL to scrape through", egr.setProxy)
+	fs.Func("resolve", "host=address to connect to for host instead of what DNS says, such as to force IPv6 egress; repeatable", egr.addResolve)
+	fs.Func("browser", "browser to scrape with: chromium, firefox or webkit (default chromium)", browser.setEngine)
+	headless := fs.Bool("headless", true, "run the browser without a window; -headless=false shows it, for debugging")
+	fs.StringVar(&browser.userAgent, "user-agent", "", "user agent for the browser to send instead of its own")
+	fs.Var(&recordLink, "internal-link-template", "URL of a tender's record in the team's own system, such as SharePoint or a CRM, with {id} where the tender's ID goes, to link tender IDs in digests and the archive to")
+	fs.StringVar(&shortLinkBase, "short-link-base", "", "URL serve is reachable at, such as https://tenders.example.com, to shorten links in texts with")
+	fs.StringVar(&listen, "listen", "localhost:8080", "address to listen on for serve")
+	fs.StringVar(&controlSocket, "control-socket", "", "unix socket for serve to take control requests on, such as from fetch-now")
+	fs.StringVar(&publicListen, "public-listen", "", "if set, address to serve only the public tender archive on")
+	fs.StringVar(&metricsFile, "metrics-file", "", "file to write metrics about the latest runs and deliveries to after each run, in the Prometheus text format, such as for node_exporter's textfile collector; serve has them at /metrics")
+	fs.DurationVar(&sendInterval, "send-interval", 100*time.Millisecond, "minimum time between email API calls")
+	fs.StringVar(&channelNames, "channels", "email", "comma-separated channels to send digests over: email, slack to post them to the SLACK_WEBHOOK_URL incoming webhook, webhook to post them as JSON to WEBHOOK_URL, hubspot to create a deal for each bid-worthy new tender with the HUBSPOT_TOKEN private app token, and salesforce to create an opportunity for each with the SALESFORCE_CLIENT_ID and SALESFORCE_CLIENT_SECRET connected app at SALESFORCE_URL")
+	opsTo := fs.String("ops-to", "", "where to send the operator a daily summary of runs, errors, what's waiting to be notified about and the store: comma-separated email addresses, sent with the email provider, or a Slack incoming webhook URL")
+	crmInclude := fs.String("crm-include", "", "comma-separated keywords; only push tenders whose description or scope mentions one to hubspot and salesforce, as bid-worthy")
+	crmExclude := fs.String("crm-exclude", "", "comma-separated keywords; don't push tenders whose description or scope mentions one to hubspot and salesforce")
+	crmIDField := fs.String("crm-id-field", "", "CRM field holding the tender's ID, set up as unique or an external ID, to avoid creating a tender's record twice (default tender_id for hubspot, Tender_ID__c for salesforce)")
+	crmFieldTemplates := make(crmFieldOverrides)
+	fs.Var(crmFieldTemplates, "crm-field", "crm.field=template to set on the records of a CRM, hubspot or salesforce, such as hubspot.dealname=Tender {id}, with {id}, {description}, {agency}, {url}, {issued} and {close} where the tender's go, overriding the default for the field or leaving it out if empty; repeatable")
+	fs.StringVar(&emailProviderName, "email-provider", "sendgrid", "email provider: sendgrid, mailgun, postmark, ses, or mx (direct delivery to recipient MX hosts)")
+	fs.BoolVar(&inlineImages, "inline-images", false, "embed the logo and status badges in emails as inline images instead of text")
+	fs.StringVar(&emailTemplate, "email-template", "", "html/template file to render digest emails with instead of the built-in one")
+	fs.StringVar(&logoFile, "logo", "", "image file to show at the top of emails when using -inline-images")
+	fs.StringVar(&utm, "utm", "", "query parameters to add to tender links in emails, such as utm_source=tender-digest&utm_medium=email")
+	fs.Var(closingSoonWithin, "closing-soon", "how close to closing a tender is flagged as closing soon on a channel, as email, slack, sms or voice=duration; repeatable")
+	fs.Var(&attachCalendar, "attach-calendar", "attach an .ics file with the close dates, site visits, meetings and question deadlines of tenders to digests: closing-soon for those closing soon, all for every new tender, or none")
+	fs.BoolVar(&disableClickTracking, "disable-click-tracking", false, "ask the email provider not to rewrite links for click tracking")
+	fs.StringVar(&sesRegion, "ses-region", "", "AWS region for SES, defaults to the region from the AWS environment or config")
+	fs.StringVar(&sesConfigurationSet, "ses-configuration-set", "", "SES configuration set to send with")
+	fs.StringVar(&mxHelo, "mx-helo", "", "hostname to greet MX hosts with, defaults to the local hostname")
+	fs.StringVar(&dkimKey, "dkim-key", "", "PEM private key file for DKIM signing direct MX deliveries")
+	fs.StringVar(&dkimSelector, "dkim-selector", "default", "DKIM selector")
+	fs.StringVar(&dkimDomain, "dkim-domain", "", "DKIM signing domain, defaults to the domain of FROM_EMAIL")
+	cpuProfile := fs.String("cpuprofile", "", "write a CPU profile to this file")
+	memProfile := fs.String("memprofile", "", "write a heap profile to this file on exit")
+	traceFile := fs.String("trace", "", "write an execution trace to this file")
 	fs.Parse(os.Args[1:])
+	if configFile != "" {
+		if err := loadConfig(fs, configFile); err != nil {
+			fatal(err)
+		}
+	}
+	if err := applyFlagEnv(fs); err != nil {
+		fatal(err)
+	}
+	if err := setupLogging(logLevel, logFormat); err != nil {
+		fatal(err)
+	}
+	stopProfiling, err := startProfiling(*cpuProfile, *memProfile, *traceFile)
+	if err != nil {
+		fatal(err)
+	}
+	stopProfiling = sync.OnceFunc(stopProfiling)
+	atExit = append(atExit, stopProfiling)
+	defer stopProfiling()
 
 	var (
 		sendgridAPIKey = os.Getenv("SENDGRID_API_KEY")
 		fromName       = os.Getenv("FROM_NAME")
 		fromEmail      = os.Getenv("FROM_EMAIL")
 		toEmails       = os.Getenv("TO_EMAILS")
+
+		mailgunAPIKey  = os.Getenv("MAILGUN_API_KEY")
+		mailgunDomain  = os.Getenv("MAILGUN_DOMAIN")
+		mailgunAPIBase = os.Getenv("MAILGUN_API_BASE")
+
+		postmarkServerToken   = os.Getenv("POSTMARK_SERVER_TOKEN")
+		postmarkMessageStream = os.Getenv("POSTMARK_MESSAGE_STREAM")
+
+		twilioAccountSID = os.Getenv("TWILIO_ACCOUNT_SID")
+		twilioAuthToken  = os.Getenv("TWILIO_AUTH_TOKEN")
+		twilioFrom       = os.Getenv("TWILIO_FROM")
+
+		imapPassword = os.Getenv("IMAP_PASSWORD")
+
+		webhookURL      = os.Getenv("WEBHOOK_URL")
+		slackWebhookURL = os.Getenv("SLACK_WEBHOOK_URL")
+
+		hubspotToken           = os.Getenv("HUBSPOT_TOKEN")
+		salesforceURL          = os.Getenv("SALESFORCE_URL")
+		salesforceClientID     = os.Getenv("SALESFORCE_CLIENT_ID")
+		salesforceClientSecret = os.Getenv("SALESFORCE_CLIENT_SECRET")
 	)
 
 	ctx := context.Background()
 
-	cl, err := NewClient("https://halifax.bidsandtenders.ca/Module/Tenders/en")
-	if err != nil {
-		log.Fatal(err)
+	if fs.Arg(0) == "db" {
+		switch fs.Arg(1) {
+		case "diff":
+			if fs.NArg() != 4 {
+				fatalf("usage: tender-digest db diff <old.db> <new.db>")
+			}
+			differ, err := diffDBs(os.Stdout, fs.Arg(2), fs.Arg(3))
+			if err != nil {
+				fatal(err)
+			}
+			if differ {
+				exit(1)
+			}
+		case "schema":
+			sfs := flag.NewFlagSet("db schema", flag.ExitOnError)
+			format := sfs.String("format", "text", "text, with column comments, or an entity relationship diagram as mermaid or dot")
+			sfs.Parse(fs.Args()[2:])
+			version, tables, err := describeSchema(dbFile)
+			if err != nil {
+				fatal(err)
+			}
+			switch *format {
+			case "text":
+				err = printSchema(os.Stdout, version, tables)
+			case "mermaid":
+				writeMermaidER(os.Stdout, tables)
+			case "dot":
+				writeDotER(os.Stdout, tables)
+			default:
+				fatalf("unknown -format %q, want text, mermaid or dot", *format)
+			}
+			if err != nil {
+				fatal(err)
+			}
+		default:
+			fatalf("usage: tender-digest db diff <old.db> <new.db> | db schema [-format text|mermaid|dot]")
+		}
+		return
 	}
-	defer cl.Close()
 
-	db, err := sql.Open("sqlite", "file:"+dbFile+"?_time_format=sqlite")
-	if err != nil {
-		log.Fatal(err)
-	}
-	if _, err := db.Exec("create table if not exists tenders (id text primary key, url text, description text, agency text, issued datetime, close datetime, first_observed datetime)"); err != nil {
-		log.Fatal(err)
+	if shadowDB != "" {
+		if err := shadowCopy(dbFile, shadowDB); err != nil {
+			fatal(err)
+		}
+		slog.Info("writing to shadow copy, the store won't be changed and nothing will be sent or logged as events", "shadow_db", shadowDB, "db", dbFile)
+		dbFile = shadowDB
+		skipNotify = true
+		// What consumes the event log would take a rehearsal for the
+		// real thing.
+		eventsFile = ""
 	}
 
-	st := store{db}
-
-	nt, err := findNew(ctx, cl, st)
+	// Sources scraped at once write at once, so wait for the database
+	// rather than failing when it's busy.
+	db, err := sql.Open("sqlite", "file:"+dbFile+"?_time_format=sqlite&_pragma=busy_timeout(10000)")
 	if err != nil {
-		log.Fatal(err)
+		fatal(err)
+	}
+	if err := migrate(db); err != nil {
+		fatal(err)
 	}
 
-	if sendgridAPIKey == "" || skipNotify {
-		for _, t := range nt {
-			fmt.Println(t.ID, t.Description)
+	st := store{db: db}
+	if eventsFile != "" {
+		if !filepath.IsAbs(eventsFile) {
+			eventsFile = filepath.Join(filepath.Dir(dbFile), eventsFile)
 		}
-		return
+		if st.events, err = openEventLog(eventsFile, int64(eventsMaxSize)<<20, eventsKeep); err != nil {
+			fatal(err)
+		}
+		defer st.events.Close()
 	}
-
-	not := notifier{
-		apiKey:    sendgridAPIKey,
-		fromName:  fromName,
-		fromEmail: fromEmail,
-		toEmails:  strings.Split(toEmails, ";"),
+	if len(sources) == 0 {
+		sources = sourceSpecs{{url: portalURL, agency: portalAgency}}
 	}
-
-	if err := not.notify(nt); err != nil {
-		log.Fatal(err)
+	if err := st.backfillSeries(); err != nil {
+		fatal(err)
 	}
-}
-
-type Client struct {
-	u           *url.URL
-	pw          *playwright.Playwright
-	b           playwright.Browser
-	p           playwright.Page
-	ready       bool
-	responsesMu sync.Mutex
-	responses   []RawTenders
-}
-
-func NewClient(baseURL string) (*Client, error) {
-	u, err := url.Parse(baseURL)
-	if err != nil {
-		return nil, err
+	if err := st.backfillTimes(); err != nil {
+		fatal(err)
+	}
+	// TO_EMAILS only seeds subscribers; after that they're managed with the
+	// subscriber command.
+	if n, err := st.importSubscribers(strings.Split(toEmails, ";")); err != nil {
+		fatal(err)
+	} else if n > 0 {
+		slog.Info("added subscribers from TO_EMAILS, manage them with the subscriber command from now on", "subscribers", n)
 	}
-	return &Client{u: u}, nil
-}
-
-type Tender struct {
-	ID          string
-	URL         string
-	Description string
-	Agency      string
-	IssuedDate  time.Time
-	CloseDate   time.Time
-}
-
-var squeezeRe = regexp.MustCompile(`\s+`)
-var unprintableRe = regexp.MustCompile(`[[:^print:]]`)
 
-func (c *Client) List(ctx context.Context, token string) (_ []Tender, nextToken string, _ error) {
-	if err := c.init(ctx); err != nil {
-		return nil, "", err
+	browser.headful = !*headless
+	if len(egr.resolve) > 0 && browser.name() != "chromium" {
+		fatalf("-resolve only works with -browser chromium")
 	}
 
-	if token != "" {
-		next := c.p.GetByLabel("next page")
-		if err := next.Click(); err != nil {
-			return nil, "", fmt.Errorf("clicking next: %w", err)
+	var unspsc unspscMap
+	if unspscFile != "" {
+		if unspsc, err = loadUNSPSCMap(unspscFile); err != nil {
+			fatal(err)
 		}
 	}
-
-	err := c.p.Locator("#myRepeater > div.repeater-viewport > div.repeater-canvas.borderless-grid > div > div > table > tbody").WaitFor()
-	if err != nil {
-		return nil, "", fmt.Errorf("waiting for table: %w", err)
+	sc := &scraper{
+		sources:        sources,
+		unspscFile:     unspscFile,
+		strict:         strict,
+		direct:         direct,
+		backdate:       backdate,
+		egress:         egr,
+		browser:        browser,
+		unspsc:         unspsc,
+		initTimeout:    initTimeout,
+		pageTimeout:    pageTimeout,
+		pageRetries:    *pageRetries,
+		workers:        *scrapeWorkers,
+		maxRunDuration: maxRunDuration,
+		schedules:      schedules,
+		holidays:       holidays,
 	}
-
-	c.responsesMu.Lock()
-	defer c.responsesMu.Unlock()
-
-	if len(c.responses) == 0 {
-		return nil, "", errors.New("no responses")
+	if imapURL != "" {
+		if sc.mailbox, err = parseMailbox(imapURL, imapPassword); err != nil {
+			fatalf("parsing -imap: %v", err)
+		}
+	}
+	var hc *healthcheck
+	if healthcheckURL != "" {
+		if hc, err = parseHealthcheck(healthcheckURL); err != nil {
+			fatalf("parsing -healthcheck-url: %v", err)
+		}
+	}
+	if responsesDir != "" {
+		if !filepath.IsAbs(responsesDir) {
+			responsesDir = filepath.Join(filepath.Dir(dbFile), responsesDir)
+		}
+		sc.archive = &responseArchive{dir: responsesDir, keep: responsesKeep}
 	}
 
-	r := c.responses[0]
-	c.responses = c.responses[1:]
-
-	var tenders []Tender
-	for _, d := range r.Data {
-		var t Tender
-
-		id, rest, ok := strings.Cut(d.Title, " ")
-		if !ok {
-			return nil, "", fmt.Errorf("cutting title %q", d.Title)
+	var dryRun bool
+	newDigester := func() *digester {
+		var provider emailProvider
+		switch emailProviderName {
+		case "sendgrid":
+			if sendgridAPIKey != "" {
+				provider = sendgridProvider{apiKey: sendgridAPIKey}
+			}
+		case "mailgun":
+			if mailgunAPIKey != "" {
+				if mailgunAPIBase == "" {
+					mailgunAPIBase = "https://api.mailgun.net"
+				}
+				provider = mailgunProvider{apiKey: mailgunAPIKey, domain: mailgunDomain, apiBase: mailgunAPIBase}
+			}
+		case "postmark":
+			if postmarkServerToken != "" {
+				if postmarkMessageStream == "" {
+					postmarkMessageStream = "outbound"
+				}
+				provider = postmarkProvider{serverToken: postmarkServerToken, messageStream: postmarkMessageStream}
+			}
+		case "ses":
+			if provider, err = newSESProvider(ctx, sesRegion, sesConfigurationSet); err != nil {
+				fatal(err)
+			}
+		case "mx":
+			p := mxProvider{helo: mxHelo}
+			if p.helo == "" {
+				if p.helo, err = os.Hostname(); err != nil {
+					fatal(err)
+				}
+			}
+			if dkimKey != "" {
+				if dkimDomain == "" {
+					_, dkimDomain, _ = strings.Cut(fromEmail, "@")
+				}
+				if p.dkim, err = loadDKIMSigner(dkimKey, dkimDomain, dkimSelector); err != nil {
+					fatal(err)
+				}
+			}
+			provider = p
+		default:
+			fatalf("unknown email provider %q", emailProviderName)
 		}
 
-		rest = strings.TrimSpace(rest)
-		rest = strings.TrimPrefix(rest, "-")
-		rest = unprintableRe.ReplaceAllString(rest, "")
-		rest = strings.TrimSpace(rest)
-		rest = squeezeRe.ReplaceAllString(rest, " ")
+		if dryRun {
+			provider = printProvider{os.Stdout}
+		}
 
-		t.ID = id
-		t.URL = c.u.ResolveReference(&url.URL{Path: "/Module/Tenders/en/Tender/Detail/" + d.ID}).String()
-		t.Description = rest
-		t.Agency = "Halifax Regional Municipality"
+		d := &digester{
+			filters:     recipientFilters,
+			closingSoon: closingSoonWithin,
+			links:       linkShortener{st: st, base: shortLinkBase},
 
-		t.IssuedDate, err = time.Parse("Mon Jan 2, 2006 3:04:05 PM", d.DateAvailableDisplay)
-		if err != nil {
-			return nil, "", fmt.Errorf("parsing issued date: %w", err)
-		}
+			maxBidSecurity:        maxBidSecurity,
+			maxBidSecurityPercent: maxBidSecurityPercent,
+			skipLocalOnly:         skipLocalOnly,
+			agreements:            splitList(requireAgreements),
+			unspscPrefixes:        splitList(unspscFilter),
+			keywords:              keywordFilter{include: keywordList(includeKeywords), exclude: keywordList(excludeKeywords)},
 
-		t.CloseDate, err = time.Parse("Mon Jan 2, 2006 3:04:05 PM", d.DateClosingDisplay)
-		if err != nil {
-			return nil, "", fmt.Errorf("parsing close date: %w", err)
+			questionReminderWithin: questionReminderWithin,
+			closingReminderWithin:  closingReminderWithin,
+			notifyTimeout:          notifyTimeout,
+			quietPeriod:            quietPeriod,
+			force:                  force,
+			skipNotify:             skipNotify,
+			dryRun:                 dryRun,
+			out:                    os.Stdout,
 		}
-
-		now := time.Now()
-		if t.IssuedDate.Year() == 9999 {
-			t.IssuedDate = now
+		if twilioAccountSID != "" && twilioAuthToken != "" && twilioFrom != "" {
+			tw := twilio{accountSID: twilioAccountSID, authToken: twilioAuthToken, from: twilioFrom}
+			d.sms, d.voice = tw, tw
 		}
-		if t.CloseDate.Year() == 9999 {
-			t.CloseDate = now
+		if dryRun {
+			d.sms, d.voice = printGateway{os.Stdout}, printGateway{os.Stdout}
+			// Don't create short links that nothing was sent with.
+			d.links.base = ""
 		}
 
-		tenders = append(tenders, t)
-	}
+		for _, name := range strings.Split(channelNames, ",") {
+			switch name {
+			case "email":
+				if provider == nil {
+					continue
+				}
+				d.email = &notifier{
+					provider:  provider,
+					fromName:  fromName,
+					fromEmail: fromEmail,
+					subject:   sources.subject(),
 
-	time.Sleep(5 * time.Second)
+					inlineImages: inlineImages,
 
-	next := c.p.GetByLabel("next page")
-	if ok, err := next.IsEnabled(playwright.LocatorIsEnabledOptions{Timeout: ptr(10000.0)}); err != nil {
-		return nil, "", fmt.Errorf("checking next enabled: %w", err)
-	} else if ok {
-		nextToken = "next"
-	}
+					disableClickTracking: disableClickTracking,
+					closingSoon:          closingSoonWithin["email"],
+					attachCalendar:       attachCalendar,
+					brands:               sources.brands(),
+					recordLink:           recordLink,
+					holidays:             holidays,
 
-	return tenders, nextToken, nil
-}
-
-func (c *Client) Close() error {
-	if c.b != nil {
-		if err := c.b.Close(); err != nil {
-			return err
-		}
-		c.b = nil
-	}
-	if c.pw != nil {
-		if err := c.pw.Stop(); err != nil {
-			return err
+					sendInterval: sendInterval,
+				}
+				if d.email.utm, err = url.ParseQuery(utm); err != nil {
+					fatalf("parsing -utm: %v", err)
+				}
+				if emailTemplate != "" {
+					if d.email.tmpl, err = loadDigestTemplate(emailTemplate); err != nil {
+						fatalf("parsing -email-template: %v", err)
+					}
+				}
+				if logoFile != "" {
+					if d.email.logo, err = os.ReadFile(logoFile); err != nil {
+						fatal(err)
+					}
+					d.email.logoType = imageType(logoFile, d.email.logo)
+				}
+			case "slack":
+				if slackWebhookURL == "" {
+					fatalf("-channels slack needs SLACK_WEBHOOK_URL")
+				}
+				sl := slack{webhookURL: slackWebhookURL, subject: sources.subject(), closingSoon: closingSoonWithin["slack"]}
+				if dryRun {
+					sl.out = os.Stdout
+				}
+				d.others = append(d.others, sl)
+			case "webhook":
+				if webhookURL == "" {
+					fatalf("-channels webhook needs WEBHOOK_URL")
+				}
+				wh := webhook{url: webhookURL}
+				if dryRun {
+					wh.out = os.Stdout
+				}
+				d.others = append(d.others, wh)
+			case "hubspot", "salesforce":
+				var c crm
+				if name == "hubspot" {
+					if hubspotToken == "" {
+						fatalf("-channels hubspot needs HUBSPOT_TOKEN")
+					}
+					c = hubspot{token: hubspotToken, idProperty: cmp.Or(*crmIDField, "tender_id"), apiBase: "https://api.hubapi.com"}
+				} else {
+					if salesforceURL == "" || salesforceClientID == "" || salesforceClientSecret == "" {
+						fatalf("-channels salesforce needs SALESFORCE_URL, SALESFORCE_CLIENT_ID and SALESFORCE_CLIENT_SECRET")
+					}
+					c = salesforce{url: salesforceURL, clientID: salesforceClientID, clientSecret: salesforceClientSecret, externalID: cmp.Or(*crmIDField, "Tender_ID__c"), auth: new(salesforceAuth)}
+				}
+				ch := crmChannel{crm: c, filter: keywordFilter{include: keywordList(*crmInclude), exclude: keywordList(*crmExclude)}, fields: crmFieldTemplates[name]}
+				if dryRun {
+					ch.out = os.Stdout
+				}
+				d.others = append(d.others, ch)
+			default:
+				fatalf("unknown channel %q", name)
+			}
 		}
-		c.pw = nil
-	}
-	return nil
-}
 
-func (c *Client) init(ctx context.Context) error {
-	if c.ready {
-		return nil
-	}
-
-	err := playwright.Install(&playwright.RunOptions{Verbose: false, Browsers: []string{"chromium"}})
-	if err != nil {
-		return fmt.Errorf("installing playwright: %w", err)
+		if *opsTo != "" && !dryRun && !skipNotify {
+			emails, slackURL, err := parseOpsTo(*opsTo)
+			if err != nil {
+				fatalf("parsing -ops-to: %v", err)
+			}
+			d.ops = &opsDigest{to: emails, provider: provider, from: &mail.Address{Name: fromName, Address: fromEmail}, subject: sources.subject()}
+			if slackURL != "" {
+				d.ops.slack = &slack{webhookURL: slackURL}
+			} else if provider == nil {
+				fatalf("-ops-to with email addresses needs an email provider configured")
+			}
+		}
+		return d
 	}
 
-	pw, err := playwright.Run()
-	if err != nil {
-		return fmt.Errorf("running playwright: %w", err)
+	cmd := fs.Arg(0)
+	if replayDir != "" && cmd != "scrape" {
+		fatalf("-replay only works with scrape")
 	}
-	// playwright.BrowserTypeLaunchOptions{Headless: ptr(false)}
-	browser, err := pw.Chromium.Launch()
-	if err != nil {
-		return fmt.Errorf("launching browser: %w", err)
-	}
-	bctx, err := browser.NewContext()
-	if err != nil {
-		return fmt.Errorf("creating context: %w", err)
-	}
-	page, err := bctx.NewPage()
-	if err != nil {
-		return fmt.Errorf("creating page: %w", err)
-	}
-
-	page.On("response", func(r playwright.Response) {
-		if !strings.Contains(r.URL(), "/Module/Tenders/en/Tender/Search/") {
+	switch cmd {
+	case "", "scrape":
+	case "notify":
+		nfs := flag.NewFlagSet("notify", flag.ExitOnError)
+		nfs.BoolVar(&dryRun, "dry-run", false, "write what would be sent to stdout instead of sending it, without marking anything notified")
+		resend := nfs.String("resend", "", "instead of notifying about what's pending, send the past email digest with this ID again, as it was")
+		resendTo := nfs.String("to", "", "with -resend, semicolon-separated addresses to send it to instead of its original recipients")
+		nfs.Parse(fs.Args()[1:])
+		if *resend != "" {
+			if err := newDigester().resend(ctx, st, *resend, splitList(strings.ReplaceAll(*resendTo, ";", ","))); err != nil {
+				fatal(err)
+			}
 			return
 		}
-
-		go func() {
-			b, err := r.Body()
+	case "list", "export":
+		lfs := flag.NewFlagSet(cmd, flag.ExitOnError)
+		since := lfs.String("since", "", "only tenders first seen on or after this date, as YYYY-MM-DD")
+		openOnly := lfs.Bool("open-only", false, "only tenders closing in the future")
+		format := "json"
+		if cmd == "export" {
+			lfs.StringVar(&format, "format", format, "json, one object per line, or csv")
+		}
+		lfs.Parse(fs.Args()[1:])
+		var from time.Time
+		if *since != "" {
+			if from, err = time.ParseInLocation(dateFormat, *since, time.Local); err != nil {
+				fatalf("parsing -since: %v", err)
+			}
+		}
+		ts, err := st.tendersSince(from)
+		if err != nil {
+			fatal(err)
+		}
+		if *openOnly {
+			ts = openTenders(ts, time.Now())
+		}
+		switch {
+		case cmd == "list":
+			err = printTenders(os.Stdout, ts)
+		case format == "json":
+			err = exportTenders(os.Stdout, st, ts, redact)
+		case format == "csv":
+			err = exportTendersCSV(os.Stdout, st, ts, redact)
+		default:
+			fatalf("unknown -format %q, want json or csv", format)
+		}
+		if err != nil {
+			fatal(err)
+		}
+		return
+	case "sources":
+		if err := printSources(os.Stdout, st); err != nil {
+			fatal(err)
+		}
+		return
+	case "volumes":
+		if err := printVolumes(os.Stdout, st); err != nil {
+			fatal(err)
+		}
+		return
+	case "ops":
+		ofs := flag.NewFlagSet("ops", flag.ExitOnError)
+		since := ofs.Duration("since", opsDigestInterval, "how far back to summarize")
+		ofs.Parse(fs.Args()[1:])
+		now := time.Now()
+		sum, err := st.opsSummary(now.Add(-*since), now)
+		if err != nil {
+			fatal(err)
+		}
+		if err := sum.write(os.Stdout); err != nil {
+			fatal(err)
+		}
+		return
+	case "pause", "resume":
+		if fs.NArg() != 2 {
+			fatalf("usage: tender-digest %s <email>", cmd)
+		}
+		op := st.pauseRecipient
+		if cmd == "resume" {
+			op = st.resumeRecipient
+		}
+		if err := op(fs.Arg(1), cliActor()); err != nil {
+			fatal(err)
+		}
+		return
+	case "notifications":
+		switch fs.Arg(1) {
+		case "":
+		case "pause":
+			err = st.pauseNotifications(cliActor())
+		case "resume":
+			err = st.resumeNotifications(cliActor())
+		default:
+			fatalf("usage: tender-digest notifications [pause | resume]")
+		}
+		if err != nil {
+			fatal(err)
+		}
+		paused, err := st.notificationsPaused()
+		if err != nil {
+			fatal(err)
+		}
+		if paused.IsZero() {
+			fmt.Println("notifications on")
+		} else {
+			fmt.Println("notifications paused since", paused.Format(time.RFC3339))
+		}
+		return
+	case "watch", "unwatch":
+		if fs.NArg() != 2 {
+			fatalf("usage: tender-digest %s <tender-id>", cmd)
+		}
+		op := st.watch
+		if cmd == "unwatch" {
+			op = st.unwatch
+		}
+		if err := op(fs.Arg(1)); err != nil {
+			fatal(err)
+		}
+		return
+	case "verify":
+		var cls []*Client
+		for _, spec := range sources {
+			cl, err := spec.client()
 			if err != nil {
-				return
+				fatal(err)
+			}
+			cls = append(cls, cl)
+		}
+		differ, err := verify(os.Stdout, cls, st)
+		if err != nil {
+			fatal(err)
+		}
+		if differ {
+			exit(1)
+		}
+		return
+	case "discrepancies":
+		dfs := flag.NewFlagSet("discrepancies", flag.ExitOnError)
+		since := dfs.Duration("since", 24*time.Hour, "compare tenders first seen within this long before -grace ago, such as the last day when run nightly")
+		grace := dfs.Duration("grace", 6*time.Hour, "leave out tenders first seen within this long, to give alert emails and the next scrape time to catch up")
+		dfs.Parse(fs.Args()[1:])
+		to := time.Now().Add(-*grace)
+		from := to.Add(-*since)
+		ds, err := st.discrepancies(from, to)
+		if err != nil {
+			fatal(err)
+		}
+		if err := printDiscrepancies(os.Stdout, ds, from, to); err != nil {
+			fatal(err)
+		}
+		if len(ds) > 0 {
+			exit(1)
+		}
+		return
+	case "show":
+		sfs := flag.NewFlagSet("show", flag.ExitOnError)
+		asOf := sfs.String("as-of", "", "show the tender as the portal listed it at this time, a date like 2024-11-01 for the end of that day or an RFC 3339 time")
+		sfs.Parse(fs.Args()[1:])
+		if sfs.NArg() != 1 {
+			fatalf("usage: tender-digest show [-as-of date] <tender-id>")
+		}
+		id := sfs.Arg(0)
+		var err error
+		if *asOf != "" {
+			at, perr := parseAsOf(*asOf)
+			if perr != nil {
+				fatal(perr)
+			}
+			err = printSnapshot(os.Stdout, st, id, at)
+			if err == sql.ErrNoRows {
+				fatalf("no snapshot of tender %s as of %s", id, *asOf)
 			}
-			var rt RawTenders
-			if err := json.Unmarshal(b, &rt); err != nil {
+		} else {
+			err = printTender(os.Stdout, st, id)
+		}
+		if err == sql.ErrNoRows {
+			fatalf("no tender %s", id)
+		}
+		if err != nil {
+			fatal(err)
+		}
+		return
+	case "similar":
+		if fs.NArg() != 2 {
+			fatalf("usage: tender-digest similar <tender-id>")
+		}
+		ts, err := st.similarTenders(fs.Arg(1), 10)
+		if err == sql.ErrNoRows {
+			fatalf("no tender %s", fs.Arg(1))
+		}
+		if err != nil {
+			fatal(err)
+		}
+		for _, t := range ts {
+			fmt.Printf("%.2f\t%s\t%s\t%s\n", t.Score, t.ID, t.CloseDate.Format(dateFormat), t.Description)
+		}
+		return
+	case "contacts":
+		if err := printContacts(os.Stdout, st); err != nil {
+			fatal(err)
+		}
+		return
+	case "links":
+		if err := printShortLinks(os.Stdout, st); err != nil {
+			fatal(err)
+		}
+		return
+	case "token":
+		switch {
+		case fs.Arg(1) == "create" && (fs.NArg() == 3 || fs.NArg() == 4):
+			scopes := "read"
+			if fs.NArg() == 4 {
+				scopes = fs.Arg(3)
+			}
+			token, err := st.createToken(fs.Arg(2), strings.Split(scopes, ","), cliActor())
+			if err != nil {
+				fatal(err)
+			}
+			fmt.Println(token)
+		case fs.Arg(1) == "list" && fs.NArg() == 2:
+			if err := printTokens(os.Stdout, st); err != nil {
+				fatal(err)
+			}
+		case fs.Arg(1) == "revoke" && fs.NArg() == 3:
+			if err := st.revokeToken(fs.Arg(2), cliActor()); err != nil {
+				fatal(err)
+			}
+		default:
+			fatalf("usage: tender-digest token create <name> [read,write] | token list | token revoke <name>")
+		}
+		return
+	case "docs":
+		ds := docStore{dir: documentsDir, st: st, extractors: docExtractors, alertKeywords: docAlerts}
+		switch {
+		case fs.Arg(1) == "add" && fs.NArg() == 4:
+			f, err := os.Open(fs.Arg(3))
+			if err != nil {
+				fatal(err)
+			}
+			defer f.Close()
+			doc, changed, err := ds.put(fs.Arg(2), filepath.Base(fs.Arg(3)), f)
+			if err != nil {
+				fatal(err)
+			}
+			if !changed {
+				fmt.Printf("%s unchanged at version %d\n", doc.Name, doc.Version)
 				return
 			}
-			c.responsesMu.Lock()
-			defer c.responsesMu.Unlock()
-			c.responses = append(c.responses, rt)
-		}()
-	})
+			fmt.Printf("%s stored as version %d (%s)\n", doc.Name, doc.Version, doc.Hash)
+			if err := ds.index(doc); err != nil {
+				fatal(err)
+			}
+		case fs.Arg(1) == "search" && fs.NArg() == 3:
+			ms, err := ds.search(fs.Arg(2))
+			if err != nil {
+				fatal(err)
+			}
+			for _, m := range ms {
+				fmt.Printf("%s\t%s\tv%d\t%s\n", m.TenderID, m.Name, m.Version, m.Snippet)
+			}
+		case fs.Arg(1) == "list" && fs.NArg() == 3:
+			docs, err := ds.documents(fs.Arg(2))
+			if err != nil {
+				fatal(err)
+			}
+			for _, d := range docs {
+				fmt.Printf("%s\tv%d\t%d\t%s\t%s\n", d.Name, d.Version, d.Size, d.Stored.Format(time.RFC3339), ds.path(d.Hash))
+			}
+		default:
+			fatalf("usage: tender-digest docs add <tender-id> <file> | docs list <tender-id> | docs search <query>")
+		}
+		return
+	case "feed":
+		if err := writeFeed(os.Stdout, st, sources.subject(), "", redact); err != nil {
+			fatal(err)
+		}
+		return
+	case "subscriber":
+		switch fs.Arg(1) {
+		case "add":
+			afs := flag.NewFlagSet("subscriber add", flag.ExitOnError)
+			sub := subscriber{}
+			afs.StringVar(&sub.Channel, "channel", "email", "how to send them the digest: email, sms or voice")
+			include := afs.String("include", "", "comma-separated keywords; only send them tenders mentioning one")
+			exclude := afs.String("exclude", "", "comma-separated keywords; don't send them tenders mentioning one")
+			agencies := afs.String("agencies", "", "comma-separated agencies; only send them tenders from one")
+			afs.Parse(fs.Args()[2:])
+			if afs.NArg() != 1 {
+				fatalf("usage: tender-digest subscriber add [-channel email|sms|voice] [-include k,k] [-exclude k,k] [-agencies a,a] <email or phone>")
+			}
+			sub.Target = afs.Arg(0)
+			sub.Include, sub.Exclude = keywordList(*include), keywordList(*exclude)
+			for _, a := range strings.Split(*agencies, ",") {
+				if a = strings.TrimSpace(a); a != "" {
+					sub.Agencies = append(sub.Agencies, a)
+				}
+			}
+			err = st.addSubscriber(sub, cliActor())
+		case "remove":
+			if fs.NArg() != 3 {
+				fatalf("usage: tender-digest subscriber remove <email or phone>")
+			}
+			err = st.removeSubscriber(fs.Arg(2), cliActor())
+		case "list":
+			var subs []subscriber
+			if subs, err = st.subscribers(); err == nil {
+				err = printSubscribers(os.Stdout, subs)
+			}
+		default:
+			fatalf("usage: tender-digest subscriber add | remove | list")
+		}
+		if err != nil {
+			fatal(err)
+		}
+		return
+	case "explain":
+		if fs.NArg() != 2 {
+			fatalf("usage: tender-digest explain <tender-id>")
+		}
+		if err := newDigester().explain(os.Stdout, st, fs.Arg(1)); err != nil {
+			fatal(err)
+		}
+		return
+	case "preview":
+		if fs.NArg() != 2 {
+			fatalf("usage: tender-digest preview <email or phone>")
+		}
+		if err := newDigester().preview(ctx, os.Stdout, st, fs.Arg(1)); err != nil {
+			fatal(err)
+		}
+		return
+	case "fetch-now", "ctl":
+		op := fs.Arg(1)
+		if cmd == "fetch-now" {
+			op = "fetch-now"
+		}
+		if controlSocket == "" {
+			fatalf("%s needs -control-socket, set to the one serve was started with", cmd)
+		}
+		if err := control(os.Stdout, controlSocket, op); err != nil {
+			fatal(err)
+		}
+		return
+	case "run":
+		sched := &runSchedule{holidays: holidays}
+		rfs := flag.NewFlagSet("run", flag.ExitOnError)
+		rfs.Var(sched, "interval", "how often to scrape and notify: a duration such as 6h, or a cron expression, optionally prefixed by CRON_TZ=<zone>")
+		metricsListen := rfs.String("metrics-listen", "", "if set, address to serve metrics about the latest runs and deliveries on at /metrics, in the Prometheus text format")
+		rfs.Parse(fs.Args()[1:])
+		if sched.String() == "" {
+			fatalf("usage: tender-digest run -interval <duration or cron expression>")
+		}
+		if *metricsListen != "" {
+			go func() { fatal(serveMetrics(*metricsListen, st, sources.names())) }()
+		}
+		// Keep the browser running between runs rather than starting one
+		// each time.
+		sc.session = &browserSession{egress: egr, config: browser}
+		defer sc.session.Close()
+		dg := newDigester()
+		daemon(ctx, sched, func(ctx context.Context) error {
+			ctx, stop := withDeadline(ctx, runTimeout)
+			defer stop()
+			hc.start()
+			err := runOnce(ctx, st, sc, dg, notifyPartial)
+			writeMetricsFile(st, metricsFile, sources.names())
+			dg.ops.sendIfDue(st, time.Now())
+			hc.finish(err)
+			return err
+		})
+		return
+	case "serve":
+		if err := serve(listen, publicListen, controlSocket, st, sc, newDigester(), redact, recordLink); err != nil {
+			fatal(err)
+		}
+		return
+	default:
+		fatalf("unknown command %q", cmd)
+	}
 
-	if _, err = page.Goto(c.u.String()); err != nil {
-		return fmt.Errorf("going to page: %w", err)
+	if cmd == "scrape" && replayDir != "" {
+		var cls []*Client
+		for _, spec := range sources {
+			cl, err := spec.client()
+			if err != nil {
+				fatal(err)
+			}
+			cl.unspsc = unspsc
+			cl.backdate = backdate
+			cls = append(cls, cl)
+		}
+		nt, err := replay(ctx, replayDir, cls, st)
+		if err != nil {
+			fatal(err)
+		}
+		// They're history, not news.
+		if err := st.markTendersNotified(nt); err != nil {
+			fatal(err)
+		}
+		slog.Info("stored tenders from replay, marking new ones notified", "new", len(nt), "dir", replayDir)
+		return
 	}
 
-	// page.get_by_role("button", name="Open Toggle Filters").click()
-	if err := page.GetByRole(*playwright.AriaRoleButton, playwright.PageGetByRoleOptions{Name: "Open Toggle Filters"}).Click(); err != nil {
-		return fmt.Errorf("clicking open toggle filters: %w", err)
+	ctx, stop := withDeadline(ctx, runTimeout)
+	defer stop()
+	hc.start()
+	switch cmd {
+	case "scrape":
+		started := time.Now()
+		var sum runSummary
+		sum = sc.scrape(ctx, st, false)
+		if sum.scraped() > 0 && len(sum.failed()) == sum.scraped() {
+			err = errors.New("all sources failed")
+		}
+		sum.log(started, err)
+	case "notify":
+		dg := newDigester()
+		err = dg.run(ctx, st, nil)
+		dg.ops.sendIfDue(st, time.Now())
+	default:
+		dg := newDigester()
+		err = runOnce(ctx, st, sc, dg, notifyPartial)
+		dg.ops.sendIfDue(st, time.Now())
 	}
-	// page.get_by_label("all", exact=True).click()
-	if err := page.GetByLabel("all", playwright.PageGetByLabelOptions{Exact: ptr(true)}).Click(); err != nil {
-		return fmt.Errorf("clicking all: %w", err)
+	writeMetricsFile(st, metricsFile, sources.names())
+	hc.finish(err)
+	if err != nil {
+		fatal(err)
 	}
+}
+
+type Tender struct {
+	ID          string
+	URL         string
+	Description string
+	Agency      string
+	IssuedDate  time.Time
+	CloseDate   time.Time
+	// Events are site visits and meetings mentioned in the tender's scope.
+	Events []tenderEvent
+	// BidSecurity is the bid bond or deposit required, if one is stated.
+	BidSecurity *bidSecurity
+	// TradeTerms are the trade agreements and supplier restrictions
+	// stated, if any.
+	TradeTerms *tradeTerms
+	// UNSPSC are the commodity codes the tender maps to.
+	UNSPSC []string
+	// Contacts are the people named to direct questions to.
+	Contacts []contact
+	// Detail is what the tender's detail page adds, if it's been fetched.
+	Detail *tenderDetail
 
-	c.pw = pw
-	c.b = browser
-	c.p = page
-	c.ready = true
-	return nil
+	// raw is the portal's item the tender was parsed from.
+	raw []byte
+	// detailID is the portal's ID for the tender's detail page.
+	detailID string
+	// cancelled is set when the portal lists the tender as cancelled.
+	cancelled bool
+	// status and addenda are the portal's status and addenda count, to
+	// notice changes with.
+	status  string
+	addenda int
+	// closeUnknown is set when the portal gave a placeholder close date,
+	// so CloseDate is just the time it was scraped.
+	closeUnknown bool
+	// closeDateOnly is set when CloseDate was read back from the store as
+	// just a date, as they were stored before their times of day were
+	// kept, so it's midnight UTC rather than a time in the portal's zone.
+	closeDateOnly bool
+	// observed, if set, is recorded as first_observed instead of now when
+	// the tender is stored for the first time, to backdate it.
+	observed time.Time
+	// source is the name of the source that first listed the tender, or
+	// "" if that isn't known.
+	source string
+	// listed, if set, is when the portal listed the tender like this,
+	// for listings that aren't from just now, such as replayed responses.
+	listed time.Time
 }
 
+var squeezeRe = regexp.MustCompile(`\s+`)
+
 type store struct {
 	db *sql.DB
+	// events, if set, gets an event for each change to the store worth
+	// following from outside.
+	events *eventLog
 }
 
 const dateFormat = "2006-01-02"
 
+// dateOnly reports whether t, an issued or close time read back from the
+// store, is just a date, as they were stored before their times of day
+// were kept.
+func dateOnly(t time.Time) bool {
+	return t.Location() == time.UTC && t.Equal(t.Truncate(24*time.Hour))
+}
+
+// formatStoredTime formats t, an issued or close time read back from the
+// store, to the minute, or as just a date if that's all there is.
+func formatStoredTime(t time.Time) string {
+	if dateOnly(t) {
+		return t.Format(dateFormat)
+	}
+	return t.Format("2006-01-02 15:04")
+}
+
 func (s store) add(t Tender) (bool, error) {
-	res, err := s.db.Exec("insert into tenders (id, url, description, agency, issued, close, first_observed) values (?, ?, ?, ?, ?, ?, ?) on conflict do nothing",
-		t.ID, t.URL, t.Description, t.Agency, t.IssuedDate.Format(dateFormat), t.CloseDate.Format(dateFormat), time.Now(),
+	observed := time.Now()
+	if !t.observed.IsZero() && t.observed.Before(observed) {
+		observed = t.observed
+	}
+	res, err := s.db.Exec("insert into tenders (id, url, description, agency, issued, close, first_observed, source) values (?, ?, ?, ?, ?, ?, ?, ?) on conflict do nothing",
+		t.ID, t.URL, t.Description, t.Agency, t.IssuedDate, t.CloseDate, observed, sql.NullString{String: t.source, Valid: t.source != ""},
 	)
 	if err != nil {
 		return false, fmt.Errorf("insert: %v", err)
@@ -296,25 +1076,50 @@ func (s store) add(t Tender) (bool, error) {
 	return ra > 0, nil
 }
 
-func (s store) maxObserved() (time.Time, error) {
+// maxObserved returns when the latest tender source first listed was first
+// observed, or the zero time if it hasn't listed any.
+func (s store) maxObserved(source string) (time.Time, error) {
 	var ts sql.NullString
-	if err := s.db.QueryRow("select max(first_observed) from tenders").Scan(&ts); err != nil {
+	if err := s.db.QueryRow("select max(first_observed) from tenders where source = ?", source).Scan(&ts); err != nil {
 		return time.Time{}, err
 	}
 	if !ts.Valid {
 		return time.Time{}, nil
 	}
-	t, err := time.Parse(dateFormat, ts.String)
-	if err != nil {
-		return time.Time{}, nil
+	// Older rows have just a date, and newer ones the driver's format.
+	for _, layout := range []string{"2006-01-02 15:04:05.999999999-07:00", "2006-01-02 15:04:05.999999999", time.RFC3339Nano, dateFormat} {
+		if t, err := time.Parse(layout, ts.String); err == nil {
+			return t, nil
+		}
 	}
-	return t, nil
+	slog.Warn("can't parse max first_observed", "value", ts.String)
+	return time.Time{}, nil
+}
+
+// listing is how much of a source's listing findNew got through.
+type listing struct {
+	Pages   int `json:"pages"`
+	Tenders int `json:"tenders"`
+}
+
+// responseCounts are the search responses the browser received on a run
+// that the response queue dropped, for overflowing or arriving too late,
+// and merged into one already queued.
+type responseCounts struct {
+	Dropped int `json:"responses_dropped,omitempty"`
+	Merged  int `json:"responses_merged,omitempty"`
 }
 
-func findNew(ctx context.Context, cl *Client, st store) ([]Tender, error) {
-	max, err := st.maxObserved()
+// findNew lists src's tenders, storing each as it goes so that what came
+// before a page that fails is kept, and returns the new ones with how much
+// was listed. A page that fails is retried up to retries times. If the
+// run's deadline passes, what was listed by then is returned without an
+// error.
+func findNew(ctx context.Context, src Source, st store, retries int) ([]Tender, listing, error) {
+	var l listing
+	max, err := st.maxObserved(src.Name())
 	if err != nil {
-		return nil, err
+		return nil, l, err
 	}
 	cutoff := max
 	if cutoff.IsZero() {
@@ -323,25 +1128,46 @@ func findNew(ctx context.Context, cl *Client, st store) ([]Tender, error) {
 	cutoff = cutoff.AddDate(0, -4, 0)
 
 	var nt []Tender
+	// seen and oldestIssued are what the listing covered, for spotting
+	// retracted tenders if it's complete.
+	seen := make(map[string]bool)
+	var oldestIssued time.Time
+	complete := true
 
 	var token string
 outer:
-	for {
-		ct, nextToken, err := cl.List(ctx, token)
+	for pages := 0; ; pages++ {
+		ct, nextToken, err := listWithRetries(ctx, src, token, pages+1, retries)
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) && pages > 0 {
+			slog.Warn("stopping with partial results", "source", src.Name(), "pages", pages, "err", err)
+			complete = false
+			break
+		}
 		if err != nil {
-			return nil, err
+			return nt, l, err
 		}
+		slog.Debug("listed page", "source", src.Name(), "page", pages+1, "tenders", len(ct))
+		l.Pages++
+		l.Tenders += len(ct)
 
 		for _, t := range ct {
-			isNew, err := st.add(t)
+			seen[t.ID] = true
+			if oldestIssued.IsZero() || t.IssuedDate.Before(oldestIssued) {
+				oldestIssued = t.IssuedDate
+			}
+
+			stored, isNew, err := storeTender(ctx, src, st, t)
 			if err != nil {
-				return nil, err
+				return nt, l, err
 			}
 			if isNew {
-				nt = append(nt, t)
+				nt = append(nt, stored)
 			}
 
 			if t.CloseDate.Before(cutoff) {
+				// What's older wasn't listed, so can't be taken for
+				// gone.
+				complete = false
 				break outer
 			}
 		}
@@ -352,47 +1178,144 @@ outer:
 		token = nextToken
 	}
 
-	return nt, nil
+	if pl, ok := src.(partialLister); ok && pl.stoppedShort() {
+		complete = false
+	}
+	if complete && len(seen) > 0 {
+		missing, err := st.retractMissing(src.Name(), seen, oldestIssued, time.Now())
+		if err != nil {
+			return nt, l, err
+		}
+		for _, id := range missing {
+			slog.Info("no longer listed before closing, marking it retracted", "tender", id, "source", src.Name())
+		}
+	}
+
+	return nt, l, nil
 }
 
-func ptr[T any](v T) *T {
-	return &v
+// pageRetryBackoff is how long to wait before retrying a page the first
+// time. Each retry after waits twice as long as the one before.
+const pageRetryBackoff = 10 * time.Second
+
+// listWithRetries lists page, at token, trying again up to retries times
+// if it fails. Anomalies failing the run in -strict mode aren't retried,
+// since listing again won't change them, and nothing is retried once ctx
+// is done.
+func listWithRetries(ctx context.Context, src Source, token string, page, retries int) ([]Tender, string, error) {
+	wait := pageRetryBackoff
+	for try := 0; ; try++ {
+		ts, next, err := src.List(ctx, token)
+		var ae anomalyError
+		if err == nil || try >= retries || ctx.Err() != nil || errors.As(err, &ae) {
+			return ts, next, err
+		}
+		slog.Warn("listing page failed, retrying", "source", src.Name(), "page", page, "retry", try+1, "wait", wait, "err", err)
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, "", err
+		case <-t.C:
+		}
+		wait *= 2
+	}
+}
+
+// storeTender stores t as listed by src, which may be nil for tenders not
+// scraped just now, fetching its detail page if it's new and src can. It
+// returns t, with its detail if it was fetched, and whether it's new.
+func storeTender(ctx context.Context, src Source, st store, t Tender) (Tender, bool, error) {
+	if src != nil {
+		t.source = src.Name()
+	}
+	isNew, err := st.add(t)
+	if err != nil {
+		return t, false, err
+	}
+	if !isNew && !t.listed.IsZero() {
+		// Storing a listing older than what's stored would record
+		// regressions as changes and undo retractions since.
+		last, err := st.lastListed(t.ID)
+		if err != nil {
+			return t, false, err
+		}
+		if t.listed.Before(last) {
+			return t, false, nil
+		}
+	}
+	if !isNew {
+		changes, err := st.update(t)
+		if err != nil {
+			return t, false, err
+		}
+		for _, c := range changes {
+			if c.Field != "addenda" {
+				continue
+			}
+			// Refetch the detail page for the new addenda's names.
+			if ds, ok := src.(detailer); ok && t.detailID != "" {
+				d, err := ds.Detail(ctx, t.detailID)
+				if err != nil {
+					slog.Warn("fetching detail", "tender", t.ID, "err", err)
+				} else if err := st.setDetail(t.ID, d); err != nil {
+					return t, false, err
+				}
+			}
+		}
+	}
+	if err := st.setState(t); err != nil {
+		return t, false, err
+	}
+	// Only what was listed just now says how the tender looks now.
+	if src != nil {
+		if err := st.snapshot(t.ID, t.raw, time.Now()); err != nil {
+			return t, false, err
+		}
+	}
+	if t.cancelled {
+		if err := st.retract(t.ID, retractedCancelled, time.Now()); err != nil {
+			return t, false, err
+		}
+	} else if err := st.unretract(t.ID); err != nil {
+		return t, false, err
+	}
+	if err := st.addEvents(t.ID, t.Events); err != nil {
+		return t, false, err
+	}
+	if err := st.setBidSecurity(t.ID, t.BidSecurity); err != nil {
+		return t, false, err
+	}
+	if err := st.setTradeTerms(t.ID, t.TradeTerms); err != nil {
+		return t, false, err
+	}
+	if err := st.setUNSPSC(t.ID, t.UNSPSC); err != nil {
+		return t, false, err
+	}
+	if err := st.setSeries(t.ID, t.Description); err != nil {
+		return t, false, err
+	}
+	if err := st.addContacts(t.ID, t.Contacts); err != nil {
+		return t, false, err
+	}
+	if isNew {
+		if err := st.recordRaw(t.ID, t.raw); err != nil {
+			return t, false, err
+		}
+		if ds, ok := src.(detailer); ok && t.detailID != "" {
+			d, err := ds.Detail(ctx, t.detailID)
+			if err != nil {
+				slog.Warn("fetching detail", "tender", t.ID, "err", err)
+			} else if err := st.setDetail(t.ID, d); err != nil {
+				return t, false, err
+			}
+			t.Detail = d
+		}
+		st.events.emit("tender_observed", t.ID, t)
+	}
+	return t, isNew, nil
 }
 
-type RawTenders struct {
-	Success bool `json:"success"`
-	Data    []struct {
-		ID                                         string `json:"Id"`
-		Title                                      string `json:"Title"`
-		Scope                                      string `json:"Scope"`
-		Status                                     string `json:"Status"`
-		Description                                string `json:"Description"`
-		DateAvailable                              string `json:"DateAvailable"`
-		DateAvailableDisplay                       string `json:"DateAvailableDisplay"` // Fri Nov 8, 2024 12:00:00 AM
-		DatePlannedIssue                           any    `json:"DatePlannedIssue"`
-		DatePlannedIssueDisplay                    string `json:"DatePlannedIssueDisplay"`
-		DateClosing                                string `json:"DateClosing"`
-		DateClosingDisplay                         string `json:"DateClosingDisplay"` // Mon Nov 25, 2024 2:00:59 PM
-		DaysLeft                                   int    `json:"DaysLeft"`
-		DaysLeftPublish                            int    `json:"DaysLeftPublish"`
-		Submitted                                  int    `json:"Submitted"`
-		PlanTakers                                 int    `json:"PlanTakers"`
-		Advertisements                             int    `json:"Advertisements"`
-		Documents                                  int    `json:"Documents"`
-		Addendums                                  int    `json:"Addendums"`
-		ShowSubmitted                              bool   `json:"ShowSubmitted"`
-		ShowPlanTakers                             bool   `json:"ShowPlanTakers"`
-		VendorIsRegistered                         bool   `json:"VendorIsRegistered"`
-		VendorHasBidInProgress                     bool   `json:"VendorHasBidInProgress"`
-		VendorHasMultipleActiveSubmissions         bool   `json:"VendorHasMultipleActiveSubmissions"`
-		FirstSubmissionID                          string `json:"FirstSubmissionId"`
-		ShowSubmitOnline                           bool   `json:"ShowSubmitOnline"`
-		ShowRegisterAsPlanTaker                    bool   `json:"ShowRegisterAsPlanTaker"`
-		AllowBidQuestionSubmission                 bool   `json:"AllowBidQuestionSubmission"`
-		OnlyRegisteredPlantakersCanSubmitQuestions bool   `json:"OnlyRegisteredPlantakersCanSubmitQuestions"`
-		IncludeSeconds                             bool   `json:"IncludeSeconds"`
-		TimeZoneLabel                              string `json:"TimeZoneLabel"`
-		IsEmployee                                 bool   `json:"IsEmployee"`
-	} `json:"data"`
-	Total int `json:"total"`
+func ptr[T any](v T) *T {
+	return &v
 }
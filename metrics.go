@@ -0,0 +1,267 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sourceMetrics is what a source's latest run did.
+type sourceMetrics struct {
+	source      string
+	last        time.Time
+	lastSuccess sql.NullTime
+	duration    time.Duration
+	// pages and tenders aren't known for runs from before they were
+	// recorded.
+	pages, tenders sql.NullInt64
+	// responsesDropped and responsesMerged are the search responses
+	// the response queue dropped and merged, likewise unknown for older
+	// runs.
+	responsesDropped, responsesMerged sql.NullInt64
+
+	new    int
+	failed bool
+}
+
+// channelMetrics is how the latest delivery over a channel went.
+type channelMetrics struct {
+	channel     string
+	last        time.Time
+	lastSuccess sql.NullTime
+	tenders     int
+	failed      bool
+}
+
+// latestRuns returns the latest run of each of sources that has run.
+func (s store) latestRuns(sources []string) ([]sourceMetrics, error) {
+	rows, err := s.db.Query(`select r.source, r.started, ok.started, r.duration_ms, r.pages, r.tenders, r.responses_dropped, r.responses_merged, r.new_tenders, r.error is not null
+		from runs r
+		left join runs ok on ok.id = (select max(id) from runs where source = r.source and error is null)
+		where r.id in (select max(id) from runs group by source)
+		order by r.source`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []sourceMetrics
+	for rows.Next() {
+		var m sourceMetrics
+		var ms int64
+		if err := rows.Scan(&m.source, &m.last, &m.lastSuccess, &ms, &m.pages, &m.tenders, &m.responsesDropped, &m.responsesMerged, &m.new, &m.failed); err != nil {
+			return nil, err
+		}
+		if !slices.Contains(sources, m.source) {
+			continue
+		}
+		m.duration = time.Duration(ms) * time.Millisecond
+		res = append(res, m)
+	}
+	return res, rows.Err()
+}
+
+// latestDeliveries returns the latest delivery over each channel.
+func (s store) latestDeliveries() ([]channelMetrics, error) {
+	rows, err := s.db.Query(`select d.channel, d.at, ok.at, d.tenders, d.error is not null
+		from deliveries d
+		left join deliveries ok on ok.id = (select max(id) from deliveries where channel = d.channel and error is null)
+		where d.id in (select max(id) from deliveries group by channel)
+		order by d.channel`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []channelMetrics
+	for rows.Next() {
+		var m channelMetrics
+		if err := rows.Scan(&m.channel, &m.last, &m.lastSuccess, &m.tenders, &m.failed); err != nil {
+			return nil, err
+		}
+		res = append(res, m)
+	}
+	return res, rows.Err()
+}
+
+// writeMetrics writes what the latest run of each of sources did and how
+// the latest delivery over each channel went to w, in the Prometheus text
+// format. They come from the store rather than the process, so they're
+// the same whichever command or daemon ran last.
+func (s store) writeMetrics(w io.Writer, sources []string) error {
+	runs, err := s.latestRuns(sources)
+	if err != nil {
+		return err
+	}
+	deliveries, err := s.latestDeliveries()
+	if err != nil {
+		return err
+	}
+
+	mw := &metricsWriter{w: w}
+	mw.family("tender_digest_source_up", "Whether the source's latest run succeeded.")
+	for _, m := range runs {
+		mw.sample("source", m.source, boolMetric(!m.failed))
+	}
+	mw.family("tender_digest_source_last_run_timestamp_seconds", "When the source's latest run started.")
+	for _, m := range runs {
+		mw.sample("source", m.source, unixMetric(m.last))
+	}
+	mw.family("tender_digest_source_last_success_timestamp_seconds", "When the source's latest successful run started.")
+	for _, m := range runs {
+		if m.lastSuccess.Valid {
+			mw.sample("source", m.source, unixMetric(m.lastSuccess.Time))
+		}
+	}
+	mw.family("tender_digest_source_scrape_duration_seconds", "How long the source's latest run took.")
+	for _, m := range runs {
+		mw.sample("source", m.source, m.duration.Seconds())
+	}
+	mw.family("tender_digest_source_pages_fetched", "Listing pages the source's latest run fetched.")
+	for _, m := range runs {
+		if m.pages.Valid {
+			mw.sample("source", m.source, float64(m.pages.Int64))
+		}
+	}
+	mw.family("tender_digest_source_tenders_scraped", "Tenders listed on the pages the source's latest run fetched.")
+	for _, m := range runs {
+		if m.tenders.Valid {
+			mw.sample("source", m.source, float64(m.tenders.Int64))
+		}
+	}
+	mw.family("tender_digest_source_new_tenders", "New tenders the source's latest run found.")
+	for _, m := range runs {
+		mw.sample("source", m.source, float64(m.new))
+	}
+	mw.family("tender_digest_source_search_responses_dropped", "Search responses the source's latest run dropped for overflowing the queue or arriving too late.")
+	for _, m := range runs {
+		if m.responsesDropped.Valid {
+			mw.sample("source", m.source, float64(m.responsesDropped.Int64))
+		}
+	}
+	mw.family("tender_digest_source_search_responses_merged", "Repeated search responses the source's latest run merged into one already queued.")
+	for _, m := range runs {
+		if m.responsesMerged.Valid {
+			mw.sample("source", m.source, float64(m.responsesMerged.Int64))
+		}
+	}
+
+	mw.family("tender_digest_notify_success", "Whether the latest delivery over the channel succeeded.")
+	for _, m := range deliveries {
+		mw.sample("channel", m.channel, boolMetric(!m.failed))
+	}
+	mw.family("tender_digest_notify_last_timestamp_seconds", "When the latest delivery over the channel was attempted.")
+	for _, m := range deliveries {
+		mw.sample("channel", m.channel, unixMetric(m.last))
+	}
+	mw.family("tender_digest_notify_last_success_timestamp_seconds", "When the latest successful delivery over the channel was.")
+	for _, m := range deliveries {
+		if m.lastSuccess.Valid {
+			mw.sample("channel", m.channel, unixMetric(m.lastSuccess.Time))
+		}
+	}
+	mw.family("tender_digest_notify_tenders", "Tenders the latest delivery over the channel was about.")
+	for _, m := range deliveries {
+		mw.sample("channel", m.channel, float64(m.tenders))
+	}
+	return mw.err
+}
+
+// metricsWriter writes gauges in the Prometheus text format, keeping the
+// first error.
+type metricsWriter struct {
+	w    io.Writer
+	name string
+	err  error
+}
+
+var metricLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// family starts the gauge name, with help.
+func (mw *metricsWriter) family(name, help string) {
+	mw.name = name
+	mw.printf("# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+}
+
+// sample writes a value of the current gauge with one label.
+func (mw *metricsWriter) sample(label, value string, v float64) {
+	mw.printf("%s{%s=\"%s\"} %s\n", mw.name, label, metricLabelEscaper.Replace(value), strconv.FormatFloat(v, 'f', -1, 64))
+}
+
+func (mw *metricsWriter) printf(format string, args ...any) {
+	if mw.err == nil {
+		_, mw.err = fmt.Fprintf(mw.w, format, args...)
+	}
+}
+
+func boolMetric(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func unixMetric(t time.Time) float64 {
+	return float64(t.UnixMilli()) / 1000
+}
+
+// metricsHandler serves the metrics of sources.
+func metricsHandler(st store, sources []string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := st.writeMetrics(w, sources); err != nil {
+			slog.Error("writing metrics", "err", err)
+		}
+	}
+}
+
+// serveMetrics serves just the metrics of sources on addr, at /metrics.
+func serveMetrics(addr string, st store, sources []string) error {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", metricsHandler(st, sources))
+	slog.Info("metrics listening", "addr", addr)
+	return http.ListenAndServe(addr, mux)
+}
+
+// writeMetricsFile replaces path with the metrics of sources, for
+// node_exporter's textfile collector, which needs it replaced in one go
+// rather than written in place. It logs rather than returns errors so a
+// run's outcome isn't changed by failing to export it.
+func writeMetricsFile(st store, path string, sources []string) {
+	if path == "" {
+		return
+	}
+	if err := replaceFile(path, func(w io.Writer) error { return st.writeMetrics(w, sources) }); err != nil {
+		slog.Warn("writing metrics file", "path", path, "err", err)
+	}
+}
+
+// replaceFile writes path with write through a temporary file in the
+// same directory, renamed over it once complete.
+func replaceFile(path string, write func(io.Writer) error) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(0o644); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
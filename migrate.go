@@ -0,0 +1,111 @@
+package main
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrationFiles are the schema's migrations, named like 0002_scope.sql
+// and applied in order of the number. Once a migration has been released
+// it shouldn't change; add another instead.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migration is one of migrationFiles.
+type migration struct {
+	version int
+	name    string
+	sql     string
+}
+
+// migrations returns the embedded migrations in order.
+func migrations() ([]migration, error) {
+	paths, err := fs.Glob(migrationFiles, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+	var res []migration
+	for _, p := range paths {
+		num, name, ok := strings.Cut(strings.TrimSuffix(path.Base(p), ".sql"), "_")
+		v, err := strconv.Atoi(num)
+		if !ok || err != nil || v <= 0 {
+			return nil, fmt.Errorf("migration %s should be named like 0002_name.sql", p)
+		}
+		b, err := migrationFiles.ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, migration{version: v, name: name, sql: string(b)})
+	}
+	slices.SortFunc(res, func(a, b migration) int { return a.version - b.version })
+	for i := 1; i < len(res); i++ {
+		if res[i].version == res[i-1].version {
+			return nil, fmt.Errorf("two migrations numbered %d", res[i].version)
+		}
+	}
+	return res, nil
+}
+
+// schemaVersion returns the version of the last migration applied to db,
+// or 0 if none have been.
+func schemaVersion(db *sql.DB) (int, error) {
+	var v sql.NullInt64
+	if err := db.QueryRow("select max(version) from schema_version").Scan(&v); err != nil {
+		return 0, err
+	}
+	return int(v.Int64), nil
+}
+
+// migrate applies the migrations db hasn't had yet, each in a transaction
+// along with recording it in schema_version.
+func migrate(db *sql.DB) error {
+	if _, err := db.Exec("create table if not exists schema_version (version integer primary key, name text, applied datetime)"); err != nil {
+		return err
+	}
+	ms, err := migrations()
+	if err != nil {
+		return err
+	}
+	current, err := schemaVersion(db)
+	if err != nil {
+		return err
+	}
+	if latest := ms[len(ms)-1].version; current > latest {
+		return fmt.Errorf("database is at schema version %d, newer than the %d this build knows about", current, latest)
+	}
+
+	for _, m := range ms {
+		if m.version <= current {
+			continue
+		}
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(m.sql); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %04d_%s: %w", m.version, m.name, err)
+		}
+		if _, err := tx.Exec("insert into schema_version (version, name, applied) values (?, ?, ?)", m.version, m.name, time.Now()); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("insert schema version: %v", err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("migration %04d_%s: %w", m.version, m.name, err)
+		}
+		// Creating a database isn't worth mentioning, upgrading one is.
+		if current > 0 {
+			slog.Info("applied migration", "version", m.version, "name", m.name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,301 @@
+-- The schema as it was before migrations were tracked. Everything is
+-- created if it doesn't exist, so databases from before then adopt it
+-- as they are.
+--
+-- Comments on the line before a table describe it, and those after a
+-- column describe the column, with "references table.column" noting
+-- what it refers to. db schema prints them.
+
+-- Tenders seen on the portals, one row per listing.
+create table if not exists tenders (
+	id text primary key, -- the portal's tender number, prefixed by the portal's subdomain for portals besides Halifax's
+	url text, -- the tender's detail page on the portal
+	description text,
+	agency text, -- who issued the tender
+	issued datetime,
+	close datetime, -- when bids are due, or when it was scraped if the portal didn't say
+	first_observed datetime -- when the tender was first scraped
+);
+
+-- Scrapes of each source.
+create table if not exists runs (
+	id integer primary key,
+	source text, -- the source's name, usually its URL
+	started datetime,
+	duration_ms integer,
+	new_tenders integer,
+	error text -- why the run failed, or empty if it didn't
+);
+
+-- Recipients who have paused or resumed their digests.
+create table if not exists subscriptions (
+	email text primary key, -- the email address or phone number
+	paused_at datetime -- when they paused, or null if they've resumed
+);
+
+-- Who gets the digest, and their preferences.
+create table if not exists subscribers (
+	id integer primary key,
+	channel text, -- email, sms or voice
+	target text, -- the email address or phone number
+	include text, -- comma-separated keywords; only tenders mentioning one are sent
+	exclude text, -- comma-separated keywords; tenders mentioning one aren't sent
+	agencies text, -- comma-separated agencies; only their tenders are sent
+	created datetime,
+	unique (channel, target)
+);
+
+-- Stored document contents, by hash, shared by the documents with them.
+create table if not exists blobs (
+	hash text primary key, -- SHA-256 of the contents, hex encoded
+	size integer,
+	refs integer -- how many documents have the contents
+);
+
+-- Versions of tender documents added to the document store.
+create table if not exists documents (
+	tender_id text, -- references tenders.id
+	name text,
+	version integer, -- counts up from 1 as the document changes
+	hash text, -- references blobs.hash
+	stored datetime,
+	primary key (tender_id, name, version)
+);
+
+-- Text extracted from documents, for full-text search.
+create virtual table if not exists document_text using fts5 (
+	tender_id unindexed, -- references tenders.id
+	name unindexed,
+	version unindexed,
+	text
+);
+
+-- Tenders whose documents are watched for changes.
+create table if not exists watches (
+	tender_id text primary key, -- references tenders.id
+	added datetime
+);
+
+-- Alert keywords found in documents.
+create table if not exists document_alerts (
+	id integer primary key,
+	tender_id text, -- references tenders.id
+	name text, -- the document's name
+	version integer, -- the document's version
+	keyword text,
+	found datetime,
+	notified datetime -- when it went out in a digest, or null if it hasn't yet
+);
+
+-- Site visits, meetings and question deadlines mentioned in tenders.
+create table if not exists tender_events (
+	tender_id text, -- references tenders.id
+	kind text, -- site visit, pre-bid meeting or question deadline
+	at datetime,
+	mandatory boolean,
+	primary key (tender_id, kind, at)
+);
+
+-- Reminders of question deadlines.
+create table if not exists question_reminders (
+	tender_id text, -- references tenders.id
+	at datetime, -- the deadline
+	sent datetime,
+	primary key (tender_id, at)
+);
+
+-- Bid bonds and deposits tenders require.
+create table if not exists bid_security (
+	tender_id text primary key, -- references tenders.id
+	amount real, -- in dollars, or 0 if it's a percentage
+	percent real -- of the bid, or 0 if it's an amount
+);
+
+-- Trade agreements and supplier restrictions tenders state.
+create table if not exists trade_terms (
+	tender_id text primary key, -- references tenders.id
+	agreements text, -- comma-separated trade agreements, such as CFTA
+	local_only boolean -- whether only local suppliers may bid
+);
+
+-- Commodity codes tenders map to.
+create table if not exists tender_unspsc (
+	tender_id text, -- references tenders.id
+	code text, -- UNSPSC code
+	primary key (tender_id, code)
+);
+
+-- Searches with subscribers sent the tenders matching them.
+create table if not exists saved_searches (
+	id integer primary key,
+	name text,
+	query text,
+	created datetime
+);
+
+-- Subscribers to saved searches.
+create table if not exists search_subscriptions (
+	id integer primary key,
+	search_id integer, -- references saved_searches.id
+	channel text, -- email, sms or voice
+	target text, -- the email address or phone number
+	unique (search_id, channel, target)
+);
+
+-- Tokens for the API.
+create table if not exists api_tokens (
+	id integer primary key,
+	name text unique,
+	hash text unique, -- SHA-256 of the token; the token itself isn't kept
+	scopes text, -- comma-separated, such as read and write
+	created datetime,
+	last_used datetime,
+	revoked datetime -- null unless revoked
+);
+
+-- Short links used in texts.
+create table if not exists short_links (
+	token text primary key, -- the end of the short link
+	url text unique, -- where it goes
+	created datetime,
+	clicks integer,
+	last_click datetime
+);
+
+-- Portal responses tenders were parsed from, as fetched.
+create table if not exists raw_tenders (
+	tender_id text primary key, -- references tenders.id
+	fetched datetime,
+	data blob -- the portal's JSON for the tender
+);
+
+-- Series of tenders reissued or continued under related numbers.
+create table if not exists tender_series (
+	tender_id text primary key, -- references tenders.id
+	series_key text -- shared by tenders in the same series
+);
+
+create index if not exists tender_series_key on tender_series (series_key);
+
+-- People named in tenders to direct questions to.
+create table if not exists contacts (
+	email text primary key,
+	name text,
+	first_seen datetime,
+	last_seen datetime
+);
+
+-- Which tenders name which contacts.
+create table if not exists tender_contacts (
+	tender_id text, -- references tenders.id
+	email text, -- references contacts.email
+	primary key (tender_id, email)
+);
+
+-- Tenders stored before notifying was tracked were dealt with by the
+-- run that stored them, so they're marked notified when the table is
+-- first created.
+create temp table notified_missing as
+	select count(*) = 0 as missing from sqlite_master where type = 'table' and name = 'notified_tenders';
+-- Tenders that have gone out in a digest; the rest are pending.
+create table if not exists notified_tenders (
+	tender_id text primary key, -- references tenders.id
+	at datetime
+);
+insert into notified_tenders (tender_id, at)
+	select id, first_observed from tenders where (select missing from temp.notified_missing);
+drop table temp.notified_missing;
+
+-- What tenders' detail pages add to their listings.
+create table if not exists tender_details (
+	tender_id text primary key, -- references tenders.id
+	scope text,
+	fetched datetime
+);
+
+-- Documents and addenda listed on tenders' detail pages.
+create table if not exists tender_files (
+	tender_id text, -- references tenders.id
+	kind text, -- document or addendum
+	position integer, -- order on the page, from 0
+	name text,
+	posted text, -- as the page shows it
+	primary key (tender_id, kind, position)
+);
+
+-- Tenders withdrawn before closing, cancelled on the portal or gone from
+-- its listing.
+create table if not exists tender_retractions (
+	tender_id text primary key, -- references tenders.id
+	at datetime,
+	reason text,
+	notified datetime -- when it went out in a digest, or null if it hasn't yet
+);
+
+-- The portal's status and addenda count as last seen, to notice changes.
+create table if not exists tender_state (
+	tender_id text primary key, -- references tenders.id
+	status text,
+	addenda integer
+);
+
+-- Changes noticed to tenders after they were first seen.
+create table if not exists tender_changes (
+	id integer primary key,
+	tender_id text, -- references tenders.id
+	field text, -- what changed, such as close or status
+	old text,
+	new text,
+	at datetime,
+	notified datetime -- when it went out in a digest, or null if it hasn't yet
+);
+
+-- Notifications sent on each channel.
+create table if not exists deliveries (
+	id integer primary key,
+	channel text, -- such as email, slack or webhook
+	at datetime,
+	tenders integer, -- how many tenders it was about
+	error text -- why it failed, or empty if it didn't
+);
+
+-- Which tenders each delivery was about.
+create table if not exists delivery_tenders (
+	delivery_id integer, -- references deliveries.id
+	tender_id text, -- references tenders.id
+	primary key (delivery_id, tender_id)
+);
+
+-- Email digests sent, to look up and resend.
+create table if not exists digests (
+	id text primary key, -- as shown in the digest's footer
+	sent datetime,
+	subject text,
+	recipients text, -- semicolon-separated email addresses
+	failed_sources text, -- comma-separated sources that failed on the run, making it partial
+	updates text -- JSON of the alerts, reminders, retractions and changes it had
+);
+
+-- The tenders in each digest, in the order they were shown.
+create table if not exists digest_tenders (
+	digest_id text, -- references digests.id
+	position integer, -- from 0
+	tender_id text, -- references tenders.id
+	primary key (digest_id, position)
+);
+
+-- Settings changed at runtime, such as notifications_paused.
+create table if not exists settings (
+	key text primary key,
+	value text
+);
+
+-- Who changed what, from the command line, API or admin UI.
+create table if not exists audit_log (
+	id integer primary key,
+	at datetime,
+	actor text,
+	action text,
+	subject text,
+	detail text
+);
@@ -0,0 +1,19 @@
+-- Versions of each tender as the portal listed it, to see a tender as it
+-- was at some time. Tenders recorded before this start with the item
+-- they were first seen as.
+
+-- Each distinct version of a tender's portal item, from when it was first
+-- seen that way until last seen that way.
+create table if not exists tender_snapshots (
+	id integer primary key,
+	tender_id text, -- references tenders.id
+	observed datetime, -- when the portal first listed the tender this way
+	last_observed datetime, -- when the portal last listed the tender this way
+	data blob -- the portal's JSON for the tender, without countdowns like DaysLeft
+);
+
+create index if not exists tender_snapshots_tender on tender_snapshots (tender_id, observed);
+
+insert into tender_snapshots (tender_id, observed, last_observed, data)
+	select tender_id, fetched, fetched, data from raw_tenders
+	where tender_id not in (select tender_id from tender_snapshots);
@@ -0,0 +1,10 @@
+-- Reminders sent about announced tenders closing soon, so each close date
+-- is only reminded about once.
+
+-- Closing reminders sent, by tender and the close date they were about.
+create table if not exists closing_reminders (
+	tender_id text, -- references tenders.id
+	close datetime, -- the close date reminded about
+	sent datetime,
+	primary key (tender_id, close)
+);
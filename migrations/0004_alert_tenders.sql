@@ -0,0 +1,10 @@
+-- Tenders first found in portal alert emails, so scraping can fill in
+-- their dates quietly and what it missed can be told apart.
+
+-- Tenders first found in alert emails rather than by scraping.
+create table if not exists alert_tenders (
+	tender_id text primary key, -- references tenders.id
+	via text, -- how the email came in: webhook or imap
+	received datetime,
+	reconciled datetime -- when scraping first listed the tender, filling in its dates
+);
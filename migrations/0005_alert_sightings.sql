@@ -0,0 +1,14 @@
+-- Every tender listed in portal alert emails, not just those first found
+-- there, to compare what the emails and scraping each saw.
+
+-- Tenders listed in alert emails, and when.
+create table if not exists alert_sightings (
+	tender_id text primary key, -- references tenders.id
+	via text, -- how the first email listing it came in: webhook or imap
+	first_received datetime,
+	last_received datetime
+);
+
+insert into alert_sightings (tender_id, via, first_received, last_received)
+	select tender_id, via, received, received from alert_tenders
+	where tender_id not in (select tender_id from alert_sightings);
@@ -0,0 +1,5 @@
+-- How much of each source's listing a run got through, for metrics to
+-- show scraping that succeeds without finding anything.
+
+alter table runs add column pages integer; -- listing pages fetched
+alter table runs add column tenders integer; -- tenders listed on them
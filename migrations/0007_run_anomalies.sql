@@ -0,0 +1,4 @@
+-- Runs whose volume was far off what the source usually lists on that
+-- weekday, which usually means the portal's filters weren't applied.
+
+alter table runs add column anomaly text; -- why the run's volume looked wrong, or null if it didn't
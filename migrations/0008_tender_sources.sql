@@ -0,0 +1,4 @@
+-- Which source first listed each tender, so a source added later is
+-- judged on its own run history rather than the other sources'.
+
+alter table tenders add column source text; -- the source that first listed it, or null if it was stored before sources were recorded or found only in an alert email
@@ -0,0 +1,8 @@
+-- Tenders a channel failed to deliver while others succeeded, so the
+-- channel gets them on a later run rather than never.
+
+create table if not exists undelivered_tenders (
+	channel text not null, -- the channel's name, such as slack or hubspot
+	tender_id text not null, -- references tenders.id
+	primary key (channel, tender_id)
+);
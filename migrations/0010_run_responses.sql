@@ -0,0 +1,6 @@
+-- Search responses the browser received on each run that weren't listed,
+-- for metrics to show a response queue overflowing or a portal repeating
+-- its searches.
+
+alter table runs add column responses_dropped integer; -- dropped for overflowing the queue or arriving too late
+alter table runs add column responses_merged integer; -- repeats of one already queued
@@ -0,0 +1,9 @@
+-- Updates a channel or email recipient failed to get while others got
+-- them, like undelivered_tenders, so they're sent on a later run. Email
+-- recipients are kept apart, as channel email:<address>, so a recipient
+-- whose send failed doesn't hold the rest back or get them again.
+
+create table if not exists undelivered_updates (
+	channel text primary key, -- the channel's name, or email:<address>
+	updates text not null -- JSON, as in digests.updates
+);
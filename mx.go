@@ -0,0 +1,332 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"sort"
+	"strings"
+	"time"
+)
+
+// mxProvider delivers mail straight to each recipient domain's MX hosts
+// rather than through a third-party provider. Receivers are unlikely to
+// accept such mail without a DKIM signature for the sending domain, so it is
+// meant as a last resort.
+type mxProvider struct {
+	helo string
+	dkim *dkimSigner
+}
+
+type header struct {
+	name, value string
+}
+
+func (p mxProvider) send(ctx context.Context, m message) error {
+	raw, err := p.render(m)
+	if err != nil {
+		return err
+	}
+
+	byDomain := make(map[string][]string)
+	for _, a := range m.bcc {
+		i := strings.LastIndex(a.Address, "@")
+		if i < 0 {
+			return fmt.Errorf("no domain in address %q", a.Address)
+		}
+		domain := strings.ToLower(a.Address[i+1:])
+		byDomain[domain] = append(byDomain[domain], a.Address)
+	}
+
+	var errs []error
+	for domain, rcpts := range byDomain {
+		if err := p.deliver(ctx, domain, m.from.Address, rcpts, raw); err != nil {
+			errs = append(errs, fmt.Errorf("delivering to %s: %w", domain, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (p mxProvider) render(m message) ([]byte, error) {
+	contentHdrs, body, err := mimeBody(m)
+	if err != nil {
+		return nil, err
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	_, fromDomain, _ := strings.Cut(m.from.Address, "@")
+
+	hdrs := []header{
+		{"From", m.from.String()},
+		{"To", m.from.String()},
+		{"Subject", mime.QEncoding.Encode("utf-8", m.subject)},
+		{"Date", time.Now().Format(time.RFC1123Z)},
+		{"Message-ID", "<" + hex.EncodeToString(id) + "@" + fromDomain + ">"},
+		{"MIME-Version", "1.0"},
+	}
+	hdrs = append(hdrs, contentHdrs...)
+
+	if p.dkim != nil {
+		sig, err := p.dkim.sign(hdrs, body)
+		if err != nil {
+			return nil, fmt.Errorf("dkim signing: %w", err)
+		}
+		hdrs = append([]header{{"DKIM-Signature", sig}}, hdrs...)
+	}
+
+	var b bytes.Buffer
+	for _, h := range hdrs {
+		b.WriteString(h.name + ": " + h.value + "\r\n")
+	}
+	b.WriteString("\r\n")
+	b.Write(body)
+	return b.Bytes(), nil
+}
+
+// mimeBody returns the encoded body of m along with the headers describing
+// it. Messages with attachments become multipart/mixed, with the content
+// as the first part.
+func mimeBody(m message) ([]header, []byte, error) {
+	hs, body, err := contentBody(m)
+	if err != nil || len(m.attachments) == 0 {
+		return hs, body, err
+	}
+
+	var b bytes.Buffer
+	mw := multipart.NewWriter(&b)
+
+	h := make(textproto.MIMEHeader)
+	for _, ch := range hs {
+		h.Set(ch.name, ch.value)
+	}
+	w, err := mw.CreatePart(h)
+	if err != nil {
+		return nil, nil, err
+	}
+	w.Write(body)
+
+	for _, f := range m.attachments {
+		h := make(textproto.MIMEHeader)
+		h.Set("Content-Type", f.contentType)
+		h.Set("Content-Transfer-Encoding", "base64")
+		h.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": f.filename}))
+		w, err := mw.CreatePart(h)
+		if err != nil {
+			return nil, nil, err
+		}
+		writeBase64(w, f.data)
+	}
+	if err := mw.Close(); err != nil {
+		return nil, nil, err
+	}
+
+	return []header{
+		{"Content-Type", mime.FormatMediaType("multipart/mixed", map[string]string{"boundary": mw.Boundary()})},
+	}, b.Bytes(), nil
+}
+
+// contentBody returns the encoded content of m along with the headers
+// describing it. Messages with a plain text alternative become
+// multipart/alternative, with the text first as the least preferred.
+func contentBody(m message) ([]header, []byte, error) {
+	hs, body, err := htmlBody(m)
+	if err != nil || m.text == "" {
+		return hs, body, err
+	}
+
+	text, err := quotedPrintable(m.text)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var b bytes.Buffer
+	mw := multipart.NewWriter(&b)
+
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Type", `text/plain; charset="utf-8"`)
+	h.Set("Content-Transfer-Encoding", "quoted-printable")
+	w, err := mw.CreatePart(h)
+	if err != nil {
+		return nil, nil, err
+	}
+	w.Write(text)
+
+	h = make(textproto.MIMEHeader)
+	for _, ch := range hs {
+		h.Set(ch.name, ch.value)
+	}
+	w, err = mw.CreatePart(h)
+	if err != nil {
+		return nil, nil, err
+	}
+	w.Write(body)
+	if err := mw.Close(); err != nil {
+		return nil, nil, err
+	}
+
+	return []header{
+		{"Content-Type", mime.FormatMediaType("multipart/alternative", map[string]string{"boundary": mw.Boundary()})},
+	}, b.Bytes(), nil
+}
+
+// htmlBody returns the encoded HTML of m along with the headers describing
+// it. Messages with inline images become multipart/related.
+func htmlBody(m message) ([]header, []byte, error) {
+	html, err := quotedPrintable(m.html)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(m.inline) == 0 {
+		return []header{
+			{"Content-Type", `text/html; charset="utf-8"`},
+			{"Content-Transfer-Encoding", "quoted-printable"},
+		}, html, nil
+	}
+
+	var b bytes.Buffer
+	mw := multipart.NewWriter(&b)
+
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Type", `text/html; charset="utf-8"`)
+	h.Set("Content-Transfer-Encoding", "quoted-printable")
+	w, err := mw.CreatePart(h)
+	if err != nil {
+		return nil, nil, err
+	}
+	w.Write(html)
+
+	for _, i := range m.inline {
+		h := make(textproto.MIMEHeader)
+		h.Set("Content-Type", i.contentType)
+		h.Set("Content-Transfer-Encoding", "base64")
+		h.Set("Content-ID", "<"+i.cid+">")
+		h.Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": i.filename()}))
+		w, err := mw.CreatePart(h)
+		if err != nil {
+			return nil, nil, err
+		}
+		writeBase64(w, i.data)
+	}
+	if err := mw.Close(); err != nil {
+		return nil, nil, err
+	}
+
+	return []header{
+		{"Content-Type", mime.FormatMediaType("multipart/related", map[string]string{"boundary": mw.Boundary(), "type": "text/html"})},
+	}, b.Bytes(), nil
+}
+
+// quotedPrintable returns s quoted-printable encoded.
+func quotedPrintable(s string) ([]byte, error) {
+	var b bytes.Buffer
+	qp := quotedprintable.NewWriter(&b)
+	if _, err := qp.Write([]byte(s)); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// writeBase64 writes data to w base64 encoded in 76 character lines.
+func writeBase64(w io.Writer, data []byte) {
+	enc := base64.StdEncoding.EncodeToString(data)
+	for len(enc) > 76 {
+		io.WriteString(w, enc[:76]+"\r\n")
+		enc = enc[76:]
+	}
+	io.WriteString(w, enc+"\r\n")
+}
+
+func (p mxProvider) deliver(ctx context.Context, domain, from string, rcpts []string, raw []byte) error {
+	mxs, err := net.DefaultResolver.LookupMX(ctx, domain)
+	if err != nil {
+		var dnsErr *net.DNSError
+		if !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+			return fmt.Errorf("looking up mx: %w", err)
+		}
+	}
+	sort.Slice(mxs, func(i, j int) bool { return mxs[i].Pref < mxs[j].Pref })
+
+	var hosts []string
+	for _, mx := range mxs {
+		hosts = append(hosts, strings.TrimSuffix(mx.Host, "."))
+	}
+	if len(hosts) == 0 {
+		// No MX records means the domain itself is the mail host.
+		hosts = []string{domain}
+	}
+
+	var errs []error
+	for _, host := range hosts {
+		err := p.deliverHost(ctx, host, from, rcpts, raw)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", host, err))
+	}
+	return errors.Join(errs...)
+}
+
+func (p mxProvider) deliverHost(ctx context.Context, host, from string, rcpts []string, raw []byte) error {
+	d := net.Dialer{Timeout: 30 * time.Second}
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(host, "25"))
+	if err != nil {
+		return err
+	}
+	// The SMTP client doesn't take a context, so give up by closing the
+	// connection under it.
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if err := c.Hello(p.helo); err != nil {
+		return err
+	}
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return fmt.Errorf("starttls: %w", err)
+		}
+	}
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	for _, rcpt := range rcpts {
+		if err := c.Rcpt(rcpt); err != nil {
+			return fmt.Errorf("rcpt %s: %w", rcpt, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(raw); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
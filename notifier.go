@@ -1,59 +1,474 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"image"
+	"image/color"
+	"image/png"
+	"log/slog"
+	"maps"
+	"mime"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
-
-	sendgrid "github.com/sendgrid/sendgrid-go"
-	"github.com/sendgrid/sendgrid-go/helpers/mail"
 )
 
 type notifier struct {
-	apiKey string
+	provider emailProvider
 
 	fromName, fromEmail string
 	toEmails            []string
+	// filters are recipients' own filters. Those with one get their own
+	// message.
+	filters recipientFilters
+	// updated are the tenders the updates being sent are about, by ID, to
+	// apply filters to updates too.
+	updated map[string]Tender
+	// backlog is what recipients failed to get before, by address. Those
+	// with one get their own message.
+	backlog map[string]channelBacklog
+
+	// st, if set, records each digest sent.
+	st *store
+	// subject is the start of the email subject, followed by the time.
+	subject string
+
+	// inlineImages embeds the logo and status badges as inline cid:
+	// images. Without it, badges are rendered as text and no logo is shown.
+	inlineImages bool
+	logo         []byte
+	logoType     string
+
+	// tmpl, if set, replaces digestTmpl.
+	tmpl *template.Template
+
+	// utm is added to the query of tender links, so clicks from digests
+	// can be told apart in analytics.
+	utm url.Values
+	// disableClickTracking asks the provider not to rewrite links for
+	// click tracking.
+	disableClickTracking bool
+
+	// closingSoon is how close to its close date a tender gets a closing
+	// soon badge.
+	closingSoon time.Duration
+
+	// attachCalendar attaches an iCalendar file with the close dates and
+	// events of the tenders it covers.
+	attachCalendar calendarAttachment
+
+	// brands are how agencies' sections are shown in digests with more
+	// than one agency.
+	brands agencyBrands
+
+	// recordLink links tender IDs to the team's own records of them.
+	recordLink recordLinkTemplate
+
+	// holidays is used to flag tenders closing the day after a holiday.
+	holidays holidayCalendar
+
+	// closingReminder makes messages reminders about announced tenders
+	// closing soon rather than digests of new ones. They aren't recorded
+	// as digests.
+	closingReminder bool
+
+	// failedSources are sources that failed this run, to mark the digest
+	// as partial.
+	failedSources []string
+
+	// sendInterval is the minimum time between API calls, to stay under
+	// provider rate limits when a run sends more than one message.
+	sendInterval time.Duration
+	lastSend     time.Time
 }
 
-func (n notifier) notify(ts []Tender) error {
-	if len(ts) == 0 {
-		return nil
+// emailProvider delivers a rendered message.
+type emailProvider interface {
+	send(ctx context.Context, m message) error
+}
+
+// message is a rendered digest. It is addressed to its sender with the
+// actual recipients in bcc, so recipients don't see each other.
+type message struct {
+	from    *mail.Address
+	bcc     []*mail.Address
+	subject string
+	html    string
+	// text is the plain text alternative to html.
+	text   string
+	inline []inlineImage
+	// attachments are regular file attachments, shown after the message.
+	attachments []attachment
+
+	disableClickTracking bool
+}
+
+// inlineImage is an image attachment referenced from the message HTML as
+// cid:<cid>.
+type inlineImage struct {
+	cid         string
+	contentType string
+	data        []byte
+}
+
+type attachment struct {
+	filename    string
+	contentType string
+	data        []byte
+}
+
+func (i inlineImage) filename() string {
+	ext := ".bin"
+	if exts, _ := mime.ExtensionsByType(i.contentType); len(exts) > 0 {
+		ext = exts[0]
 	}
+	return i.cid + ext
+}
 
-	if len(n.toEmails) == 0 {
-		return nil
+// providerError is a send rejected by an email provider, with the
+// provider's response translated into something actionable where possible.
+type providerError struct {
+	provider string
+	status   int
+	msg      string
+
+	// rateLimited is set when the provider asked us to slow down.
+	// retryAfter is how long it asked us to wait, if it said.
+	rateLimited bool
+	retryAfter  time.Duration
+}
+
+func (e *providerError) Error() string {
+	if e.status == 0 {
+		return e.provider + ": " + e.msg
+	}
+	return fmt.Sprintf("%s: %s (status %d)", e.provider, e.msg, e.status)
+}
+
+// maxRateLimitRetries is how many times a rate limited send is retried
+// before giving up.
+const maxRateLimitRetries = 5
+
+// recipientErrors are the errors sending to some of a digest's
+// recipients, by address.
+type recipientErrors map[string]error
+
+func (re recipientErrors) Error() string {
+	var msgs []string
+	for _, to := range slices.Sorted(maps.Keys(re)) {
+		msgs = append(msgs, to+": "+re[to].Error())
 	}
+	return strings.Join(msgs, "\n")
+}
 
-	hmsg := "<p>These new HRM tenders have appeared:</p>\n\n"
+func (re recipientErrors) Unwrap() []error { return slices.Collect(maps.Values(re)) }
 
-	const df = "Mon, 02 Jan 2006"
-	for _, t := range ts {
-		hmsg += "<h3><a href=\"" + t.URL + "\">" + t.Description + "</a></h3>\n"
-		hmsg += "Issued " + t.IssuedDate.Format(df) + " and closing " + t.CloseDate.Format(df) + "\n\n"
+// notify sends the digest of ts and u to toEmails, separately to those with
+// filters or a backlog of their own. If some sends fail, the error is
+// recipientErrors.
+func (n *notifier) notify(ctx context.Context, ts []Tender, u updates) error {
+	var everyone []string
+	errs := make(recipientErrors)
+	for _, to := range n.toEmails {
+		f, ok := n.filters[to]
+		b := n.backlog[to]
+		if (!ok || f.empty()) && b.empty() {
+			everyone = append(everyone, to)
+			continue
+		}
+		rts := append(slices.Clip(b.tenders), ts...)
+		ru := b.updates.merge(u)
+		if ok {
+			rts, ru = f.apply(to, rts), f.applyUpdates(n.updated, ru)
+		}
+		if err := n.notifyTo(ctx, []string{to}, rts, ru); err != nil {
+			errs[to] = err
+		}
 	}
+	if err := n.notifyTo(ctx, everyone, ts, u); err != nil {
+		for _, to := range everyone {
+			errs[to] = err
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
 
-	from := mail.NewEmail(n.fromName, n.fromEmail)
+// notifyTo sends the digest of ts and u to toEmails.
+func (n *notifier) notifyTo(ctx context.Context, toEmails []string, ts []Tender, u updates) error {
+	if len(ts) == 0 && u.empty() {
+		return nil
+	}
 
-	var tos []*mail.Email
-	for _, te := range n.toEmails {
-		em, err := mail.ParseEmail(te)
+	if len(toEmails) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	id := digestID(now, toEmails, ts)
+	m, err := n.render(id, now, ts, u)
+	if err != nil {
+		return err
+	}
+	for _, te := range toEmails {
+		em, err := mail.ParseAddress(te)
 		if err != nil {
 			return err
 		}
-		tos = append(tos, em)
+		m.bcc = append(m.bcc, em)
+	}
+
+	if err := n.send(ctx, m); err != nil {
+		return err
+	}
+	kind := "digest"
+	if n.closingReminder {
+		kind = "closing reminder"
+	}
+	slog.Info("sent "+kind, "digest", id, "recipients", len(toEmails), "tenders", len(ts))
+	if n.st != nil && !n.closingReminder {
+		// Sent is sent: failing to record it mustn't fail the channel and
+		// have the digest sent again.
+		if err := n.st.recordDigest(id, now, m.subject, toEmails, ts, u, n.failedSources); err != nil {
+			slog.Error("recording digest", "digest", id, "err", err)
+		}
 	}
+	return nil
+}
 
-	emsg := mail.NewContent("text/html", hmsg)
+// render renders the digest with id of ts and u as of at. Tenders are
+// listed by close date, then ID, so the same digest always renders the
+// same way.
+func (n *notifier) render(id string, at time.Time, ts []Tender, u updates) (message, error) {
+	m := message{
+		from:    &mail.Address{Name: n.fromName, Address: n.fromEmail},
+		subject: n.subject + " at " + at.Format(time.RFC822),
 
-	email := mail.NewV3Mail()
-	email.SetFrom(from)
-	email.Subject = "New HRM Tenders at " + time.Now().Format(time.RFC822)
-	pers := mail.NewPersonalization()
-	pers.AddTos(from)
-	pers.AddBCCs(tos...)
-	email.AddPersonalizations(pers)
-	email.AddContent(emsg)
+		disableClickTracking: n.disableClickTracking,
+	}
 
-	client := sendgrid.NewSendClient(n.apiKey)
-	_, err := client.Send(email)
-	return err
+	if n.closingReminder {
+		m.subject = n.subject + " closing soon at " + at.Format(time.RFC822)
+	}
+	if len(n.failedSources) > 0 {
+		m.subject += " (partial)"
+	}
+
+	d := digest{ID: id, At: at, FromName: n.fromName, InlineImages: n.inlineImages, ClosingReminder: n.closingReminder, Alerts: u.alerts, Reminders: u.reminders, Retractions: u.retractions, FailedSources: n.failedSources, brands: n.brands}
+	var changes []tenderChange
+	d.StatusChanges, changes = splitStatusChanges(u.changes)
+	for _, c := range changes {
+		if len(d.Updated) == 0 || d.Updated[len(d.Updated)-1].TenderID != c.TenderID {
+			d.Updated = append(d.Updated, updatedTender{TenderID: c.TenderID, Description: c.Description})
+		}
+		d.Updated[len(d.Updated)-1].Changes = append(d.Updated[len(d.Updated)-1].Changes, c)
+	}
+	if n.inlineImages && len(n.logo) > 0 {
+		m.inline = append(m.inline, inlineImage{cid: "logo", contentType: n.logoType, data: n.logo})
+		d.Logo = true
+	}
+	var soon []Tender
+	groups := groupListings(ts)
+	slices.SortStableFunc(groups, func(a, b []Tender) int {
+		if c := a[0].CloseDate.Compare(b[0].CloseDate); c != 0 {
+			return c
+		}
+		return strings.Compare(a[0].ID, b[0].ID)
+	})
+	for _, g := range groups {
+		t := g[0]
+		dt := digestTender{Tender: t, Link: withQuery(t.URL, n.utm), RecordLink: n.recordLink.For(t.ID), ClosingSoon: closingSoon(t, n.closingSoon, at)}
+		for _, o := range g[1:] {
+			dt.AlsoListed = append(dt.AlsoListed, otherListing{Agency: n.brands.Name(o.Agency), Link: withQuery(o.URL, n.utm)})
+		}
+		dt.AfterHoliday, _ = n.holidays.afterHoliday(t.CloseDate)
+		if dt.ClosingSoon && n.inlineImages && !m.hasInline("closing-soon") {
+			m.inline = append(m.inline, inlineImage{cid: "closing-soon", contentType: "image/png", data: closingSoonBadge()})
+		}
+		d.Tenders = append(d.Tenders, dt)
+		if t.Agency != portalAgency {
+			d.OtherAgencies = true
+		}
+		if dt.ClosingSoon {
+			soon = append(soon, t)
+		}
+	}
+	if d.OtherAgencies && n.inlineImages {
+		for _, a := range d.Agencies() {
+			if a.LogoCID != "" {
+				b := n.brands[a.Agency]
+				m.inline = append(m.inline, inlineImage{cid: a.LogoCID, contentType: b.logoType, data: b.logo})
+			}
+		}
+	}
+	switch {
+	case n.attachCalendar == closingSoonCalendar && len(soon) > 0:
+		m.attachments = append(m.attachments, attachment{filename: "closing-soon.ics", contentType: "text/calendar; charset=utf-8; method=PUBLISH", data: calendar(soon, at)})
+	case n.attachCalendar == allCalendar && len(d.Tenders) > 0:
+		var all []Tender
+		for _, dt := range d.Tenders {
+			all = append(all, dt.Tender)
+		}
+		m.attachments = append(m.attachments, attachment{filename: "tenders.ics", contentType: "text/calendar; charset=utf-8; method=PUBLISH", data: calendar(all, at)})
+	}
+
+	tmpl := digestTmpl
+	if n.tmpl != nil {
+		tmpl = n.tmpl
+	}
+	var hmsg strings.Builder
+	if err := tmpl.Execute(&hmsg, d); err != nil {
+		return message{}, fmt.Errorf("rendering digest: %w", err)
+	}
+	m.html = hmsg.String()
+
+	var tmsg strings.Builder
+	if err := digestTextTmpl.Execute(&tmsg, d); err != nil {
+		return message{}, fmt.Errorf("rendering plain text digest: %w", err)
+	}
+	m.text = tmsg.String()
+	return m, nil
+}
+
+func (m message) hasInline(cid string) bool {
+	for _, i := range m.inline {
+		if i.cid == cid {
+			return true
+		}
+	}
+	return false
+}
+
+// withQuery returns u with q added to its query. u is returned unchanged
+// if q is empty or u doesn't parse.
+func withQuery(u string, q url.Values) string {
+	if len(q) == 0 {
+		return u
+	}
+	pu, err := url.Parse(u)
+	if err != nil {
+		return u
+	}
+	pq := pu.Query()
+	for k, vs := range q {
+		pq[k] = vs
+	}
+	pu.RawQuery = pq.Encode()
+	return pu.String()
+}
+
+// closingSoonHorizons is, per channel, how close to its close date a
+// tender is considered closing soon. That gets it a badge in emails and
+// into the calendar attachment, and flagged in texts and calls.
+type closingSoonHorizons map[string]time.Duration
+
+func defaultClosingSoonHorizons() closingSoonHorizons {
+	return closingSoonHorizons{
+		"email": 7 * 24 * time.Hour,
+		"slack": 7 * 24 * time.Hour,
+		"sms":   48 * time.Hour,
+		"voice": 48 * time.Hour,
+	}
+}
+
+// Set implements flag.Value, taking channel=duration.
+func (h closingSoonHorizons) Set(s string) error {
+	ch, ds, ok := strings.Cut(s, "=")
+	if _, known := h[ch]; !ok || !known {
+		return fmt.Errorf("want email, slack, sms or voice=duration, got %q", s)
+	}
+	d, err := time.ParseDuration(ds)
+	if err != nil {
+		return err
+	}
+	h[ch] = d
+	return nil
+}
+
+func (h closingSoonHorizons) String() string {
+	var s []string
+	for ch, d := range h {
+		s = append(s, ch+"="+d.String())
+	}
+	slices.Sort(s)
+	return strings.Join(s, ",")
+}
+
+// closingSoon reports whether t is closing within the horizon of at.
+func closingSoon(t Tender, horizon time.Duration, at time.Time) bool {
+	return t.CloseDate.Sub(at) < horizon
+}
+
+// closingSoonBadge is a small orange dot, as a PNG.
+var closingSoonBadge = sync.OnceValue(func() []byte {
+	const size = 12
+	img := image.NewNRGBA(image.Rect(0, 0, size, size))
+	c := color.NRGBA{R: 0xe6, G: 0x7e, B: 0x22, A: 0xff}
+	for y := range size {
+		for x := range size {
+			dx, dy := float64(x)-size/2+0.5, float64(y)-size/2+0.5
+			if dx*dx+dy*dy <= size*size/4 {
+				img.Set(x, y, c)
+			}
+		}
+	}
+	var b bytes.Buffer
+	png.Encode(&b, img)
+	return b.Bytes()
+})
+
+func (n *notifier) send(ctx context.Context, m message) error {
+	for attempt := 0; ; attempt++ {
+		if err := sleep(ctx, n.sendInterval-time.Since(n.lastSend)); err != nil {
+			return err
+		}
+
+		err := n.provider.send(ctx, m)
+		n.lastSend = time.Now()
+
+		var pe *providerError
+		if errors.As(err, &pe) && pe.rateLimited && attempt < maxRateLimitRetries {
+			wait := pe.retryAfter
+			if wait <= 0 {
+				wait = time.Second << attempt
+			}
+			slog.Warn("rate limited, retrying", "provider", pe.provider, "wait", wait)
+			if err := sleep(ctx, wait); err != nil {
+				return err
+			}
+			continue
+		}
+		return err
+	}
+}
+
+// retryAfter returns how long a rate limited HTTP response asked us to
+// wait, preferring Retry-After and then X-RateLimit-Reset, or 0 if it
+// didn't say.
+func retryAfter(h http.Header) time.Duration {
+	if v := h.Get("Retry-After"); v != "" {
+		if secs, err := strconv.Atoi(v); err == nil {
+			return time.Duration(secs) * time.Second
+		}
+		if t, err := http.ParseTime(v); err == nil {
+			return max(time.Until(t), 0)
+		}
+	}
+	if v := h.Get("X-RateLimit-Reset"); v != "" {
+		if ts, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return max(time.Until(time.Unix(ts, 0)), 0)
+		}
+	}
+	return 0
 }
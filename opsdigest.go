@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"log/slog"
+	"net/mail"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// opsDigestInterval is how often the operator's summary goes out.
+const opsDigestInterval = 24 * time.Hour
+
+// opsDigestSentKey is the setting holding when the operator's summary
+// last went out.
+const opsDigestSentKey = "ops_digest_sent"
+
+// opsSummary is how the service did over a period, for its operator
+// rather than the people getting digests.
+type opsSummary struct {
+	from, to time.Time
+
+	runs []opsSourceRuns
+	// changes are the changes to known tenders seen.
+	changes int
+	// runErrors and deliveryErrors are the most recent failures, newest
+	// first.
+	runErrors, deliveryErrors []opsError
+	// anomalies are runs whose volume looked wrong, newest first.
+	anomalies []opsError
+
+	// pendingTenders and pendingUpdates are waiting to be notified about.
+	pendingTenders, pendingUpdates int
+
+	dbSize        int64
+	schemaVersion int
+	// applied are the migrations applied during the period, and pending
+	// those this build has that the store hasn't had yet.
+	applied, pending []string
+}
+
+// opsSourceRuns are a source's runs over a period.
+type opsSourceRuns struct {
+	source              string
+	runs, failures, new int
+}
+
+// opsError is a failed or unusual run of a source, or a failed delivery
+// over a channel.
+type opsError struct {
+	at    time.Time
+	where string
+	err   string
+}
+
+// opsErrorLimit is how many of each kind of error a summary lists.
+const opsErrorLimit = 10
+
+// opsSummary summarizes the runs and deliveries between from and to, and
+// the state of the store now.
+func (s store) opsSummary(from, to time.Time) (opsSummary, error) {
+	sum := opsSummary{from: from, to: to}
+
+	rows, err := s.db.Query(`select source, count(*), count(error), coalesce(sum(new_tenders), 0)
+		from runs where datetime(started) >= datetime(?) and datetime(started) < datetime(?)
+		group by source order by source`, from, to)
+	if err != nil {
+		return opsSummary{}, err
+	}
+	for rows.Next() {
+		var r opsSourceRuns
+		if err := rows.Scan(&r.source, &r.runs, &r.failures, &r.new); err != nil {
+			rows.Close()
+			return opsSummary{}, err
+		}
+		sum.runs = append(sum.runs, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return opsSummary{}, err
+	}
+
+	if err := s.db.QueryRow("select count(*) from tender_changes where datetime(at) >= datetime(?) and datetime(at) < datetime(?)", from, to).Scan(&sum.changes); err != nil {
+		return opsSummary{}, err
+	}
+	if sum.runErrors, err = s.opsErrors("select started, source, error from runs where error is not null and datetime(started) >= datetime(?) and datetime(started) < datetime(?) order by started desc limit ?", from, to); err != nil {
+		return opsSummary{}, err
+	}
+	if sum.anomalies, err = s.opsErrors("select started, source, anomaly from runs where anomaly is not null and datetime(started) >= datetime(?) and datetime(started) < datetime(?) order by started desc limit ?", from, to); err != nil {
+		return opsSummary{}, err
+	}
+	if sum.deliveryErrors, err = s.opsErrors("select at, channel, error from deliveries where error is not null and datetime(at) >= datetime(?) and datetime(at) < datetime(?) order by at desc limit ?", from, to); err != nil {
+		return opsSummary{}, err
+	}
+
+	pending, err := s.pendingTenders()
+	if err != nil {
+		return opsSummary{}, err
+	}
+	sum.pendingTenders = len(pending)
+	upd, err := s.pendingUpdates(0, to)
+	if err != nil {
+		return opsSummary{}, err
+	}
+	sum.pendingUpdates = len(upd.alerts) + len(upd.retractions) + len(upd.changes)
+
+	if err := s.db.QueryRow("select page_count * page_size from pragma_page_count(), pragma_page_size()").Scan(&sum.dbSize); err != nil {
+		return opsSummary{}, err
+	}
+
+	if sum.schemaVersion, err = schemaVersion(s.db); err != nil {
+		return opsSummary{}, err
+	}
+	rows, err = s.db.Query("select version, name from schema_version where datetime(applied) >= datetime(?) and datetime(applied) < datetime(?) order by version", from, to)
+	if err != nil {
+		return opsSummary{}, err
+	}
+	for rows.Next() {
+		var v int
+		var name string
+		if err := rows.Scan(&v, &name); err != nil {
+			rows.Close()
+			return opsSummary{}, err
+		}
+		sum.applied = append(sum.applied, fmt.Sprintf("%04d_%s", v, name))
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return opsSummary{}, err
+	}
+	ms, err := migrations()
+	if err != nil {
+		return opsSummary{}, err
+	}
+	for _, m := range ms {
+		if m.version > sum.schemaVersion {
+			sum.pending = append(sum.pending, fmt.Sprintf("%04d_%s", m.version, m.name))
+		}
+	}
+	return sum, nil
+}
+
+func (s store) opsErrors(query string, from, to time.Time) ([]opsError, error) {
+	rows, err := s.db.Query(query, from, to, opsErrorLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []opsError
+	for rows.Next() {
+		var e opsError
+		if err := rows.Scan(&e.at, &e.where, &e.err); err != nil {
+			return nil, err
+		}
+		res = append(res, e)
+	}
+	return res, rows.Err()
+}
+
+// failed reports whether anything failed or looked wrong over the
+// period.
+func (o opsSummary) failed() bool {
+	return len(o.runErrors) > 0 || len(o.anomalies) > 0 || len(o.deliveryErrors) > 0
+}
+
+// write writes the summary to w as plain text.
+func (o opsSummary) write(w io.Writer) error {
+	fmt.Fprintf(w, "From %s to %s\n\n", o.from.Format(time.RFC3339), o.to.Format(time.RFC3339))
+
+	var runs, failures, newTenders int
+	for _, r := range o.runs {
+		runs += r.runs
+		failures += r.failures
+		newTenders += r.new
+	}
+	fmt.Fprintf(w, "Runs: %d, %d failed\n", runs, failures)
+	fmt.Fprintf(w, "New tenders: %d\n", newTenders)
+	fmt.Fprintf(w, "Changes to known tenders: %d\n", o.changes)
+	if len(o.runs) > 0 {
+		fmt.Fprintln(w)
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "SOURCE\tRUNS\tFAILED\tNEW")
+		for _, r := range o.runs {
+			fmt.Fprintf(tw, "%s\t%d\t%d\t%d\n", r.source, r.runs, r.failures, r.new)
+		}
+		tw.Flush()
+	}
+
+	for _, errs := range []struct {
+		title string
+		errs  []opsError
+	}{{"Run errors", o.runErrors}, {"Unusual volumes", o.anomalies}, {"Delivery errors", o.deliveryErrors}} {
+		if len(errs.errs) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "\n%s, most recent first:\n", errs.title)
+		for _, e := range errs.errs {
+			fmt.Fprintf(w, "  %s %s: %s\n", e.at.Format(time.RFC3339), e.where, e.err)
+		}
+	}
+
+	fmt.Fprintf(w, "\nWaiting to be notified about: %d tenders, %d updates\n", o.pendingTenders, o.pendingUpdates)
+	fmt.Fprintf(w, "Database size: %.1f MiB\n", float64(o.dbSize)/(1<<20))
+	fmt.Fprintf(w, "Schema version: %d\n", o.schemaVersion)
+	if len(o.applied) > 0 {
+		fmt.Fprintf(w, "Migrations applied: %s\n", strings.Join(o.applied, ", "))
+	}
+	// Migrations are applied when the store is opened, so these are only
+	// there if something else opened it with an older build.
+	if len(o.pending) > 0 {
+		fmt.Fprintf(w, "Migrations waiting for the next run: %s\n", strings.Join(o.pending, ", "))
+	}
+	_, err := fmt.Fprintln(w)
+	return err
+}
+
+// slackMaxText is about the most text a Slack section takes, leaving room
+// for escaping and formatting.
+const slackMaxText = 2500
+
+// opsDigest sends the operator the summary of each day, by email or to a
+// Slack incoming webhook, separately from the digests.
+type opsDigest struct {
+	// to are email addresses, sent with provider from from.
+	to       []string
+	provider emailProvider
+	from     *mail.Address
+	// slack, if set, is posted to instead.
+	slack *slack
+	// subject prefixes the subject, to tell deployments apart.
+	subject string
+}
+
+// parseOpsTo parses -ops-to: email addresses, or a Slack incoming webhook
+// URL.
+func parseOpsTo(v string) (emails []string, slackURL string, err error) {
+	if strings.HasPrefix(v, "https://") || strings.HasPrefix(v, "http://") {
+		return nil, v, nil
+	}
+	for _, e := range splitList(v) {
+		a, err := mail.ParseAddress(e)
+		if err != nil {
+			return nil, "", fmt.Errorf("bad address %q: %w", e, err)
+		}
+		emails = append(emails, a.Address)
+	}
+	return emails, "", nil
+}
+
+// sendIfDue sends the summary of the time since the last one if it's been
+// opsDigestInterval, or of the last interval if there hasn't been one. It
+// logs rather than returns errors so a run's outcome isn't changed by
+// failing to report on it. o may be nil.
+func (o *opsDigest) sendIfDue(st store, now time.Time) {
+	if o == nil {
+		return
+	}
+	from := now.Add(-opsDigestInterval)
+	last, err := st.setting(opsDigestSentKey)
+	if err != nil {
+		slog.Error("sending ops digest", "err", err)
+		return
+	}
+	if last != "" {
+		t, err := time.Parse(time.RFC3339, last)
+		if err != nil {
+			slog.Error("sending ops digest", "err", fmt.Errorf("parsing %s: %w", opsDigestSentKey, err))
+			return
+		}
+		if now.Sub(t) < opsDigestInterval {
+			return
+		}
+		from = t
+	}
+
+	sum, err := st.opsSummary(from, now)
+	if err != nil {
+		slog.Error("sending ops digest", "err", err)
+		return
+	}
+	if err := o.send(sum); err != nil {
+		slog.Error("sending ops digest", "err", err)
+		return
+	}
+	if _, err := st.db.Exec("insert into settings (key, value) values (?, ?) on conflict (key) do update set value = excluded.value", opsDigestSentKey, now.UTC().Format(time.RFC3339)); err != nil {
+		slog.Error("sending ops digest", "err", fmt.Errorf("set %s: %v", opsDigestSentKey, err))
+		return
+	}
+	slog.Info("sent ops digest", "from", from.Format(time.RFC3339))
+}
+
+func (o *opsDigest) send(sum opsSummary) error {
+	subject := o.subject + " ops summary for " + sum.to.Format("Mon, 02 Jan 2006")
+	if sum.failed() {
+		subject += " (errors)"
+	}
+	var b bytes.Buffer
+	if err := sum.write(&b); err != nil {
+		return err
+	}
+
+	if o.slack != nil {
+		text := b.String()
+		if len(text) > slackMaxText {
+			text = text[:slackMaxText] + "\n…"
+		}
+		return o.slack.post(context.Background(), struct {
+			Text   string       `json:"text"`
+			Blocks []slackBlock `json:"blocks"`
+		}{subject, []slackBlock{
+			{Type: "header", Text: &slackText{Type: "plain_text", Text: subject}},
+			slackSection("```" + slackEscape.Replace(text) + "```"),
+		}})
+	}
+
+	m := message{from: o.from, subject: subject, text: b.String(), html: "<pre>" + html.EscapeString(b.String()) + "</pre>"}
+	for _, e := range o.to {
+		m.bcc = append(m.bcc, &mail.Address{Address: e})
+	}
+	return o.provider.send(context.Background(), m)
+}
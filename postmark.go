@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+type postmarkProvider struct {
+	serverToken   string
+	messageStream string
+}
+
+func (p postmarkProvider) send(ctx context.Context, m message) error {
+	var bcc []string
+	for _, a := range m.bcc {
+		bcc = append(bcc, a.String())
+	}
+
+	type attachment struct {
+		Name        string
+		Content     []byte
+		ContentType string
+		ContentID   string `json:",omitempty"`
+	}
+	var attachments []attachment
+	for _, i := range m.inline {
+		attachments = append(attachments, attachment{Name: i.filename(), Content: i.data, ContentType: i.contentType, ContentID: "cid:" + i.cid})
+	}
+	for _, f := range m.attachments {
+		attachments = append(attachments, attachment{Name: f.filename, Content: f.data, ContentType: f.contentType})
+	}
+
+	req := map[string]any{
+		"From":          m.from.String(),
+		"To":            m.from.String(),
+		"Bcc":           strings.Join(bcc, ","),
+		"Subject":       m.subject,
+		"HtmlBody":      m.html,
+		"TextBody":      m.text,
+		"MessageStream": p.messageStream,
+		"Attachments":   attachments,
+	}
+	if m.disableClickTracking {
+		req["TrackLinks"] = "None"
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	hreq, err := http.NewRequestWithContext(ctx, "POST", "https://api.postmarkapp.com/email", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	hreq.Header.Set("Accept", "application/json")
+	hreq.Header.Set("Content-Type", "application/json")
+	hreq.Header.Set("X-Postmark-Server-Token", p.serverToken)
+
+	resp, err := http.DefaultClient.Do(hreq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 300 {
+		return nil
+	}
+
+	b, _ := io.ReadAll(resp.Body)
+	pe := &providerError{provider: "postmark", status: resp.StatusCode, msg: strings.TrimSpace(string(b))}
+	var res struct {
+		ErrorCode int
+		Message   string
+	}
+	if json.Unmarshal(b, &res) == nil && res.Message != "" {
+		pe.msg = fmt.Sprintf("error code %d: %s", res.ErrorCode, res.Message)
+	}
+
+	// https://postmarkapp.com/developer/api/overview#error-codes
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		pe.rateLimited = true
+		pe.retryAfter = retryAfter(resp.Header)
+	case res.ErrorCode == 10:
+		pe.msg = "server token rejected, check POSTMARK_SERVER_TOKEN: " + pe.msg
+	case res.ErrorCode == 400 || res.ErrorCode == 401:
+		pe.msg = "from address is not a confirmed sender signature: " + pe.msg
+	case res.ErrorCode == 406:
+		pe.msg = "a recipient is inactive after bouncing or a spam complaint: " + pe.msg
+	case res.ErrorCode == 412:
+		pe.msg = "account pending approval, only same-domain recipients allowed: " + pe.msg
+	case res.ErrorCode == 1235:
+		pe.msg = "message stream " + p.messageStream + " not found: " + pe.msg
+	}
+	return pe
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// recordLinkTemplate is a URL for a tender's record in a system the team
+// keeps its own, such as SharePoint or a CRM, with {id} where the
+// tender's ID goes.
+type recordLinkTemplate string
+
+func (l *recordLinkTemplate) Set(v string) error {
+	if v != "" {
+		if !strings.Contains(v, "{id}") {
+			return fmt.Errorf("want a URL with {id} where the tender's ID goes, got %q", v)
+		}
+		if u, err := url.Parse(strings.ReplaceAll(v, "{id}", "x")); err != nil || u.Host == "" {
+			return fmt.Errorf("bad URL %q", v)
+		}
+	}
+	*l = recordLinkTemplate(v)
+	return nil
+}
+
+func (l *recordLinkTemplate) String() string { return string(*l) }
+
+// For returns the link to the record of the tender with id, or "" if
+// there's no template.
+func (l recordLinkTemplate) For(id string) string {
+	if l == "" {
+		return ""
+	}
+	return strings.ReplaceAll(string(l), "{id}", url.QueryEscape(id))
+}
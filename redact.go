@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// redactionRoles are who sees tenders with redactions applied: export for
+// the list and export commands, public for the public archive and feed,
+// and api for the token API.
+var redactionRoles = []string{"export", "public", "api"}
+
+// redactableFields are the parts of tenders redactions can leave out.
+// Leaving out contacts also blanks out email addresses in the tender's
+// text, where they were found.
+var redactableFields = []string{"contacts", "scope", "documents", "events", "bid_security", "trade_terms"}
+
+// redactions are, per role, the fields of tenders left out of what that
+// role sees, so shared datasets don't carry what's only meant for those
+// running the digest.
+type redactions map[string][]string
+
+// Set implements flag.Value, taking role=field,field.
+func (r redactions) Set(s string) error {
+	role, fields, ok := strings.Cut(s, "=")
+	if !ok || !slices.Contains(redactionRoles, role) {
+		return fmt.Errorf("want role=fields with role one of %s, got %q", strings.Join(redactionRoles, ", "), s)
+	}
+	for _, f := range splitList(fields) {
+		if !slices.Contains(redactableFields, f) {
+			return fmt.Errorf("unknown field %q, want one of %s", f, strings.Join(redactableFields, ", "))
+		}
+		if !slices.Contains(r[role], f) {
+			r[role] = append(r[role], f)
+		}
+	}
+	return nil
+}
+
+func (r redactions) String() string {
+	var s []string
+	for role, fields := range r {
+		s = append(s, role+"="+strings.Join(fields, ","))
+	}
+	slices.Sort(s)
+	return strings.Join(s, " ")
+}
+
+// apply leaves the fields redacted for role out of t, whose details
+// should already be loaded.
+func (r redactions) apply(role string, t *Tender) {
+	fields := r[role]
+	if len(fields) == 0 {
+		return
+	}
+	if t.Detail != nil {
+		// Details may be shared, so redact a copy.
+		d := *t.Detail
+		t.Detail = &d
+	}
+	for _, f := range fields {
+		switch f {
+		case "contacts":
+			t.Contacts = nil
+			t.Description = redactEmails(t.Description)
+			if t.Detail != nil {
+				t.Detail.Scope = redactEmails(t.Detail.Scope)
+			}
+		case "scope":
+			if t.Detail != nil {
+				t.Detail.Scope = ""
+			}
+		case "documents":
+			if t.Detail != nil {
+				t.Detail.Documents, t.Detail.Addenda = nil, nil
+			}
+		case "events":
+			t.Events = nil
+		case "bid_security":
+			t.BidSecurity = nil
+		case "trade_terms":
+			t.TradeTerms = nil
+		}
+	}
+}
+
+// applyRaw leaves the fields redacted for role out of data, a portal
+// item as JSON. Only contacts and scope are there to redact.
+func (r redactions) applyRaw(role string, data []byte) ([]byte, error) {
+	fields := r[role]
+	if !slices.Contains(fields, "contacts") && !slices.Contains(fields, "scope") {
+		return data, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var m map[string]any
+	if err := dec.Decode(&m); err != nil {
+		return nil, err
+	}
+	if slices.Contains(fields, "scope") {
+		delete(m, "Scope")
+		delete(m, "Description")
+	}
+	if slices.Contains(fields, "contacts") {
+		for k, v := range m {
+			if s, ok := v.(string); ok {
+				m[k] = redactEmails(s)
+			}
+		}
+	}
+	return json.Marshal(m)
+}
+
+func redactEmails(s string) string {
+	return contactEmailRe.ReplaceAllString(s, "[redacted]")
+}
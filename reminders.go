@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// questionReminder is a heads-up that a watched tender's question
+// deadline is coming up.
+type questionReminder struct {
+	TenderID    string
+	Description string
+	At          time.Time
+}
+
+// dueQuestionReminders returns reminders for watched tenders whose
+// question deadline is between now and within from now, and that haven't
+// been sent yet.
+func (s store) dueQuestionReminders(within time.Duration, now time.Time) ([]questionReminder, error) {
+	if within <= 0 {
+		return nil, nil
+	}
+	rows, err := s.db.Query(`select e.tender_id, t.description, e.at
+		from tender_events e
+		join watches w on w.tender_id = e.tender_id
+		join tenders t on t.id = e.tender_id
+		left join question_reminders r on r.tender_id = e.tender_id and r.at = e.at
+		where e.kind = ? and e.at > ? and e.at <= ? and r.tender_id is null
+		order by e.at`, questionDeadline, now, now.Add(within))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []questionReminder
+	for rows.Next() {
+		var r questionReminder
+		if err := rows.Scan(&r.TenderID, &r.Description, &r.At); err != nil {
+			return nil, err
+		}
+		res = append(res, r)
+	}
+	return res, rows.Err()
+}
+
+func (s store) markQuestionRemindersSent(rs []questionReminder) error {
+	now := time.Now()
+	for _, r := range rs {
+		if _, err := s.db.Exec("insert into question_reminders (tender_id, at, sent) values (?, ?, ?) on conflict do nothing", r.TenderID, r.At, now); err != nil {
+			return fmt.Errorf("marking reminder for %s sent: %v", r.TenderID, err)
+		}
+	}
+	return nil
+}
+
+// dueClosingReminders returns the announced tenders closing between now
+// and within from now that haven't been reminded about for their current
+// close date, soonest first. Those announced when they were already
+// that close are left out, since their announcement was reminder enough.
+// Times are compared as UTC since close dates are stored with the
+// portal's offset.
+func (s store) dueClosingReminders(within time.Duration, now time.Time) ([]Tender, error) {
+	if within <= 0 {
+		return nil, nil
+	}
+	rows, err := s.db.Query(`select t.id, t.url, t.description, t.agency, t.issued, t.close
+		from tenders t
+		join notified_tenders n on n.tender_id = t.id
+		left join closing_reminders r on r.tender_id = t.id and datetime(r.close) = datetime(t.close)
+		where datetime(t.close) > datetime(?) and datetime(t.close) <= datetime(?) and r.tender_id is null
+		and datetime(n.at) < datetime(t.close, ?)
+		and t.id not in (select tender_id from tender_retractions)
+		order by t.close, t.id`, now, now.Add(within), fmt.Sprintf("-%d seconds", int(within.Seconds())))
+	if err != nil {
+		return nil, err
+	}
+	var res []Tender
+	for rows.Next() {
+		var t Tender
+		if err := rows.Scan(&t.ID, &t.URL, &t.Description, &t.Agency, &t.IssuedDate, &t.CloseDate); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		res = append(res, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range res {
+		if err := s.loadDetails(&res[i]); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+func (s store) markClosingRemindersSent(ts []Tender) error {
+	now := time.Now()
+	for _, t := range ts {
+		if _, err := s.db.Exec("insert into closing_reminders (tender_id, close, sent) values (?, ?, ?) on conflict do nothing", t.ID, t.CloseDate, now); err != nil {
+			return fmt.Errorf("marking closing reminder for %s sent: %v", t.ID, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// replay stores the tenders in the search responses archived under dir,
+// as laid out by responseArchive, the way scraping them would have. Each
+// portal's responses go in the order they arrived, parsed by the client in
+// cls for that portal; portals without one are skipped. Nothing is
+// fetched, so new tenders don't get details, and nothing is marked
+// retracted since the archive doesn't say which listings were complete.
+// Tenders are stored as of when their response arrived, so new ones are
+// backdated and listings older than what's stored are skipped. It returns
+// the new tenders.
+func replay(ctx context.Context, dir string, cls []*Client, st store) ([]Tender, error) {
+	hosts, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var nt []Tender
+	for _, h := range hosts {
+		if !h.IsDir() {
+			continue
+		}
+		var cl *Client
+		for _, c := range cls {
+			if c.u.Host == h.Name() {
+				cl = c
+			}
+		}
+		if cl == nil {
+			slog.Info("skipping archived responses, which aren't from one of -sources", "host", h.Name())
+			continue
+		}
+
+		// Names sort in the order the responses arrived.
+		files, err := filepath.Glob(filepath.Join(dir, h.Name(), "*.json"))
+		if err != nil {
+			return nil, err
+		}
+		var items int
+		for _, f := range files {
+			if err := ctx.Err(); err != nil {
+				return nt, err
+			}
+			n, err := replayFile(ctx, f, cl, st, func(t Tender) { nt = append(nt, t) })
+			items += n
+			if err != nil {
+				return nt, err
+			}
+		}
+		slog.Info("replayed", "host", h.Name(), "items", items, "responses", len(files))
+	}
+	return nt, nil
+}
+
+// replayFile stores the tenders in the archived search response f as it's
+// decoded, calling added with each new one, and returns how many items it
+// stored.
+func replayFile(ctx context.Context, f string, cl *Client, st store, added func(Tender)) (int, error) {
+	r, err := os.Open(f)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+	// Responses are named for when they arrived.
+	arrived, err := time.Parse(responseTimeFormat, strings.TrimSuffix(filepath.Base(f), ".json"))
+	if err != nil {
+		fi, err := r.Stat()
+		if err != nil {
+			return 0, err
+		}
+		arrived = fi.ModTime()
+	}
+	var n int
+	var storeErr error
+	_, err = decodeSearch(bufio.NewReader(r), func(d RawTender) error {
+		t, err := cl.parse(d)
+		if err != nil {
+			slog.Warn("skipping unparseable item", "file", f, "err", err)
+			return nil
+		}
+		t.raw, _ = json.Marshal(d)
+		t.listed = arrived
+		if t.observed.IsZero() || arrived.Before(t.observed) {
+			t.observed = arrived
+		}
+		t, isNew, err := storeTender(ctx, nil, st, t)
+		if err != nil {
+			storeErr = fmt.Errorf("%s: %w", f, err)
+			return storeErr
+		}
+		if isNew {
+			added(t)
+		}
+		n++
+		return nil
+	})
+	if storeErr != nil {
+		return n, storeErr
+	}
+	if err != nil {
+		// A response the portal mangled shouldn't stop the rest.
+		slog.Warn("skipping the rest of file", "file", f, "err", err)
+	}
+	return n, nil
+}
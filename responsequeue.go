@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+)
+
+// maxQueuedResponses is how many search responses the browser can have
+// received ahead of the pages listed before older ones are dropped.
+const maxQueuedResponses = 8
+
+// responseQueue holds the search responses the browser has received until
+// their pages are listed, keyed by the page index their request asked
+// for, so a late or repeated response can't be taken for another page's.
+// A second response for a page, such as from the portal repeating a
+// search, is merged into the first rather than queued again. Past max
+// responses the one for the lowest page is dropped, since that page has
+// most likely been given up on.
+type responseQueue struct {
+	max int
+
+	mu     sync.Mutex
+	bodies map[int]queuedResponse
+	// pushed, if set, is closed on the next push, for wait.
+	pushed chan struct{}
+	// dropped and merged count the responses dropped for overflowing and
+	// merged into one already queued.
+	dropped, merged int
+	// requested are the page indexes searches have been sent for, to tell
+	// a page whose response went missing from one that never loaded.
+	requested map[int]bool
+}
+
+// request records that a search for page index was sent.
+func (q *responseQueue) request(index int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.requested == nil {
+		q.requested = make(map[int]bool)
+	}
+	q.requested[index] = true
+}
+
+// wasRequested reports whether a search for page index was sent.
+func (q *responseQueue) wasRequested(index int) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.requested[index]
+}
+
+// queuedResponse is a search response's body, or why it can't be listed.
+type queuedResponse struct {
+	body []byte
+	err  error
+}
+
+// push queues body as the response for page index, merging or dropping
+// as above.
+func (q *responseQueue) push(index int, body []byte) {
+	q.add(index, queuedResponse{body: body})
+}
+
+// fail queues err as the response for page index, for a response that
+// arrived but can't be listed, so waiting for it fails with err rather
+// than timing out.
+func (q *responseQueue) fail(index int, err error) {
+	q.add(index, queuedResponse{err: err})
+}
+
+func (q *responseQueue) add(index int, r queuedResponse) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, ok := q.bodies[index]; ok {
+		q.merged++
+		return
+	}
+	if q.max > 0 && len(q.bodies) >= q.max {
+		oldest := index
+		for i := range q.bodies {
+			oldest = min(oldest, i)
+		}
+		q.dropped++
+		slog.Warn("too many search responses waiting to be listed, dropping the oldest", "max", q.max, "page", oldest+1)
+		if oldest == index {
+			return
+		}
+		delete(q.bodies, oldest)
+	}
+	if q.bodies == nil {
+		q.bodies = make(map[int]queuedResponse)
+	}
+	q.bodies[index] = r
+	if q.pushed != nil {
+		close(q.pushed)
+		q.pushed = nil
+	}
+}
+
+// wait returns the response for page index, waiting for it to be pushed
+// if it hasn't been, until ctx is done, or the error it failed with.
+// Responses for earlier pages, which have been listed or given up on, are
+// dropped.
+func (q *responseQueue) wait(ctx context.Context, index int) ([]byte, error) {
+	for {
+		q.mu.Lock()
+		for i := range q.bodies {
+			if i < index {
+				delete(q.bodies, i)
+				q.dropped++
+			}
+		}
+		if r, ok := q.bodies[index]; ok {
+			delete(q.bodies, index)
+			q.mu.Unlock()
+			return r.body, r.err
+		}
+		if q.pushed == nil {
+			q.pushed = make(chan struct{})
+		}
+		pushed := q.pushed
+		q.mu.Unlock()
+
+		select {
+		case <-pushed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// drain empties the queue, returning how many responses were never listed
+// along with the dropped and merged counts, which it resets.
+func (q *responseQueue) drain() (unlisted, dropped, merged int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	unlisted, dropped, merged = len(q.bodies), q.dropped, q.merged
+	q.bodies, q.dropped, q.merged, q.requested = nil, 0, 0, nil
+	return unlisted, dropped, merged
+}
+
+// responseHandlers tracks a page's response handlers, which read bodies in
+// goroutines of their own since reading one in the handler would block the
+// browser's event loop. Once closed, it waits for those running and turns
+// away new ones.
+type responseHandlers struct {
+	mu     sync.Mutex
+	wg     sync.WaitGroup
+	closed bool
+}
+
+// start reports whether a handler may run, counting it as running if so.
+func (h *responseHandlers) start() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return false
+	}
+	h.wg.Add(1)
+	return true
+}
+
+// done marks a handler started with start as finished.
+func (h *responseHandlers) done() {
+	h.wg.Done()
+}
+
+// close turns away handlers from now on and waits for running ones.
+func (h *responseHandlers) close() {
+	h.mu.Lock()
+	h.closed = true
+	h.mu.Unlock()
+	h.wg.Wait()
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// responseTimeFormat names archived responses by when they arrived, so
+// they sort in that order.
+const responseTimeFormat = "20060102T150405.000000000Z"
+
+// responseArchive keeps portals' search responses as they arrived, a file
+// per response under dir/<portal host>/, to parse again when the parser
+// improves or to see what a portal sent when its format changes. A nil
+// *responseArchive keeps nothing.
+type responseArchive struct {
+	dir string
+	// keep is how long responses are kept, or 0 for good.
+	keep time.Duration
+}
+
+// save archives body, the search response host sent at.
+func (a *responseArchive) save(host string, at time.Time, body []byte) error {
+	if a == nil {
+		return nil
+	}
+	f, err := a.create(host, at)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(body); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	return f.Close()
+}
+
+// create returns the file to archive the search response host sent at in.
+func (a *responseArchive) create(host string, at time.Time) (*os.File, error) {
+	dir := filepath.Join(a.dir, host)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return os.Create(filepath.Join(dir, at.UTC().Format(responseTimeFormat)+".json"))
+}
+
+// archiveWriter archives a search response as it's read, such as through
+// an io.TeeReader, so it needn't be held whole. Failing to write gives up
+// on archiving it rather than failing the read.
+type archiveWriter struct {
+	f   *os.File
+	err error
+}
+
+// writer returns an archiveWriter for the search response host sent at,
+// or nil if a is nil or the file can't be created, which is logged.
+func (a *responseArchive) writer(host string, at time.Time) *archiveWriter {
+	if a == nil {
+		return nil
+	}
+	f, err := a.create(host, at)
+	if err != nil {
+		slog.Error("archiving search response", "host", host, "err", err)
+		return nil
+	}
+	return &archiveWriter{f: f}
+}
+
+func (w *archiveWriter) Write(p []byte) (int, error) {
+	if w.err == nil {
+		if _, w.err = w.f.Write(p); w.err != nil {
+			slog.Error("archiving search response", "err", w.err)
+		}
+	}
+	return len(p), nil
+}
+
+// Close finishes the archived response, removing it if it's incomplete.
+func (w *archiveWriter) Close() error {
+	err := w.f.Close()
+	if w.err != nil || err != nil {
+		os.Remove(w.f.Name())
+	}
+	return err
+}
+
+// prune removes responses that arrived keep or more before now.
+func (a *responseArchive) prune(now time.Time) (int, error) {
+	if a == nil || a.keep <= 0 {
+		return 0, nil
+	}
+	var removed int
+	err := filepath.WalkDir(a.dir, func(path string, d fs.DirEntry, err error) error {
+		if os.IsNotExist(err) && path == a.dir {
+			return nil
+		}
+		if err != nil || d.IsDir() || filepath.Ext(path) != ".json" {
+			return err
+		}
+		at, err := time.Parse(responseTimeFormat, d.Name()[:len(d.Name())-len(".json")])
+		if err != nil || now.Sub(at) < a.keep {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("pruning archived response: %w", err)
+		}
+		removed++
+		return nil
+	})
+	return removed, err
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// retraction is a stored tender that was withdrawn before closing, either
+// marked cancelled by the portal or gone from its listing. Retracted
+// tenders are kept but no longer announced.
+type retraction struct {
+	TenderID    string
+	Description string
+	At          time.Time
+	Reason      string
+}
+
+const (
+	retractedCancelled = "cancelled on the portal"
+	retractedMissing   = "no longer listed on the portal"
+)
+
+// retract records the tender with id as retracted for reason, unless it
+// already is.
+func (s store) retract(tenderID, reason string, now time.Time) error {
+	_, err := s.db.Exec("insert into tender_retractions (tender_id, at, reason) values (?, ?, ?) on conflict do nothing", tenderID, now, reason)
+	if err != nil {
+		return fmt.Errorf("insert retraction: %v", err)
+	}
+	return nil
+}
+
+// unretract clears a retraction of the tender with id for having gone
+// missing, since it's listed again.
+func (s store) unretract(tenderID string) error {
+	_, err := s.db.Exec("delete from tender_retractions where tender_id = ? and reason = ?", tenderID, retractedMissing)
+	if err != nil {
+		return fmt.Errorf("delete retraction: %v", err)
+	}
+	return nil
+}
+
+// retractMissing retracts the open tenders of source that were issued
+// since oldestIssued, which a complete listing of the source would
+// therefore have included, but that aren't in seen.
+func (s store) retractMissing(source string, seen map[string]bool, oldestIssued, now time.Time) ([]string, error) {
+	// Tenders closing today may have closed and dropped off already.
+	y, m, d := now.AddDate(0, 0, 1).Date()
+	tomorrow := time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+	rows, err := s.db.Query(`select id from tenders
+		where source = ? and datetime(issued) >= datetime(?) and datetime(close) >= datetime(?)
+		and id not in (select tender_id from tender_retractions)`,
+		source, oldestIssued, tomorrow)
+	if err != nil {
+		return nil, err
+	}
+	var missing []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if !seen[id] {
+			missing = append(missing, id)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, id := range missing {
+		if err := s.retract(id, retractedMissing, now); err != nil {
+			return nil, err
+		}
+	}
+	return missing, nil
+}
+
+// pendingRetractions returns retractions of watched tenders that haven't
+// been notified about yet.
+func (s store) pendingRetractions() ([]retraction, error) {
+	rows, err := s.db.Query(`select r.tender_id, t.description, r.at, r.reason
+		from tender_retractions r
+		join watches w on w.tender_id = r.tender_id
+		join tenders t on t.id = r.tender_id
+		where r.notified is null
+		order by r.at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []retraction
+	for rows.Next() {
+		var r retraction
+		if err := rows.Scan(&r.TenderID, &r.Description, &r.At, &r.Reason); err != nil {
+			return nil, err
+		}
+		res = append(res, r)
+	}
+	return res, rows.Err()
+}
+
+func (s store) markRetractionsNotified(rs []retraction) error {
+	now := time.Now()
+	for _, r := range rs {
+		if _, err := s.db.Exec("update tender_retractions set notified = ? where tender_id = ?", now, r.TenderID); err != nil {
+			return fmt.Errorf("marking retraction of %s notified: %v", r.TenderID, err)
+		}
+	}
+	return nil
+}
+
+// retraction returns the retraction of the tender with id, or nil if it
+// hasn't been retracted.
+func (s store) retraction(tenderID string) (*retraction, error) {
+	r := retraction{TenderID: tenderID}
+	err := s.db.QueryRow("select at, reason from tender_retractions where tender_id = ?", tenderID).Scan(&r.At, &r.Reason)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
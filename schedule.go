@@ -0,0 +1,159 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// schedule is a cron expression with minute, hour, day of month, month and
+// day of week fields, optionally prefixed by CRON_TZ=<zone> to evaluate it
+// in a time zone other than the local one.
+type schedule struct {
+	expr                          string
+	loc                           *time.Location
+	minute, hour, dom, month, dow uint64
+	domRestricted, dowRestricted  bool
+}
+
+func parseSchedule(expr string) (schedule, error) {
+	s := schedule{expr: expr, loc: time.Local}
+	fields := strings.Fields(expr)
+	if len(fields) > 0 {
+		if tz, ok := strings.CutPrefix(fields[0], "CRON_TZ="); ok {
+			loc, err := time.LoadLocation(tz)
+			if err != nil {
+				return schedule{}, err
+			}
+			s.loc = loc
+			fields = fields[1:]
+		}
+	}
+	if len(fields) != 5 {
+		return schedule{}, fmt.Errorf("schedule %q: want 5 fields, got %d", expr, len(fields))
+	}
+
+	var err error
+	if s.minute, err = parseCronField(fields[0], 0, 59); err != nil {
+		return schedule{}, fmt.Errorf("schedule %q minute: %w", expr, err)
+	}
+	if s.hour, err = parseCronField(fields[1], 0, 23); err != nil {
+		return schedule{}, fmt.Errorf("schedule %q hour: %w", expr, err)
+	}
+	if s.dom, err = parseCronField(fields[2], 1, 31); err != nil {
+		return schedule{}, fmt.Errorf("schedule %q day of month: %w", expr, err)
+	}
+	if s.month, err = parseCronField(fields[3], 1, 12); err != nil {
+		return schedule{}, fmt.Errorf("schedule %q month: %w", expr, err)
+	}
+	if s.dow, err = parseCronField(fields[4], 0, 7); err != nil {
+		return schedule{}, fmt.Errorf("schedule %q day of week: %w", expr, err)
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1 // 7 is also Sunday
+	}
+	s.domRestricted = fields[2] != "*"
+	s.dowRestricted = fields[4] != "*"
+	return s, nil
+}
+
+// parseCronField parses a comma-separated list of *, n, or n-m, each
+// optionally followed by /step, into a bit set.
+func parseCronField(f string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(f, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepStr); err != nil || step < 1 {
+				return 0, fmt.Errorf("bad step %q", stepStr)
+			}
+		}
+
+		lo, hi := min, max
+		if rng != "*" {
+			loStr, hiStr, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = strconv.Atoi(loStr); err != nil {
+				return 0, fmt.Errorf("bad value %q", loStr)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(hiStr); err != nil {
+					return 0, fmt.Errorf("bad value %q", hiStr)
+				}
+			} else if hasStep {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%q out of range %d-%d", part, min, max)
+		}
+		for i := lo; i <= hi; i += step {
+			bits |= 1 << i
+		}
+	}
+	return bits, nil
+}
+
+// dayMatches reports whether the schedule fires on t's day. Schedules
+// restricted to certain days of the week treat holidays like weekends, so
+// a holiday matches if Saturday or Sunday would.
+func (s schedule) dayMatches(t time.Time, holidays holidayCalendar) bool {
+	dom := s.dom&(1<<t.Day()) != 0
+	dow := s.dow&(1<<int(t.Weekday())) != 0
+	if _, ok := holidays.holiday(t); ok && s.dowRestricted {
+		dow = s.dow&(1<<int(time.Saturday)|1<<int(time.Sunday)) != 0
+	}
+	// As in cron, if both day fields are restricted either can match.
+	if s.domRestricted && s.dowRestricted {
+		return dom || dow
+	}
+	return dom && dow
+}
+
+// next returns the first time the schedule fires after t, or the zero
+// time if it doesn't within five years.
+func (s schedule) next(t time.Time, holidays holidayCalendar) time.Time {
+	t = t.In(s.loc).Truncate(time.Minute).Add(time.Minute)
+	end := t.AddDate(5, 0, 0)
+	for t.Before(end) {
+		switch {
+		case s.month&(1<<int(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, s.loc)
+		case !s.dayMatches(t, holidays):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, s.loc)
+		case s.hour&(1<<t.Hour()) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, s.loc)
+		case s.minute&(1<<t.Minute()) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// scheduleDue reports whether any of schedules has fired since the last
+// run of source, so that invoking tender-digest more often than
+// needed, such as every few minutes from cron or a systemd timer, only
+// scrapes within the wanted windows. It's true if there's no run history.
+func (s store) scheduleDue(source string, schedules []schedule, holidays holidayCalendar, now time.Time) (bool, error) {
+	var last time.Time
+	err := s.db.QueryRow("select started from runs where source = ? order by started desc limit 1", source).Scan(&last)
+	if err == sql.ErrNoRows {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	for _, sc := range schedules {
+		if n := sc.next(last, holidays); !n.IsZero() && !n.After(now) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronField(t *testing.T) {
+	for _, tt := range []struct {
+		field    string
+		min, max int
+		want     uint64
+		wantErr  bool
+	}{
+		{field: "*", min: 0, max: 5, want: 0b111111},
+		{field: "3", min: 0, max: 59, want: 1 << 3},
+		{field: "1,4", min: 0, max: 59, want: 1<<1 | 1<<4},
+		{field: "2-4", min: 0, max: 59, want: 1<<2 | 1<<3 | 1<<4},
+		{field: "*/2", min: 0, max: 6, want: 1<<0 | 1<<2 | 1<<4 | 1<<6},
+		{field: "10/20", min: 0, max: 59, want: 1<<10 | 1<<30 | 1<<50},
+		{field: "1-5/2", min: 1, max: 12, want: 1<<1 | 1<<3 | 1<<5},
+		{field: "9-17,0", min: 0, max: 23, want: 0b111111111<<9 | 1},
+		{field: "60", min: 0, max: 59, wantErr: true},
+		{field: "0", min: 1, max: 31, wantErr: true},
+		{field: "5-3", min: 0, max: 59, wantErr: true},
+		{field: "*/0", min: 0, max: 59, wantErr: true},
+		{field: "a", min: 0, max: 59, wantErr: true},
+		{field: "1-", min: 0, max: 59, wantErr: true},
+	} {
+		got, err := parseCronField(tt.field, tt.min, tt.max)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseCronField(%q, %d, %d) = %b, want error", tt.field, tt.min, tt.max, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseCronField(%q, %d, %d): %v", tt.field, tt.min, tt.max, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseCronField(%q, %d, %d) = %b, want %b", tt.field, tt.min, tt.max, got, tt.want)
+		}
+	}
+}
+
+func TestParseScheduleErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"CRON_TZ=Nowhere/Special * * * * *",
+		"* 24 * * *",
+		"* * * 13 *",
+		"* * * * 8",
+	} {
+		if _, err := parseSchedule(expr); err == nil {
+			t.Errorf("parseSchedule(%q) succeeded, want error", expr)
+		}
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	halifax, err := time.LoadLocation("America/Halifax")
+	if err != nil {
+		t.Skip(err)
+	}
+	for _, tt := range []struct {
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		// Every 15 minutes rounds up to the next quarter hour.
+		{"CRON_TZ=UTC */15 * * * *", time.Date(2025, 3, 4, 10, 7, 30, 0, time.UTC), time.Date(2025, 3, 4, 10, 15, 0, 0, time.UTC)},
+		// Exactly on a firing time, the next one is later.
+		{"CRON_TZ=UTC 0 * * * *", time.Date(2025, 3, 4, 10, 0, 0, 0, time.UTC), time.Date(2025, 3, 4, 11, 0, 0, 0, time.UTC)},
+		// Weekdays at 6 skip from Friday evening to Monday.
+		{"CRON_TZ=UTC 0 6 * * 1-5", time.Date(2025, 3, 7, 18, 0, 0, 0, time.UTC), time.Date(2025, 3, 10, 6, 0, 0, 0, time.UTC)},
+		// 7 is Sunday as well as 0.
+		{"CRON_TZ=UTC 30 8 * * 7", time.Date(2025, 3, 4, 0, 0, 0, 0, time.UTC), time.Date(2025, 3, 9, 8, 30, 0, 0, time.UTC)},
+		// With both day fields restricted, either matches: the 15th
+		// comes before the next Monday.
+		{"CRON_TZ=UTC 0 0 15 * 1", time.Date(2025, 3, 11, 0, 0, 0, 0, time.UTC), time.Date(2025, 3, 15, 0, 0, 0, 0, time.UTC)},
+		// A month without the day is skipped.
+		{"CRON_TZ=UTC 0 0 31 * *", time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 5, 31, 0, 0, 0, 0, time.UTC)},
+		// Months roll over into the next year.
+		{"CRON_TZ=UTC 0 0 1 1 *", time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+		// CRON_TZ evaluates in that zone: 7 in Halifax is 10 UTC in
+		// summer.
+		{"CRON_TZ=America/Halifax 0 7 * * *", time.Date(2025, 7, 1, 9, 0, 0, 0, time.UTC), time.Date(2025, 7, 1, 7, 0, 0, 0, halifax)},
+		// February 30th never comes.
+		{"CRON_TZ=UTC 0 0 30 2 *", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), time.Time{}},
+	} {
+		s, err := parseSchedule(tt.expr)
+		if err != nil {
+			t.Errorf("parseSchedule(%q): %v", tt.expr, err)
+			continue
+		}
+		if got := s.next(tt.from, nil); !got.Equal(tt.want) {
+			t.Errorf("%q next after %v = %v, want %v", tt.expr, tt.from, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"text/tabwriter"
+)
+
+// tableDoc is what the migrations say about a table: the comment on the
+// line before it and those after its columns.
+type tableDoc struct {
+	comment string
+	columns map[string]string
+}
+
+var (
+	createTableRe = regexp.MustCompile(`(?i)^create (?:virtual )?table (?:if not exists )?(\w+)`)
+	addColumnRe   = regexp.MustCompile(`(?i)^alter table (\w+) add (?:column )?(\w+)`)
+	dropTableRe   = regexp.MustCompile(`(?i)^drop table (?:if exists )?(\w+)`)
+	tableKeyRe    = regexp.MustCompile(`(?i)^(?:primary key|unique)\b`)
+	referencesRe  = regexp.MustCompile(`\breferences (\w+)\.(\w+)`)
+)
+
+// schemaDocs returns the table and column comments in ms, by table, as of
+// the last of them. It expects migrations laid out like
+// migrations/0001_initial.sql, with a column per line.
+func schemaDocs(ms []migration) map[string]*tableDoc {
+	docs := make(map[string]*tableDoc)
+	for _, m := range ms {
+		var comment []string
+		var cur *tableDoc
+		for _, line := range strings.Split(m.sql, "\n") {
+			code, note, _ := strings.Cut(strings.TrimSpace(line), "--")
+			code, note = strings.TrimSpace(code), strings.TrimSpace(note)
+			if cur != nil {
+				if strings.HasPrefix(code, ")") {
+					cur = nil
+				} else if name, _, _ := strings.Cut(code, " "); name != "" && !tableKeyRe.MatchString(code) {
+					cur.columns[strings.TrimSuffix(name, ",")] = note
+				}
+				continue
+			}
+			if code == "" && strings.HasPrefix(strings.TrimSpace(line), "--") {
+				comment = append(comment, note)
+				continue
+			}
+			if sm := createTableRe.FindStringSubmatch(code); sm != nil {
+				cur = &tableDoc{comment: strings.Join(comment, " "), columns: make(map[string]string)}
+				docs[sm[1]] = cur
+			} else if sm := addColumnRe.FindStringSubmatch(code); sm != nil && docs[sm[1]] != nil {
+				docs[sm[1]].columns[sm[2]] = note
+			} else if sm := dropTableRe.FindStringSubmatch(code); sm != nil {
+				delete(docs, sm[1])
+			}
+			comment = nil
+		}
+	}
+	return docs
+}
+
+// schemaTable is a table as it is in a database, with what the migrations
+// say about it.
+type schemaTable struct {
+	name    string
+	comment string
+	columns []schemaColumn
+}
+
+type schemaColumn struct {
+	name, typ string
+	key       bool
+	comment   string
+	// references is the table and column the comment says the column
+	// refers to, if any.
+	references [2]string
+}
+
+// describeSchema returns the version of the database at path and its
+// tables, by name, leaving out virtual tables' internal ones.
+func describeSchema(path string) (int, []schemaTable, error) {
+	// Opening read-only doesn't say why it fails for a missing file.
+	if _, err := os.Stat(path); err != nil {
+		return 0, nil, err
+	}
+	db, err := sql.Open("sqlite", "file:"+path+"?mode=ro&_time_format=sqlite")
+	if err != nil {
+		return 0, nil, err
+	}
+	defer db.Close()
+
+	var version int
+	var versioned bool
+	if err := db.QueryRow("select count(*) > 0 from sqlite_master where type = 'table' and name = 'schema_version'").Scan(&versioned); err != nil {
+		return 0, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if versioned {
+		if version, err = schemaVersion(db); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	rows, err := db.Query("select name, sql from sqlite_master where type = 'table' and name not like 'sqlite_%' order by name")
+	if err != nil {
+		return 0, nil, err
+	}
+	var names, virtual []string
+	for rows.Next() {
+		var name string
+		var ddl sql.NullString
+		if err := rows.Scan(&name, &ddl); err != nil {
+			rows.Close()
+			return 0, nil, err
+		}
+		names = append(names, name)
+		if strings.HasPrefix(strings.ToLower(ddl.String), "create virtual table") {
+			virtual = append(virtual, name)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, nil, err
+	}
+
+	ms, err := migrations()
+	if err != nil {
+		return 0, nil, err
+	}
+	docs := schemaDocs(ms)
+	docs["schema_version"] = &tableDoc{
+		comment: "Migrations applied to the database.",
+		columns: map[string]string{"version": "the number the migration's file starts with", "name": "the rest of its file name"},
+	}
+
+	var tables []schemaTable
+	for _, name := range names {
+		if slices.ContainsFunc(virtual, func(v string) bool { return strings.HasPrefix(name, v+"_") }) {
+			continue
+		}
+		t := schemaTable{name: name}
+		doc := docs[name]
+		if doc != nil {
+			t.comment = doc.comment
+		}
+		cols, err := db.Query("select name, type, pk from pragma_table_info(?)", name)
+		if err != nil {
+			return 0, nil, err
+		}
+		for cols.Next() {
+			var c schemaColumn
+			var pk int
+			if err := cols.Scan(&c.name, &c.typ, &pk); err != nil {
+				cols.Close()
+				return 0, nil, err
+			}
+			c.typ, c.key = strings.ToLower(c.typ), pk > 0
+			if doc != nil {
+				c.comment = doc.columns[c.name]
+			}
+			if sm := referencesRe.FindStringSubmatch(c.comment); sm != nil {
+				c.references = [2]string{sm[1], sm[2]}
+			}
+			t.columns = append(t.columns, c)
+		}
+		cols.Close()
+		if err := cols.Err(); err != nil {
+			return 0, nil, err
+		}
+		tables = append(tables, t)
+	}
+	return version, tables, nil
+}
+
+// printSchema writes the tables of a database at version to w, with
+// their comments.
+func printSchema(w io.Writer, version int, tables []schemaTable) error {
+	ms, err := migrations()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Schema version %d", version)
+	if latest := ms[len(ms)-1].version; version < latest {
+		fmt.Fprintf(w, ", behind this build's %d; the rest are applied when it next opens the database", latest)
+	}
+	fmt.Fprintln(w)
+	for _, t := range tables {
+		fmt.Fprintf(w, "\n%s\n", t.name)
+		if t.comment != "" {
+			fmt.Fprintf(w, "  %s\n", t.comment)
+		}
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		for _, c := range t.columns {
+			key := ""
+			if c.key {
+				key = "key"
+			}
+			fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\n", c.name, c.typ, key, c.comment)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// schemaReferences returns the references between tables, as referring
+// table and column and referred-to table and column, leaving out any to
+// tables that aren't there.
+func schemaReferences(tables []schemaTable) [][4]string {
+	var res [][4]string
+	for _, t := range tables {
+		for _, c := range t.columns {
+			if c.references[0] == "" || !slices.ContainsFunc(tables, func(o schemaTable) bool { return o.name == c.references[0] }) {
+				continue
+			}
+			res = append(res, [4]string{t.name, c.name, c.references[0], c.references[1]})
+		}
+	}
+	return res
+}
+
+// writeMermaidER writes tables as a Mermaid entity relationship diagram.
+func writeMermaidER(w io.Writer, tables []schemaTable) {
+	quote := strings.NewReplacer(`"`, "'", "\n", " ")
+	fmt.Fprintln(w, "erDiagram")
+	for _, t := range tables {
+		fmt.Fprintf(w, "    %s {\n", t.name)
+		for _, c := range t.columns {
+			typ := c.typ
+			if typ == "" {
+				typ = "any"
+			}
+			var keys []string
+			if c.key {
+				keys = append(keys, "PK")
+			}
+			if c.references[0] != "" {
+				keys = append(keys, "FK")
+			}
+			fmt.Fprintf(w, "        %s %s", typ, c.name)
+			if len(keys) > 0 {
+				fmt.Fprintf(w, " %s", strings.Join(keys, ", "))
+			}
+			if c.comment != "" {
+				fmt.Fprintf(w, ` "%s"`, quote.Replace(c.comment))
+			}
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintln(w, "    }")
+	}
+	for _, r := range schemaReferences(tables) {
+		fmt.Fprintf(w, "    %s ||--o{ %s : %s\n", r[2], r[0], r[1])
+	}
+}
+
+// writeDotER writes tables as a Graphviz DOT graph, a record per table with
+// edges between the columns that refer to each other.
+func writeDotER(w io.Writer, tables []schemaTable) {
+	fmt.Fprintln(w, "digraph schema {")
+	fmt.Fprintln(w, "\trankdir=LR;")
+	fmt.Fprintln(w, "\tnode [shape=plaintext];")
+	for _, t := range tables {
+		var b strings.Builder
+		fmt.Fprintf(&b, `<table border="0" cellborder="1" cellspacing="0"><tr><td bgcolor="lightgrey" title="%s"><b>%s</b></td></tr>`, html.EscapeString(t.comment), html.EscapeString(t.name))
+		for _, c := range t.columns {
+			name := html.EscapeString(c.name)
+			if c.key {
+				name = "<u>" + name + "</u>"
+			}
+			fmt.Fprintf(&b, `<tr><td port="%s" align="left" title="%s">%s %s</td></tr>`, c.name, html.EscapeString(c.comment), name, html.EscapeString(c.typ))
+		}
+		b.WriteString("</table>")
+		fmt.Fprintf(w, "\t%q [label=<%s>];\n", t.name, b.String())
+	}
+	for _, r := range schemaReferences(tables) {
+		fmt.Fprintf(w, "\t%q:%q -> %q:%q;\n", r[0], r[1], r[2], r[3])
+	}
+	fmt.Fprintln(w, "}")
+}
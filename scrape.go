@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// scraper scrapes the configured sources into the store.
+type scraper struct {
+	sources        sourceSpecs
+	strict, direct bool
+	// backdate backdates new tenders' first_observed, see Client.backdate.
+	backdate    bool
+	egress      egress
+	browser     browserConfig
+	unspsc      unspscMap
+	unspscFile  string
+	initTimeout time.Duration
+	pageTimeout time.Duration
+	// pageRetries is how many times listing a page is retried.
+	pageRetries int
+	// workers is how many sources are scraped at once.
+	workers        int
+	maxRunDuration time.Duration
+	schedules      []schedule
+	holidays       holidayCalendar
+	// session, if set, is a browser the sources share and that's kept
+	// running after the scrape.
+	session *browserSession
+	// archive, if set, keeps the search responses scraped.
+	archive *responseArchive
+	// mailbox, if set, has the portals' alert emails, to read after
+	// scraping for tenders the scrape missed.
+	mailbox *mailbox
+
+	// mu keeps on-demand fetches from overlapping, and reloads from
+	// happening during them.
+	mu sync.Mutex
+}
+
+// reload rereads the scraper's configuration files.
+func (sc *scraper) reload() error {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if sc.unspscFile == "" {
+		return nil
+	}
+	m, err := loadUNSPSCMap(sc.unspscFile)
+	if err != nil {
+		return err
+	}
+	sc.unspsc = m
+	return nil
+}
+
+// runSummary is what a scrape did, per source.
+type runSummary struct {
+	Sources []sourceRun `json:"sources"`
+}
+
+type sourceRun struct {
+	Source string `json:"source"`
+	// Skipped is set if no schedule had fired for the source, or the run
+	// ran out of time before getting to it.
+	Skipped bool `json:"skipped,omitempty"`
+	listing
+	responseCounts
+	// Anomaly is why the number of tenders listed looked wrong for the
+	// weekday, if it did.
+	Anomaly  string        `json:"anomaly,omitempty"`
+	New      int           `json:"new"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// scraped returns how many sources were scraped rather than skipped.
+func (s runSummary) scraped() int {
+	var n int
+	for _, r := range s.Sources {
+		if !r.Skipped {
+			n++
+		}
+	}
+	return n
+}
+
+// failed returns the sources that failed.
+func (s runSummary) failed() []string {
+	var res []string
+	for _, r := range s.Sources {
+		if r.Error != "" {
+			res = append(res, r.Source)
+		}
+	}
+	return res
+}
+
+// log logs s as one line, for log aggregators to pick up each run's
+// outcome from. err is what the run failed with, if it did.
+func (s runSummary) log(started time.Time, err error) {
+	var n int
+	for _, r := range s.Sources {
+		n += r.New
+	}
+	args := []any{"sources", len(s.Sources), "scraped", s.scraped(), "failed", len(s.failed()), "new", n, "duration", time.Since(started)}
+	if err != nil {
+		slog.Error("run summary", append(args, "err", err)...)
+		return
+	}
+	slog.Info("run summary", args...)
+}
+
+// scrape scrapes each source whose schedule is due, or every source if
+// now is set, recording each run. Up to workers sources are scraped at
+// once, each in a browser context of its own, and one failing doesn't
+// affect the others.
+func (sc *scraper) scrape(ctx context.Context, st store, now bool) runSummary {
+	if sc.maxRunDuration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, sc.maxRunDuration)
+		defer cancel()
+	}
+
+	workers := min(max(sc.workers, 1), len(sc.sources))
+	sess := sc.session
+	if workers > 1 && sess == nil && !sc.direct {
+		// Share a browser rather than starting one per source.
+		sess = &browserSession{egress: sc.egress, config: sc.browser}
+		defer sess.Close()
+	}
+
+	runs := make([]sourceRun, len(sc.sources))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				runs[i] = sc.scrapeSource(ctx, st, sc.sources[i], sess, now)
+			}
+		}()
+	}
+	for i := range sc.sources {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	sum := runSummary{Sources: runs}
+
+	sc.pollMailbox(ctx, st)
+	if n, err := sc.archive.prune(time.Now()); err != nil {
+		slog.Warn("pruning archived search responses", "err", err)
+	} else if n > 0 {
+		slog.Info("pruned archived search responses", "responses", n, "older_than", sc.archive.keep)
+	}
+	return sum
+}
+
+// recoverHandler, deferred by search response handlers, logs a panic in
+// one rather than letting it take down the process, since they run outside
+// scrapeSource's recover. The page waiting on the response times out.
+func recoverHandler(source string) {
+	if p := recover(); p != nil {
+		slog.Error("search response handler panicked", "source", source, "panic", p, "stack", string(debug.Stack()))
+	}
+}
+
+// scrapeSource scrapes spec, in sess's browser if it's set, if its
+// schedule is due, or regardless if now is set, recording the run. A
+// failing run, including failing to get as far as scraping, is reported
+// in the returned sourceRun. A panic scraping fails the run rather than
+// taking down the sources scraped alongside it.
+func (sc *scraper) scrapeSource(ctx context.Context, st store, spec sourceSpec, sess *browserSession, now bool) sourceRun {
+	if ctx.Err() != nil {
+		slog.Warn("not scraping, -max-run-duration reached", "source", spec.url, "max_run_duration", sc.maxRunDuration)
+		return sourceRun{Source: spec.url, Skipped: true}
+	}
+	cl, err := spec.client()
+	if err != nil {
+		slog.Error("scraping", "source", spec.url, "err", err)
+		return sourceRun{Source: spec.url, Error: err.Error()}
+	}
+	cl.strict = sc.strict
+	cl.direct = sc.direct
+	cl.backdate = sc.backdate
+	cl.egress = sc.egress
+	cl.browser = sc.browser
+	cl.unspsc = sc.unspsc
+	cl.initTimeout = sc.initTimeout
+	cl.pageTimeout = sc.pageTimeout
+	cl.session = sess
+	cl.archive = sc.archive
+	var src Source = cl
+
+	if len(sc.schedules) > 0 && !now {
+		due, err := st.scheduleDue(src.Name(), sc.schedules, sc.holidays, time.Now())
+		if err != nil {
+			slog.Error("scraping", "source", src.Name(), "err", err)
+			return sourceRun{Source: src.Name(), Error: fmt.Sprintf("checking schedule: %v", err)}
+		}
+		if !due {
+			slog.Info("no schedule has fired since the last run, not scraping", "source", src.Name())
+			return sourceRun{Source: src.Name(), Skipped: true}
+		}
+	}
+
+	started := time.Now()
+	st.events.emit("run_started", "", map[string]string{"source": src.Name()})
+	var snt []Tender
+	var l listing
+	func() {
+		defer func() {
+			if p := recover(); p != nil {
+				slog.Error("scraping panicked", "source", src.Name(), "panic", p, "stack", string(debug.Stack()))
+				err = fmt.Errorf("panic: %v", p)
+			}
+		}()
+		snt, l, err = findNew(ctx, src, st, sc.pageRetries)
+	}()
+	run := sourceRun{Source: src.Name(), listing: l, New: len(snt), Duration: time.Since(started)}
+	// Runs cut short by -max-run-duration list fewer than usual anyway.
+	if err == nil && ctx.Err() == nil {
+		var aerr error
+		if run.Anomaly, aerr = st.volumeAnomaly(src.Name(), started, l.Tenders); aerr != nil {
+			slog.Error("checking volume", "source", src.Name(), "err", aerr)
+		} else if run.Anomaly != "" {
+			slog.Warn("unusual volume, the portal's filters may not have been applied", "source", src.Name(), "anomaly", run.Anomaly)
+			if sc.strict {
+				err = anomalyError{run.Anomaly}
+			}
+		}
+	}
+	// Closing first counts the search responses left unlisted.
+	if cerr := src.Close(); cerr != nil {
+		slog.Error("closing source", "source", src.Name(), "err", cerr)
+	}
+	run.responseCounts = cl.unlisted
+	if rerr := st.recordRun(src.Name(), started, run.Duration, l, run.responseCounts, len(snt), run.Anomaly, err); rerr != nil {
+		slog.Error("recording run", "err", rerr)
+	}
+	if err != nil {
+		slog.Error("scraping", "source", src.Name(), "new", run.New, "duration", run.Duration, "err", err)
+		run.Error = err.Error()
+	} else {
+		slog.Info("scraped", "source", src.Name(), "pages", l.Pages, "tenders", l.Tenders, "new", run.New, "duration", run.Duration)
+	}
+	st.events.emit("run_finished", "", run)
+	return run
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// savedSearch is a query with subscriptions that each get a digest of the
+// new tenders matching it.
+type savedSearch struct {
+	ID            int64
+	Name          string
+	Query         string
+	Created       time.Time
+	Subscriptions []searchSubscription
+}
+
+type searchSubscription struct {
+	ID      int64
+	Channel string
+	Target  string
+}
+
+// matches reports whether every term of the search's query appears in t's
+// description, ignoring case. Terms starting with - must not appear.
+func (s savedSearch) matches(t Tender) bool {
+	desc := strings.ToLower(t.Description)
+	for _, term := range strings.Fields(strings.ToLower(s.Query)) {
+		if neg, ok := strings.CutPrefix(term, "-"); ok && neg != "" {
+			if strings.Contains(desc, neg) {
+				return false
+			}
+			continue
+		}
+		if !strings.Contains(desc, term) {
+			return false
+		}
+	}
+	return true
+}
+
+// targets returns the targets of subscriptions on channel.
+func (s savedSearch) targets(channel string) []string {
+	var res []string
+	for _, sub := range s.Subscriptions {
+		if sub.Channel == channel {
+			res = append(res, sub.Target)
+		}
+	}
+	return res
+}
+
+func (s store) createSearch(name, query, actor string) (int64, error) {
+	res, err := s.db.Exec("insert into saved_searches (name, query, created) values (?, ?, ?)", name, query, time.Now())
+	if err != nil {
+		return 0, fmt.Errorf("insert saved search: %v", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return id, s.audit(actor, "create search", fmt.Sprint(id), name+": "+query)
+}
+
+func (s store) deleteSearch(id int64, actor string) error {
+	if _, err := s.db.Exec("delete from search_subscriptions where search_id = ?", id); err != nil {
+		return fmt.Errorf("delete subscriptions: %v", err)
+	}
+	if _, err := s.db.Exec("delete from saved_searches where id = ?", id); err != nil {
+		return fmt.Errorf("delete saved search: %v", err)
+	}
+	return s.audit(actor, "delete search", fmt.Sprint(id), "")
+}
+
+func (s store) subscribeSearch(id int64, channel, target, actor string) error {
+	switch channel {
+	case "email":
+		if _, err := mail.ParseAddress(target); err != nil {
+			return fmt.Errorf("bad email address %q: %v", target, err)
+		}
+	case "sms", "voice":
+		if !phoneRe.MatchString(target) {
+			return fmt.Errorf("bad phone number %q, want E.164 such as +19025551234", target)
+		}
+	default:
+		return fmt.Errorf("unsupported channel %q", channel)
+	}
+	_, err := s.db.Exec("insert into search_subscriptions (search_id, channel, target) values (?, ?, ?) on conflict do nothing", id, channel, target)
+	if err != nil {
+		return fmt.Errorf("insert subscription: %v", err)
+	}
+	return s.audit(actor, "subscribe search", fmt.Sprint(id), channel+":"+target)
+}
+
+func (s store) unsubscribeSearch(id, subID int64, actor string) error {
+	if _, err := s.db.Exec("delete from search_subscriptions where search_id = ? and id = ?", id, subID); err != nil {
+		return fmt.Errorf("delete subscription: %v", err)
+	}
+	return s.audit(actor, "unsubscribe search", fmt.Sprint(id), fmt.Sprint(subID))
+}
+
+func (s store) savedSearches() ([]savedSearch, error) {
+	rows, err := s.db.Query("select id, name, query, created from saved_searches order by name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []savedSearch
+	idx := make(map[int64]int)
+	for rows.Next() {
+		var ss savedSearch
+		if err := rows.Scan(&ss.ID, &ss.Name, &ss.Query, &ss.Created); err != nil {
+			return nil, err
+		}
+		idx[ss.ID] = len(res)
+		res = append(res, ss)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	subRows, err := s.db.Query("select id, search_id, channel, target from search_subscriptions order by id")
+	if err != nil {
+		return nil, err
+	}
+	defer subRows.Close()
+	for subRows.Next() {
+		var sub searchSubscription
+		var searchID int64
+		if err := subRows.Scan(&sub.ID, &searchID, &sub.Channel, &sub.Target); err != nil {
+			return nil, err
+		}
+		if i, ok := idx[searchID]; ok {
+			res[i].Subscriptions = append(res[i].Subscriptions, sub)
+		}
+	}
+	return res, subRows.Err()
+}
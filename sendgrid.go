@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	sendgrid "github.com/sendgrid/sendgrid-go"
+	"github.com/sendgrid/sendgrid-go/helpers/mail"
+)
+
+type sendgridProvider struct {
+	apiKey string
+}
+
+func (p sendgridProvider) send(ctx context.Context, m message) error {
+	from := mail.NewEmail(m.from.Name, m.from.Address)
+
+	email := mail.NewV3Mail()
+	email.SetFrom(from)
+	email.Subject = m.subject
+	pers := mail.NewPersonalization()
+	pers.AddTos(from)
+	for _, a := range m.bcc {
+		pers.AddBCCs(mail.NewEmail(a.Name, a.Address))
+	}
+	email.AddPersonalizations(pers)
+	if m.text != "" {
+		email.AddContent(mail.NewContent("text/plain", m.text))
+	}
+	email.AddContent(mail.NewContent("text/html", m.html))
+	for _, i := range m.inline {
+		a := mail.NewAttachment()
+		a.SetContent(base64.StdEncoding.EncodeToString(i.data))
+		a.SetType(i.contentType)
+		a.SetFilename(i.filename())
+		a.SetDisposition("inline")
+		a.SetContentID(i.cid)
+		email.AddAttachment(a)
+	}
+	for _, f := range m.attachments {
+		a := mail.NewAttachment()
+		a.SetContent(base64.StdEncoding.EncodeToString(f.data))
+		a.SetType(f.contentType)
+		a.SetFilename(f.filename)
+		a.SetDisposition("attachment")
+		email.AddAttachment(a)
+	}
+
+	if m.disableClickTracking {
+		email.SetTrackingSettings(&mail.TrackingSettings{
+			ClickTracking: &mail.ClickTrackingSetting{Enable: ptr(false), EnableText: ptr(false)},
+		})
+	}
+
+	resp, err := sendgrid.NewSendClient(p.apiKey).SendWithContext(ctx, email)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 300 {
+		return nil
+	}
+
+	pe := &providerError{provider: "sendgrid", status: resp.StatusCode}
+
+	var body struct {
+		Errors []struct {
+			Message string `json:"message"`
+			Field   string `json:"field"`
+		} `json:"errors"`
+	}
+	var msgs []string
+	if json.Unmarshal([]byte(resp.Body), &body) == nil {
+		for _, e := range body.Errors {
+			if e.Field != "" {
+				msgs = append(msgs, e.Field+": "+e.Message)
+			} else {
+				msgs = append(msgs, e.Message)
+			}
+		}
+	}
+	pe.msg = strings.Join(msgs, "; ")
+	if pe.msg == "" {
+		pe.msg = resp.Body
+	}
+
+	switch resp.StatusCode {
+	case http.StatusUnauthorized:
+		pe.msg = "API key rejected, check SENDGRID_API_KEY: " + pe.msg
+	case http.StatusForbidden:
+		pe.msg = "forbidden, check the API key has mail send access and the from address is a verified sender: " + pe.msg
+	case http.StatusTooManyRequests:
+		pe.rateLimited = true
+		pe.retryAfter = retryAfter(http.Header(resp.Headers))
+	}
+	return pe
+}
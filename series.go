@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	// seriesYearRe matches years and fiscal years like 2025, 2025/26 and
+	// 2025-2026.
+	seriesYearRe  = regexp.MustCompile(`\b(?:19|20)\d\d(?:\s*[/-]\s*(?:(?:19|20)?\d\d))?\b`)
+	seriesPunctRe = regexp.MustCompile(`[^a-z]+`)
+)
+
+// seriesKey normalizes a tender description so that the same tender
+// issued in different years, such as "2025 Asphalt Resurfacing" and
+// "2026 Asphalt Resurfacing", gets the same key. It returns "" for
+// descriptions too short to link on.
+func seriesKey(desc string) string {
+	s := strings.ToLower(desc)
+	s = seriesYearRe.ReplaceAllString(s, " ")
+	s = strings.TrimSpace(seriesPunctRe.ReplaceAllString(s, " "))
+	if len(strings.Fields(s)) < 2 {
+		return ""
+	}
+	return s
+}
+
+func (s store) setSeries(tenderID, desc string) error {
+	key := seriesKey(desc)
+	if key == "" {
+		return nil
+	}
+	_, err := s.db.Exec("insert into tender_series (tender_id, series_key) values (?, ?) on conflict (tender_id) do update set series_key = excluded.series_key", tenderID, key)
+	if err != nil {
+		return fmt.Errorf("insert series: %v", err)
+	}
+	return nil
+}
+
+// backfillSeries links tenders stored before series were tracked.
+func (s store) backfillSeries() error {
+	rows, err := s.db.Query("select id, description from tenders where id not in (select tender_id from tender_series)")
+	if err != nil {
+		return err
+	}
+	type row struct{ id, desc string }
+	var missing []row
+	for rows.Next() {
+		var r row
+		if err := rows.Scan(&r.id, &r.desc); err != nil {
+			rows.Close()
+			return err
+		}
+		missing = append(missing, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, r := range missing {
+		if err := s.setSeries(r.id, r.desc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// series returns the other tenders in the same series as the one with id,
+// oldest first.
+func (s store) series(id string) ([]archivedTender, error) {
+	rows, err := s.db.Query(`select t.id, t.url, t.description, t.agency, t.issued, t.close, t.first_observed
+		from tender_series me
+		join tender_series o on o.series_key = me.series_key and o.tender_id != me.tender_id
+		join tenders t on t.id = o.tender_id
+		where me.tender_id = ?
+		order by t.issued`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []archivedTender
+	for rows.Next() {
+		var t archivedTender
+		if err := rows.Scan(&t.ID, &t.URL, &t.Description, &t.Agency, &t.IssuedDate, &t.CloseDate, &t.FirstObserved); err != nil {
+			return nil, err
+		}
+		res = append(res, t)
+	}
+	return res, rows.Err()
+}
+
+// printTender writes what's stored about the tender with id, along with
+// the rest of its series.
+func printTender(w io.Writer, st store, id string) error {
+	t, err := st.archivedTender(id)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "%s %s\n", t.ID, t.Description)
+	fmt.Fprintf(w, "Agency:     %s\n", t.Agency)
+	fmt.Fprintf(w, "Issued:     %s\n", formatStoredTime(t.IssuedDate))
+	fmt.Fprintf(w, "Closes:     %s\n", formatStoredTime(t.CloseDate))
+	fmt.Fprintf(w, "First seen: %s\n", t.FirstObserved.Format(time.RFC3339))
+	fmt.Fprintf(w, "URL:        %s\n", t.URL)
+	r, err := st.retraction(id)
+	if err != nil {
+		return err
+	}
+	if r != nil {
+		fmt.Fprintf(w, "Retracted:  %s, %s\n", r.At.Format(time.RFC3339), r.Reason)
+	}
+
+	series, err := st.series(id)
+	if err != nil {
+		return err
+	}
+	if len(series) > 0 {
+		fmt.Fprintf(w, "\nSeries:\n")
+		for _, o := range series {
+			fmt.Fprintf(w, "  %s  %s  %s\n", o.IssuedDate.Format(dateFormat), o.ID, o.Description)
+		}
+	}
+	return nil
+}
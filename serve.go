@@ -0,0 +1,514 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"html/template"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// serve runs the admin UI and API on addr. If publicAddr is set, it also
+// serves just the public tender archive there, without any subscription,
+// recipient or health data. If socket is set, it also accepts control
+// requests, such as from ctl, on that unix socket. rd redacts what the
+// public archive and token API show.
+func serve(addr, publicAddr, socket string, st store, sc *scraper, dg *digester, rd redactions, recordLink recordLinkTemplate) error {
+	title := sc.sources.subject()
+	brands := sc.sources.brands()
+	errc := make(chan error, 3)
+	if socket != "" {
+		ctl := http.NewServeMux()
+		controlRoutes(ctl, st, sc, dg)
+		go func() {
+			slog.Info("control socket listening", "socket", socket)
+			errc <- listenControl(socket, ctl)
+		}()
+	}
+	if publicAddr != "" {
+		pub := http.NewServeMux()
+		publicRoutes(pub, st, title, brands, "", rd)
+		go func() {
+			slog.Info("public archive listening", "addr", publicAddr)
+			errc <- http.ListenAndServe(publicAddr, pub)
+		}()
+	}
+
+	mux := http.NewServeMux()
+	publicRoutes(mux, st, title, brands, recordLink, nil)
+	mux.Handle("GET /metrics", metricsHandler(st, sc.sources.names()))
+	mux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
+		hs, err := st.sourceHealth()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		paused, err := st.notificationsPaused()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		data := struct {
+			Paused  time.Time
+			Sources []sourceHealth
+		}{paused, hs}
+		if err := healthTmpl.Execute(w, data); err != nil {
+			slog.Error("rendering health", "err", err)
+		}
+	})
+
+	mux.HandleFunc("POST /api/recipients/{email}/pause", requireScope(st, "write", func(w http.ResponseWriter, r *http.Request) {
+		if err := st.pauseRecipient(r.PathValue("email"), apiActor(r)); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	mux.HandleFunc("POST /api/recipients/{email}/resume", requireScope(st, "write", func(w http.ResponseWriter, r *http.Request) {
+		if err := st.resumeRecipient(r.PathValue("email"), apiActor(r)); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	mux.HandleFunc("POST /notifications/pause", requireScope(st, "write", func(w http.ResponseWriter, r *http.Request) {
+		if err := st.pauseNotifications(apiActor(r)); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/health", http.StatusSeeOther)
+	}))
+	mux.HandleFunc("POST /notifications/resume", requireScope(st, "write", func(w http.ResponseWriter, r *http.Request) {
+		if err := st.resumeNotifications(apiActor(r)); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/health", http.StatusSeeOther)
+	}))
+	mux.HandleFunc("POST /api/notifications/pause", requireScope(st, "write", func(w http.ResponseWriter, r *http.Request) {
+		if err := st.pauseNotifications(apiActor(r)); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	mux.HandleFunc("POST /api/notifications/resume", requireScope(st, "write", func(w http.ResponseWriter, r *http.Request) {
+		if err := st.resumeNotifications(apiActor(r)); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	mux.HandleFunc("GET /api/preview/{recipient}", requireScope(st, "read", func(w http.ResponseWriter, r *http.Request) {
+		var b strings.Builder
+		if err := dg.preview(r.Context(), &b, st, r.PathValue("recipient")); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		io.WriteString(w, b.String())
+	}))
+
+	mux.HandleFunc("GET /api/tenders/{id}/snapshot", requireScope(st, "read", func(w http.ResponseWriter, r *http.Request) {
+		at := time.Now()
+		if v := r.FormValue("as_of"); v != "" {
+			var err error
+			if at, err = parseAsOf(v); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		sn, err := st.snapshotAsOf(r.PathValue("id"), at)
+		if err == sql.ErrNoRows {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if sn.Data, err = rd.applyRaw("api", sn.Data); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(sn)
+	}))
+
+	mux.HandleFunc("POST /api/inbound/email", requireScope(st, "write", inboundHandler(st, sc)))
+	mux.HandleFunc("POST /api/fetch", requireScope(st, "write", fetchHandler(st, sc)))
+
+	mux.HandleFunc("GET /searches", requireScope(st, "read", func(w http.ResponseWriter, r *http.Request) {
+		ss, err := st.savedSearches()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := searchesTmpl.Execute(w, ss); err != nil {
+			slog.Error("rendering searches", "err", err)
+		}
+	}))
+	mux.HandleFunc("POST /searches", requireScope(st, "write", func(w http.ResponseWriter, r *http.Request) {
+		name, query := strings.TrimSpace(r.FormValue("name")), strings.TrimSpace(r.FormValue("query"))
+		if name == "" || query == "" {
+			http.Error(w, "name and query are required", http.StatusBadRequest)
+			return
+		}
+		if _, err := st.createSearch(name, query, apiActor(r)); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/searches", http.StatusSeeOther)
+	}))
+	mux.HandleFunc("POST /searches/{id}/delete", requireScope(st, "write", func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "bad id", http.StatusBadRequest)
+			return
+		}
+		if err := st.deleteSearch(id, apiActor(r)); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/searches", http.StatusSeeOther)
+	}))
+	mux.HandleFunc("POST /searches/{id}/subscriptions", requireScope(st, "write", func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "bad id", http.StatusBadRequest)
+			return
+		}
+		if err := st.subscribeSearch(id, r.FormValue("channel"), strings.TrimSpace(r.FormValue("target")), apiActor(r)); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Redirect(w, r, "/searches", http.StatusSeeOther)
+	}))
+	mux.HandleFunc("POST /searches/{id}/subscriptions/{sub}/delete", requireScope(st, "write", func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "bad id", http.StatusBadRequest)
+			return
+		}
+		subID, err := strconv.ParseInt(r.PathValue("sub"), 10, 64)
+		if err != nil {
+			http.Error(w, "bad subscription id", http.StatusBadRequest)
+			return
+		}
+		if err := st.unsubscribeSearch(id, subID, apiActor(r)); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/searches", http.StatusSeeOther)
+	}))
+
+	go func() {
+		slog.Info("listening", "addr", addr)
+		errc <- http.ListenAndServe(addr, mux)
+	}()
+	return <-errc
+}
+
+// publicRoutes registers the endpoints safe to expose to anyone on mux,
+// with what rd redacts for the public left out.
+func publicRoutes(mux *http.ServeMux, st store, title string, brands agencyBrands, recordLink recordLinkTemplate, rd redactions) {
+	mux.HandleFunc("GET /agencies/{agency}/logo", func(w http.ResponseWriter, r *http.Request) {
+		b, ok := brands[r.PathValue("agency")]
+		if !ok || len(b.logo) == 0 {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", b.logoType)
+		w.Write(b.logo)
+	})
+	mux.HandleFunc("GET /r/{token}", func(w http.ResponseWriter, r *http.Request) {
+		u, err := st.followShortLink(r.PathValue("token"))
+		if err == sql.ErrNoRows {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, u, http.StatusFound)
+	})
+	mux.HandleFunc("GET /feed.atom", func(w http.ResponseWriter, r *http.Request) {
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+		if err := writeFeed(w, st, title, scheme+"://"+r.Host+r.URL.Path, rd); err != nil {
+			slog.Error("writing feed", "err", err)
+		}
+	})
+	mux.HandleFunc("GET /tenders", func(w http.ResponseWriter, r *http.Request) {
+		q := tenderQuery{
+			Search: strings.TrimSpace(r.FormValue("q")),
+			Agency: r.FormValue("agency"),
+		}
+		var err error
+		if v := r.FormValue("closes_from"); v != "" {
+			if q.ClosesFrom, err = time.Parse(dateFormat, v); err != nil {
+				http.Error(w, "bad closes_from date", http.StatusBadRequest)
+				return
+			}
+		}
+		if v := r.FormValue("closes_to"); v != "" {
+			if q.ClosesTo, err = time.Parse(dateFormat, v); err != nil {
+				http.Error(w, "bad closes_to date", http.StatusBadRequest)
+				return
+			}
+		}
+		page := 1
+		if v := r.FormValue("page"); v != "" {
+			if page, err = strconv.Atoi(v); err != nil || page < 1 {
+				http.Error(w, "bad page", http.StatusBadRequest)
+				return
+			}
+		}
+
+		ts, total, err := st.queryTenders(q, tendersPerPage, (page-1)*tendersPerPage)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for i := range ts {
+			rd.apply("public", &ts[i].Tender)
+		}
+		agencies, err := st.agencies()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		pageURL := func(p int) string {
+			v := r.URL.Query()
+			v.Set("page", strconv.Itoa(p))
+			return "/tenders?" + v.Encode()
+		}
+		data := struct {
+			Query    tenderQuery
+			Agencies []string
+			Brands   agencyBrands
+			Records  recordLinkTemplate
+			Tenders  []archivedTender
+			Total    int
+			Page     int
+			Pages    int
+			Prev     string
+			Next     string
+		}{Query: q, Agencies: agencies, Brands: brands, Records: recordLink, Tenders: ts, Total: total, Page: page}
+		data.Pages = max(1, (total+tendersPerPage-1)/tendersPerPage)
+		if page > 1 {
+			data.Prev = pageURL(page - 1)
+		}
+		if page < data.Pages {
+			data.Next = pageURL(page + 1)
+		}
+		if err := tendersTmpl.Execute(w, data); err != nil {
+			slog.Error("rendering tenders", "err", err)
+		}
+	})
+	mux.HandleFunc("GET /tenders/{id}", func(w http.ResponseWriter, r *http.Request) {
+		t, err := st.archivedTender(r.PathValue("id"))
+		if err == sql.ErrNoRows {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := st.loadDetails(&t.Tender); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		rd.apply("public", &t.Tender)
+		retracted, err := st.retraction(t.ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		similar, err := st.similarTenders(t.ID, 10)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		series, err := st.series(t.ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		data := struct {
+			archivedTender
+			Brand      agencyBrand
+			RecordLink string
+			Retracted  *retraction
+			Series     []archivedTender
+			Similar    []similarTender
+		}{t, brands[t.Agency], recordLink.For(t.ID), retracted, series, similar}
+		if err := tenderTmpl.Execute(w, data); err != nil {
+			slog.Error("rendering tender", "err", err)
+		}
+	})
+}
+
+// tendersPerPage is how many tenders a page of the archive lists.
+const tendersPerPage = 50
+
+// apiActor identifies the caller of an API request for the audit log, by
+// token name if it was authenticated.
+func apiActor(r *http.Request) string {
+	if name, ok := r.Context().Value(tokenNameKey{}).(string); ok {
+		return "token:" + name
+	}
+	return "api:" + r.RemoteAddr
+}
+
+var healthTmpl = template.Must(template.New("health").Parse(`<!doctype html>
+<title>Source health</title>
+<h1>Source health</h1>
+{{if .Paused.IsZero}}<form method="post" action="/notifications/pause">Notifications are on. <button>Pause notifications</button></form>
+{{else}}<form method="post" action="/notifications/resume"><strong>Notifications paused since {{.Paused.Format "2006-01-02 15:04"}}.</strong> New tenders are still scraped and stored, and will be sent on resuming. <button>Resume notifications</button></form>
+{{end}}<table>
+<tr><th>Source</th><th>Runs</th><th>Success</th><th>Last success</th><th>Avg duration</th><th>Recent errors</th></tr>
+{{range .Sources}}<tr>
+<td>{{.Source}}</td>
+<td>{{.Runs}}</td>
+<td>{{printf "%.0f%%" .SuccessPercent}}</td>
+<td>{{if .LastSuccess.IsZero}}never{{else}}{{.LastSuccess.Format "2006-01-02 15:04"}}{{end}}</td>
+<td>{{.AvgDuration}}</td>
+<td>{{range .RecentErrors}}{{.Started.Format "2006-01-02 15:04"}}: {{.Error}}<br>{{end}}</td>
+</tr>
+{{end}}</table>
+`))
+
+var searchesTmpl = template.Must(template.New("searches").Parse(`<!doctype html>
+<title>Saved searches</title>
+<h1>Saved searches</h1>
+<p>Each saved search gets its own digest of new tenders whose description contains all of its words. Prefix a word with - to exclude it. SMS subscribers get a short text per matching tender instead, and phone call subscribers get a call reading them out, so keep calls for the most time-critical searches.</p>
+{{range $s := .}}
+<h2>{{.Name}}</h2>
+<p><code>{{.Query}}</code></p>
+<ul>
+{{range $sub := .Subscriptions}}<li>{{$sub.Channel}}: {{$sub.Target}}
+<form method="post" action="/searches/{{$s.ID}}/subscriptions/{{$sub.ID}}/delete" style="display: inline"><button>Remove</button></form></li>
+{{end}}</ul>
+<form method="post" action="/searches/{{.ID}}/subscriptions">
+<select name="channel"><option value="email">Email</option><option value="sms">SMS</option><option value="voice">Phone call</option></select>
+<input name="target" placeholder="address or +19025551234" required>
+<button>Subscribe</button>
+</form>
+<form method="post" action="/searches/{{.ID}}/delete"><button>Delete search</button></form>
+{{end}}
+<h2>New search</h2>
+<form method="post" action="/searches">
+<input name="name" placeholder="name" required>
+<input name="query" placeholder="paving -janitorial" required>
+<button>Create</button>
+</form>
+`))
+
+var tendersTmpl = template.Must(template.New("tenders").Parse(`<!doctype html>
+<title>Tenders</title>
+<h1>Tenders</h1>
+<form method="get" action="/tenders">
+<input name="q" value="{{.Query.Search}}" placeholder="paving -janitorial">
+<select name="agency"><option value="">All agencies</option>
+{{range .Agencies}}<option value="{{.}}"{{if eq . $.Query.Agency}} selected{{end}}>{{$.Brands.Name .}}</option>
+{{end}}</select>
+<label>Closing from <input type="date" name="closes_from" value="{{if not .Query.ClosesFrom.IsZero}}{{.Query.ClosesFrom.Format "2006-01-02"}}{{end}}"></label>
+<label>to <input type="date" name="closes_to" value="{{if not .Query.ClosesTo.IsZero}}{{.Query.ClosesTo.Format "2006-01-02"}}{{end}}"></label>
+<button>Search</button>
+</form>
+<p>{{.Total}} tenders{{if gt .Pages 1}}, page {{.Page}} of {{.Pages}}{{end}}</p>
+<table>
+<tr><th>Tender</th><th>ID</th><th>Agency</th><th>Issued</th><th>Closes</th></tr>
+{{range .Tenders}}<tr>
+<td><a href="/tenders/{{.ID}}">{{.Description}}</a></td>
+<td>{{if $.Records}}<a href="{{$.Records.For .ID}}">{{.ID}}</a>{{else}}{{.ID}}{{end}}</td>
+{{- $b := index $.Brands .Agency}}
+<td{{with $b.Color}} style="border-left: 4px solid {{.}}; padding-left: 4px"{{end}}>{{if $b.Logo}}<img src="/agencies/{{.Agency}}/logo" alt="" height="16"> {{end}}{{$.Brands.Name .Agency}}</td>
+<td>{{.IssuedDate.Format "2006-01-02"}}</td>
+<td>{{.CloseDate.Format "2006-01-02"}}</td>
+</tr>
+{{end}}</table>
+<p>{{if .Prev}}<a href="{{.Prev}}">Newer</a>{{end}} {{if .Next}}<a href="{{.Next}}">Older</a>{{end}}</p>
+`))
+
+var tenderTmpl = template.Must(template.New("tender").Parse(`<!doctype html>
+<title>{{.Description}}</title>
+<h1>{{.Description}}</h1>
+<dl>
+<dt>ID</dt><dd>{{if .RecordLink}}<a href="{{.RecordLink}}">{{.ID}}</a>{{else}}{{.ID}}{{end}}</dd>
+<dt>Agency</dt><dd{{with .Brand.Color}} style="border-left: 4px solid {{.}}; padding-left: 4px"{{end}}>{{if .Brand.Logo}}<img src="/agencies/{{.Agency}}/logo" alt="" height="24"> {{end}}{{or .Brand.Name .Agency}}</dd>
+<dt>Issued</dt><dd>{{.IssuedDate.Format "2006-01-02"}}</dd>
+<dt>Closes</dt><dd>{{.CloseDate.Format "2006-01-02"}}</dd>
+<dt>First seen</dt><dd>{{.FirstObserved.Format "2006-01-02 15:04"}}</dd>
+{{- if .BidSecurity}}
+<dt>Bid security</dt><dd>{{.BidSecurity}}</dd>
+{{- end}}
+{{- if .TradeTerms}}
+<dt>Trade terms</dt><dd>{{.TradeTerms}}</dd>
+{{- end}}
+{{- range .Events}}
+<dt>Event</dt><dd>{{.}}</dd>
+{{- end}}
+{{- range .Contacts}}
+<dt>Contact</dt><dd>{{.}}</dd>
+{{- end}}
+</dl>
+{{- with .Retracted}}
+<p><strong>Retracted {{.At.Format "2006-01-02"}}: {{.Reason}}</strong></p>
+{{- end}}
+<p><a href="{{.URL}}">View on the source site</a></p>
+{{- with .Detail}}
+{{- if .Scope}}
+<h2>Scope</h2>
+<p style="white-space: pre-wrap">{{.Scope}}</p>
+{{- end}}
+{{- if .Documents}}
+<h2>Documents</h2>
+<ul>
+{{range .Documents}}<li>{{.Name}}{{if .Posted}} ({{.Posted}}){{end}}</li>
+{{end}}</ul>
+{{- end}}
+{{- if .Addenda}}
+<h2>Addenda</h2>
+<ul>
+{{range .Addenda}}<li>{{.Name}}{{if .Posted}} ({{.Posted}}){{end}}</li>
+{{end}}</ul>
+{{- end}}
+{{- end}}
+{{- if .Series}}
+<h2>Other years</h2>
+<table>
+<tr><th>Issued</th><th>Tender</th><th>Closed</th></tr>
+{{range .Series}}<tr>
+<td>{{.IssuedDate.Format "2006-01-02"}}</td>
+<td><a href="/tenders/{{.ID}}">{{.Description}}</a></td>
+<td>{{.CloseDate.Format "2006-01-02"}}</td>
+</tr>
+{{end}}</table>
+{{- end}}
+{{- if .Similar}}
+<h2>Similar tenders</h2>
+<table>
+<tr><th>Tender</th><th>Issued</th><th>Closed</th><th>Similarity</th></tr>
+{{range .Similar}}<tr>
+<td><a href="/tenders/{{.ID}}">{{.Description}}</a></td>
+<td>{{.IssuedDate.Format "2006-01-02"}}</td>
+<td>{{.CloseDate.Format "2006-01-02"}}</td>
+<td>{{printf "%.0f%%" .Percent}}</td>
+</tr>
+{{end}}</table>
+{{- end}}
+`))
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+)
+
+type sesProvider struct {
+	client           *sesv2.Client
+	region           string
+	configurationSet string
+}
+
+// newSESProvider uses the default AWS credential chain. region overrides
+// the region from the environment or shared config if set.
+func newSESProvider(ctx context.Context, region, configurationSet string) (*sesProvider, error) {
+	var opts []func(*config.LoadOptions) error
+	if region != "" {
+		opts = append(opts, config.WithRegion(region))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &sesProvider{client: sesv2.NewFromConfig(cfg), region: cfg.Region, configurationSet: configurationSet}, nil
+}
+
+func (p *sesProvider) send(ctx context.Context, m message) error {
+	var bcc []string
+	for _, a := range m.bcc {
+		bcc = append(bcc, a.String())
+	}
+
+	in := &sesv2.SendEmailInput{
+		FromEmailAddress: aws.String(m.from.String()),
+		Destination: &types.Destination{
+			ToAddresses:  []string{m.from.String()},
+			BccAddresses: bcc,
+		},
+		Content: &types.EmailContent{
+			Simple: &types.Message{
+				Subject: &types.Content{Data: aws.String(m.subject), Charset: aws.String("UTF-8")},
+				Body: &types.Body{
+					Html: &types.Content{Data: aws.String(m.html), Charset: aws.String("UTF-8")},
+				},
+			},
+		},
+	}
+	if m.text != "" {
+		in.Content.Simple.Body.Text = &types.Content{Data: aws.String(m.text), Charset: aws.String("UTF-8")}
+	}
+	for _, i := range m.inline {
+		in.Content.Simple.Attachments = append(in.Content.Simple.Attachments, types.Attachment{
+			FileName:           aws.String(i.filename()),
+			RawContent:         i.data,
+			ContentType:        aws.String(i.contentType),
+			ContentId:          aws.String(i.cid),
+			ContentDisposition: types.AttachmentContentDispositionInline,
+		})
+	}
+	for _, f := range m.attachments {
+		in.Content.Simple.Attachments = append(in.Content.Simple.Attachments, types.Attachment{
+			FileName:           aws.String(f.filename),
+			RawContent:         f.data,
+			ContentType:        aws.String(f.contentType),
+			ContentDisposition: types.AttachmentContentDispositionAttachment,
+		})
+	}
+	if p.configurationSet != "" {
+		in.ConfigurationSetName = aws.String(p.configurationSet)
+	}
+
+	_, err := p.client.SendEmail(ctx, in)
+	if err == nil {
+		return nil
+	}
+
+	pe := &providerError{provider: "ses", msg: err.Error()}
+	var re *awshttp.ResponseError
+	if errors.As(err, &re) {
+		pe.status = re.HTTPStatusCode()
+	}
+
+	var (
+		rejected  *types.MessageRejected
+		mailFrom  *types.MailFromDomainNotVerifiedException
+		notFound  *types.NotFoundException
+		paused    *types.SendingPausedException
+		suspended *types.AccountSuspendedException
+		throttled *types.TooManyRequestsException
+		limit     *types.LimitExceededException
+	)
+	switch {
+	case errors.As(err, &rejected) && strings.Contains(rejected.ErrorMessage(), "not verified"):
+		pe.msg = "account is in the SES sandbox in " + p.region + ", so every recipient must be a verified identity; verify them or request production access: " + rejected.ErrorMessage()
+	case errors.As(err, &rejected):
+		pe.msg = "message rejected: " + rejected.ErrorMessage()
+	case errors.As(err, &mailFrom):
+		pe.msg = "custom MAIL FROM domain not verified in " + p.region + ": " + mailFrom.ErrorMessage()
+	case errors.As(err, &notFound):
+		pe.msg = "not found, check the configuration set " + p.configurationSet + " exists in " + p.region + ": " + notFound.ErrorMessage()
+	case errors.As(err, &paused):
+		pe.msg = "sending is paused for this account or configuration set: " + paused.ErrorMessage()
+	case errors.As(err, &suspended):
+		pe.msg = "account suspended from sending: " + suspended.ErrorMessage()
+	case errors.As(err, &throttled):
+		pe.rateLimited = true
+	case errors.As(err, &limit):
+		pe.msg = "sending quota exceeded: " + limit.ErrorMessage()
+	}
+	return pe
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// notificationsPausedKey is the setting that, when set, holds back all
+// notifications. What's pending stays queued in the store until resumed.
+const notificationsPausedKey = "notifications_paused"
+
+// setting returns the value of key, or "" if it isn't set.
+func (s store) setting(key string) (string, error) {
+	var v string
+	err := s.db.QueryRow("select value from settings where key = ?", key).Scan(&v)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return v, err
+}
+
+// setSetting sets key to value, or clears it if value is "".
+func (s store) setSetting(key, value, actor string) error {
+	var err error
+	if value == "" {
+		_, err = s.db.Exec("delete from settings where key = ?", key)
+	} else {
+		_, err = s.db.Exec("insert into settings (key, value) values (?, ?) on conflict (key) do update set value = excluded.value", key, value)
+	}
+	if err != nil {
+		return fmt.Errorf("set %s: %v", key, err)
+	}
+	return s.audit(actor, "set", key, value)
+}
+
+// notificationsPaused returns when notifications were paused, or the zero
+// time if they aren't.
+func (s store) notificationsPaused() (time.Time, error) {
+	v, err := s.setting(notificationsPausedKey)
+	if err != nil || v == "" {
+		return time.Time{}, err
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
+// pauseNotifications pauses notifications, keeping when they were first
+// paused if they already are.
+func (s store) pauseNotifications(actor string) error {
+	paused, err := s.notificationsPaused()
+	if err != nil || !paused.IsZero() {
+		return err
+	}
+	return s.setSetting(notificationsPausedKey, time.Now().UTC().Format(time.RFC3339), actor)
+}
+
+func (s store) resumeNotifications(actor string) error {
+	return s.setSetting(notificationsPausedKey, "", actor)
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+)
+
+// shadowCopy copies the database at src to dst, which must not exist yet,
+// so a run can write to the copy while src stays untouched.
+func shadowCopy(src, dst string) error {
+	if _, err := os.Stat(dst); err == nil {
+		return fmt.Errorf("shadow database %s already exists", dst)
+	}
+
+	db, err := sql.Open("sqlite", "file:"+src+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if _, err := db.Exec("vacuum into ?", dst); err != nil {
+		return fmt.Errorf("copying %s to %s: %w", src, dst, err)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// linkShortener turns long portal URLs into short ones served by serve's
+// /r/ redirects, for channels like SMS where long URLs are unwieldy.
+type linkShortener struct {
+	st store
+	// base is the URL serve is reachable at, such as
+	// https://tenders.example.com. Links aren't shortened without it.
+	base string
+}
+
+// shorten returns a short link for u, or u itself if shortening isn't
+// configured or fails.
+func (l linkShortener) shorten(u string) string {
+	if l.base == "" {
+		return u
+	}
+	token, err := l.st.shortLink(u)
+	if err != nil {
+		slog.Error("shortening link", "url", u, "err", err)
+		return u
+	}
+	return strings.TrimSuffix(l.base, "/") + "/r/" + token
+}
+
+// shortLink returns the token for u, creating one if needed.
+func (s store) shortLink(u string) (string, error) {
+	var token string
+	err := s.db.QueryRow("select token from short_links where url = ?", u).Scan(&token)
+	if err == nil {
+		return token, nil
+	}
+	if err != sql.ErrNoRows {
+		return "", err
+	}
+
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	if _, err := s.db.Exec("insert into short_links (token, url, created, clicks) values (?, ?, ?, 0)", token, u, time.Now()); err != nil {
+		return "", fmt.Errorf("insert short link: %v", err)
+	}
+	return token, nil
+}
+
+// followShortLink returns the URL for token and counts the click, or
+// returns sql.ErrNoRows.
+func (s store) followShortLink(token string) (string, error) {
+	var u string
+	if err := s.db.QueryRow("select url from short_links where token = ?", token).Scan(&u); err != nil {
+		return "", err
+	}
+	if _, err := s.db.Exec("update short_links set clicks = clicks + 1, last_click = ? where token = ?", time.Now(), token); err != nil {
+		return "", err
+	}
+	return u, nil
+}
+
+func printShortLinks(w io.Writer, st store) error {
+	rows, err := st.db.Query("select token, url, clicks, last_click from short_links order by created")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TOKEN\tCLICKS\tLAST CLICK\tURL")
+	for rows.Next() {
+		var token, u string
+		var clicks int
+		var last sql.NullTime
+		if err := rows.Scan(&token, &u, &clicks, &last); err != nil {
+			return err
+		}
+		lastClick := "never"
+		if last.Valid {
+			lastClick = last.Time.Format(time.RFC3339)
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\n", token, clicks, lastClick, u)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return tw.Flush()
+}
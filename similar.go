@@ -0,0 +1,121 @@
+package main
+
+import (
+	"database/sql"
+	"math"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// similarTender is a stored tender along with how similar it is to the one
+// being compared against, from 0 to 1.
+type similarTender struct {
+	archivedTender
+	Score float64
+}
+
+func (t similarTender) Percent() float64 {
+	return 100 * t.Score
+}
+
+var similarityStopwords = map[string]bool{
+	"and": true, "the": true, "for": true, "of": true, "to": true, "in": true,
+	"on": true, "at": true, "a": true, "an": true, "with": true, "by": true,
+	"or": true, "from": true, "services": true, "service": true, "supply": true,
+	"delivery": true, "request": true, "proposal": true, "proposals": true,
+	"tender": true, "rfp": true, "rfq": true, "rfsq": true, "hrm": true,
+	"halifax": true, "municipality": true, "regional": true,
+}
+
+// similarityTerms splits s into lower case words, leaving out numbers,
+// stopwords and words too short to say much.
+func similarityTerms(s string) []string {
+	var terms []string
+	for _, w := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }) {
+		if len(w) < 3 || similarityStopwords[w] || strings.IndexFunc(w, unicode.IsLetter) < 0 {
+			continue
+		}
+		terms = append(terms, w)
+	}
+	return terms
+}
+
+// similarTenders returns up to limit stored tenders most similar to the
+// one with id, by cosine similarity of the TF-IDF weighted terms of their
+// descriptions. It returns sql.ErrNoRows if there's no tender with id.
+func (s store) similarTenders(id string, limit int) ([]similarTender, error) {
+	all, err := s.recentTenders(math.MaxInt32)
+	if err != nil {
+		return nil, err
+	}
+
+	target := -1
+	df := make(map[string]int)
+	tfs := make([]map[string]float64, len(all))
+	for i, t := range all {
+		if t.ID == id {
+			target = i
+		}
+		tf := make(map[string]float64)
+		for _, term := range similarityTerms(t.Description) {
+			tf[term]++
+		}
+		for term := range tf {
+			df[term]++
+		}
+		tfs[i] = tf
+	}
+	if target < 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	n := float64(len(all))
+	vec := func(tf map[string]float64) (map[string]float64, float64) {
+		v := make(map[string]float64, len(tf))
+		var norm float64
+		for term, c := range tf {
+			w := c * math.Log(1+n/float64(df[term]))
+			v[term] = w
+			norm += w * w
+		}
+		return v, math.Sqrt(norm)
+	}
+
+	tv, tnorm := vec(tfs[target])
+	if tnorm == 0 {
+		return nil, nil
+	}
+
+	var res []similarTender
+	for i, t := range all {
+		if i == target {
+			continue
+		}
+		v, norm := vec(tfs[i])
+		if norm == 0 {
+			continue
+		}
+		var dot float64
+		for term, w := range v {
+			dot += w * tv[term]
+		}
+		if dot == 0 {
+			continue
+		}
+		res = append(res, similarTender{archivedTender: t, Score: dot / (norm * tnorm)})
+	}
+	slices.SortStableFunc(res, func(a, b similarTender) int {
+		switch {
+		case a.Score > b.Score:
+			return -1
+		case a.Score < b.Score:
+			return 1
+		}
+		return 0
+	})
+	if len(res) > limit {
+		res = res[:limit]
+	}
+	return res, nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// slack is a channel that posts digests to a Slack incoming webhook.
+type slack struct {
+	webhookURL string
+	subject    string
+	// closingSoon is how close to its close date a tender gets flagged.
+	closingSoon time.Duration
+	// out, if set, gets the messages instead, for notify -dry-run.
+	out io.Writer
+}
+
+func (s slack) name() string { return "slack" }
+
+// slackMaxBlocks is the most blocks Slack takes in one message.
+const slackMaxBlocks = 50
+
+type slackBlock struct {
+	Type string     `json:"type"`
+	Text *slackText `json:"text,omitempty"`
+}
+
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+func slackSection(mrkdwn string) slackBlock {
+	return slackBlock{Type: "section", Text: &slackText{Type: "mrkdwn", Text: mrkdwn}}
+}
+
+// slackEscape escapes the characters Slack treats as markup in text.
+var slackEscape = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+func (s slack) notify(ctx context.Context, ts []Tender, u updates) error {
+	if len(ts) == 0 && u.empty() {
+		return nil
+	}
+
+	var blocks []slackBlock
+	for _, g := range groupListings(ts) {
+		t := g[0]
+		title := fmt.Sprintf("*<%s|%s>*", t.URL, slackEscape.Replace(t.Description))
+		if closingSoon(t, s.closingSoon, time.Now()) {
+			title += " :hourglass_flowing_sand: closing soon"
+		}
+		line := fmt.Sprintf("%s\n%s · Issued %s · Closes %s", title, slackEscape.Replace(t.Agency), t.IssuedDate.Format("Mon, 02 Jan 2006"), t.CloseDate.Format("Mon, 02 Jan 2006"))
+		for _, o := range g[1:] {
+			line += fmt.Sprintf("\nAlso listed by <%s|%s>", o.URL, slackEscape.Replace(o.Agency))
+		}
+		blocks = append(blocks, slackSection(line))
+	}
+
+	statusChanges, changes := splitStatusChanges(u.changes)
+	var notes []string
+	for _, c := range changes {
+		notes = append(notes, fmt.Sprintf("• %s (%s): %s", slackEscape.Replace(c.Description), c.TenderID, c))
+	}
+	for _, r := range u.retractions {
+		notes = append(notes, fmt.Sprintf("• %s (%s) withdrawn, %s", slackEscape.Replace(r.Description), r.TenderID, r.Reason))
+	}
+	for _, r := range u.reminders {
+		notes = append(notes, fmt.Sprintf("• Questions for %s (%s) due %s", slackEscape.Replace(r.Description), r.TenderID, r.At.Format("Mon, 02 Jan 2006 15:04")))
+	}
+	for _, a := range u.alerts {
+		notes = append(notes, fmt.Sprintf("• %s of %s mentions %q", slackEscape.Replace(a.Name), a.TenderID, a.Keyword))
+	}
+	if len(notes) > 0 {
+		blocks = append(blocks, slackBlock{Type: "divider"})
+		blocks = append(blocks, slackList("*Updates on known tenders*", notes)...)
+	}
+	if len(statusChanges) > 0 {
+		var lines []string
+		for _, c := range statusChanges {
+			lines = append(lines, fmt.Sprintf("• %s (%s): %s to %s", slackEscape.Replace(c.Description), c.TenderID, c.Old, c.New))
+		}
+		blocks = append(blocks, slackBlock{Type: "divider"})
+		blocks = append(blocks, slackList("*Status changes*", lines)...)
+	}
+
+	header := slackBlock{Type: "header", Text: &slackText{Type: "plain_text", Text: s.subject}}
+	for len(blocks) > 0 {
+		n := min(len(blocks), slackMaxBlocks-1)
+		msg := struct {
+			Text   string       `json:"text"`
+			Blocks []slackBlock `json:"blocks"`
+		}{fmt.Sprintf("%s: %d new", s.subject, len(ts)), append([]slackBlock{header}, blocks[:n]...)}
+		blocks = blocks[n:]
+		if err := s.post(ctx, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// slackList returns sections listing lines under title, as many as it
+// takes to keep each within slackMaxText.
+func slackList(title string, lines []string) []slackBlock {
+	var blocks []slackBlock
+	text := title
+	for _, l := range lines {
+		if len(text)+1+len(l) > slackMaxText && text != "" {
+			blocks = append(blocks, slackSection(text))
+			text = ""
+		}
+		if text != "" {
+			text += "\n"
+		}
+		text += l
+	}
+	return append(blocks, slackSection(text))
+}
+
+func (s slack) post(ctx context.Context, msg any) error {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if s.out != nil {
+		_, err := fmt.Fprintf(s.out, "Slack:\n%s\n\n", b)
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", s.webhookURL, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return &providerError{provider: "slack", status: resp.StatusCode, msg: strings.TrimSpace(string(body))}
+	}
+	return nil
+}
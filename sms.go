@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// smsGateway sends a text message.
+type smsGateway interface {
+	sendSMS(ctx context.Context, to, body string) error
+}
+
+// twilio sends texts and places calls with Twilio's REST API.
+type twilio struct {
+	accountSID, authToken string
+	// from is the Twilio number, or messaging service SID for texts, to
+	// send from.
+	from string
+}
+
+func (g twilio) sendSMS(ctx context.Context, to, body string) error {
+	form := url.Values{"To": {to}, "Body": {body}}
+	if strings.HasPrefix(g.from, "MG") {
+		form.Set("MessagingServiceSid", g.from)
+	} else {
+		form.Set("From", g.from)
+	}
+	return g.post(ctx, "Messages.json", form)
+}
+
+func (g twilio) post(ctx context.Context, resource string, form url.Values) error {
+	u := "https://api.twilio.com/2010-04-01/Accounts/" + url.PathEscape(g.accountSID) + "/" + resource
+	req, err := http.NewRequestWithContext(ctx, "POST", u, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(g.accountSID, g.authToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 300 {
+		return nil
+	}
+
+	pe := &providerError{provider: "twilio", status: resp.StatusCode}
+	var res struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+	if json.NewDecoder(resp.Body).Decode(&res) == nil {
+		pe.msg = fmt.Sprintf("%d: %s", res.Code, res.Message)
+	}
+	switch resp.StatusCode {
+	case http.StatusUnauthorized:
+		pe.msg = "credentials rejected, check TWILIO_ACCOUNT_SID and TWILIO_AUTH_TOKEN: " + pe.msg
+	case http.StatusTooManyRequests:
+		pe.rateLimited = true
+		pe.retryAfter = retryAfter(resp.Header)
+	}
+	return pe
+}
+
+var phoneRe = regexp.MustCompile(`^\+[1-9]\d{6,14}$`)
+
+// maxSMSPerRun is how many tenders a subscriber gets a text about per run
+// before the rest are summarized in one more text.
+const maxSMSPerRun = 3
+
+// notifySMS texts each of to about ts, matching the saved search name.
+// Tenders closing within horizon are flagged.
+func notifySMS(ctx context.Context, g smsGateway, links linkShortener, horizon time.Duration, name string, to []string, ts []Tender) error {
+	if len(ts) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	var bodies []string
+	for i, t := range ts {
+		if i == maxSMSPerRun {
+			bodies = append(bodies, fmt.Sprintf("+%d more new tenders matching %s", len(ts)-i, name))
+			break
+		}
+		bodies = append(bodies, smsBody(t, links.shorten(t.URL), closingSoon(t, horizon, now)))
+	}
+
+	var errs []string
+	for _, num := range to {
+		for _, b := range bodies {
+			if err := g.sendSMS(ctx, num, b); err != nil {
+				slog.Error("texting", "to", num, "err", err)
+				errs = append(errs, err.Error())
+				break
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%d of %d numbers failed: %s", len(errs), len(to), strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// smsBody describes t in one SMS segment: 160 characters if it can be
+// sent as GSM-7, or 70 otherwise. The description is shortened to fit.
+func smsBody(t Tender, link string, soon bool) string {
+	suffix := " closes " + t.CloseDate.Format("Jan 2") + " " + link
+	if soon {
+		suffix = " CLOSING SOON " + t.CloseDate.Format("Jan 2") + " " + link
+	}
+	desc := squeezeRe.ReplaceAllString(strings.TrimSpace(t.Description), " ")
+
+	budget := 160
+	if !gsm7(desc) {
+		budget = 70
+	}
+	budget -= len(suffix)
+	if utf8.RuneCountInString(desc) > budget {
+		r := []rune(desc)
+		desc = strings.TrimSpace(string(r[:max(0, budget-3)])) + "..."
+	}
+	return desc + suffix
+}
+
+// gsm7 reports whether s only has characters in the basic GSM 03.38
+// alphabet that ASCII shares, so it can be sent as 7-bit text.
+func gsm7(s string) bool {
+	for _, r := range s {
+		if r > 0x7e || (r < 0x20 && r != '\n' && r != '\r') || strings.ContainsRune("`^{}[]~\\|", r) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+)
+
+// volatileRawFields are the portal item's fields that change just with
+// the passing of time, which don't make a new snapshot.
+var volatileRawFields = []string{"DaysLeft", "DaysLeftPublish"}
+
+// tenderSnapshot is a version of a tender's portal item.
+type tenderSnapshot struct {
+	TenderID string `json:"tender_id"`
+	// Version counts from 1 for the first version seen.
+	Version      int             `json:"version"`
+	Observed     time.Time       `json:"observed"`
+	LastObserved time.Time       `json:"last_observed"`
+	Data         json.RawMessage `json:"data"`
+}
+
+// snapshotData returns raw, a portal item, without volatileRawFields and
+// with its keys sorted, so versions compare equal when nothing but time
+// has passed.
+func snapshotData(raw []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var m map[string]any
+	if err := dec.Decode(&m); err != nil {
+		return nil, err
+	}
+	for _, f := range volatileRawFields {
+		delete(m, f)
+	}
+	return json.Marshal(m)
+}
+
+// snapshot records raw, the portal item tenderID was listed as at at,
+// extending the latest version if it's unchanged from that.
+func (s store) snapshot(tenderID string, raw []byte, at time.Time) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	data, err := snapshotData(raw)
+	if err != nil {
+		return fmt.Errorf("snapshot of %s: %w", tenderID, err)
+	}
+
+	var id int64
+	var last []byte
+	err = s.db.QueryRow("select id, data from tender_snapshots where tender_id = ? order by observed desc, id desc limit 1", tenderID).Scan(&id, &last)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("select snapshot: %v", err)
+	}
+	if err == nil {
+		// Versions from before snapshots were kept still have volatile
+		// fields, so normalize them to compare.
+		if prev, err := snapshotData(last); err == nil && bytes.Equal(prev, data) {
+			if _, err := s.db.Exec("update tender_snapshots set last_observed = ? where id = ?", at, id); err != nil {
+				return fmt.Errorf("update snapshot: %v", err)
+			}
+			return nil
+		}
+	}
+	if _, err := s.db.Exec("insert into tender_snapshots (tender_id, observed, last_observed, data) values (?, ?, ?, ?)", tenderID, at, at, data); err != nil {
+		return fmt.Errorf("insert snapshot: %v", err)
+	}
+	return nil
+}
+
+// lastListed returns when the tender with id was last listed, as far as
+// the store knows.
+func (s store) lastListed(id string) (time.Time, error) {
+	var last time.Time
+	if err := s.db.QueryRow("select first_observed from tenders where id = ?", id).Scan(&last); err != nil {
+		return time.Time{}, fmt.Errorf("select first observed: %v", err)
+	}
+	rows, err := s.db.Query("select last_observed from tender_snapshots where tender_id = ?", id)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var at time.Time
+		if err := rows.Scan(&at); err != nil {
+			return time.Time{}, err
+		}
+		if at.After(last) {
+			last = at
+		}
+	}
+	return last, rows.Err()
+}
+
+// snapshotAsOf returns the version of tenderID current at at, or
+// sql.ErrNoRows if the tender hadn't been seen by then.
+func (s store) snapshotAsOf(tenderID string, at time.Time) (tenderSnapshot, error) {
+	sn := tenderSnapshot{TenderID: tenderID}
+	var data []byte
+	err := s.db.QueryRow(`select observed, last_observed, data,
+		(select count(*) from tender_snapshots o where o.tender_id = s.tender_id and (datetime(o.observed) < datetime(s.observed) or (datetime(o.observed) = datetime(s.observed) and o.id <= s.id)))
+		from tender_snapshots s
+		where tender_id = ? and datetime(observed) <= datetime(?)
+		order by datetime(observed) desc, id desc limit 1`, tenderID, at).Scan(&sn.Observed, &sn.LastObserved, &data, &sn.Version)
+	if err != nil {
+		return tenderSnapshot{}, err
+	}
+	sn.Data = data
+	return sn, nil
+}
+
+// backfillTimes fills in the times of day of issued and close dates
+// stored before those were kept, from the tenders' latest snapshots. Dates
+// the snapshot doesn't agree with are left alone.
+func (s store) backfillTimes() error {
+	rows, err := s.db.Query(`select t.id, cast(t.issued as text), cast(t.close as text),
+		(select data from tender_snapshots s where s.tender_id = t.id order by observed desc, id desc limit 1)
+		from tenders t
+		where (length(t.issued) = 10 or length(t.close) = 10)
+		and exists (select 1 from tender_snapshots s where s.tender_id = t.id)`)
+	if err != nil {
+		return err
+	}
+	type row struct {
+		id, issued, close string
+		data              []byte
+	}
+	var dated []row
+	for rows.Next() {
+		var r row
+		if err := rows.Scan(&r.id, &r.issued, &r.close, &r.data); err != nil {
+			rows.Close()
+			return err
+		}
+		dated = append(dated, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	var filled int
+	for _, r := range dated {
+		var d RawTender
+		if err := json.Unmarshal(r.data, &d); err != nil {
+			continue
+		}
+		loc := labelLocation(d.TimeZoneLabel)
+		// timed returns display parsed if it's on date, the stored date.
+		timed := func(date, display string) (time.Time, bool) {
+			t, err := time.ParseInLocation("Mon Jan 2, 2006 3:04:05 PM", display, loc)
+			return t, err == nil && t.Format(dateFormat) == date
+		}
+		if t, ok := timed(r.issued, d.DateAvailableDisplay); ok {
+			if _, err := s.db.Exec("update tenders set issued = ? where id = ?", t, r.id); err != nil {
+				return fmt.Errorf("update issued: %v", err)
+			}
+			filled++
+		}
+		if t, ok := timed(r.close, d.DateClosingDisplay); ok {
+			if _, err := s.db.Exec("update tenders set close = ? where id = ?", t, r.id); err != nil {
+				return fmt.Errorf("update close: %v", err)
+			}
+			filled++
+		}
+	}
+	if filled > 0 {
+		slog.Info("filled in issued and close times of day from snapshots", "tenders", filled)
+	}
+	return nil
+}
+
+// parseAsOf parses v, an RFC 3339 time or a date, which stands for the end
+// of that day.
+func parseAsOf(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	d, err := time.ParseInLocation(dateFormat, v, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("as of %q: want a date like 2024-11-01 or an RFC 3339 time", v)
+	}
+	return d.AddDate(0, 0, 1).Add(-time.Nanosecond), nil
+}
+
+// printSnapshot writes the version of tender id current at at to w.
+func printSnapshot(w io.Writer, st store, id string, at time.Time) error {
+	sn, err := st.snapshotAsOf(id, at)
+	if err != nil {
+		return err
+	}
+	var d RawTender
+	if err := json.Unmarshal(sn.Data, &d); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "%s %s\n", id, d.Title)
+	fmt.Fprintf(w, "As of:      %s, version %d\n", at.Format(time.RFC3339), sn.Version)
+	fmt.Fprintf(w, "Seen:       %s to %s\n", sn.Observed.Format(time.RFC3339), sn.LastObserved.Format(time.RFC3339))
+	fmt.Fprintf(w, "Status:     %s\n", d.Status)
+	fmt.Fprintf(w, "Issued:     %s\n", d.DateAvailableDisplay)
+	fmt.Fprintf(w, "Closes:     %s\n", d.DateClosingDisplay)
+
+	var b bytes.Buffer
+	if err := json.Indent(&b, sn.Data, "", "  "); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "\n%s\n", b.Bytes())
+	return nil
+}
@@ -0,0 +1,21 @@
+package main
+
+import "context"
+
+// Source is a tender portal to scrape.
+type Source interface {
+	// Name identifies the source, such as in run history.
+	Name() string
+	// List returns a page of tenders, most recently issued first, and the
+	// token for the next page. token is "" for the first page, and the
+	// returned token is "" after the last one.
+	List(ctx context.Context, token string) (_ []Tender, nextToken string, _ error)
+	Close() error
+}
+
+// partialLister is a Source that can tell when its listing ended early
+// without failing, such as when the portal stopped serving pages, so the
+// tenders it didn't get to aren't taken for gone.
+type partialLister interface {
+	stoppedShort() bool
+}
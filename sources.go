@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// sourceSpec is a bids&tenders portal to scrape and the agency its
+// tenders are attributed to.
+type sourceSpec struct {
+	url    string
+	agency string
+	brand  agencyBrand
+}
+
+// agencyBrand is how an agency's section of a digest and its tenders in
+// the archive are shown when there's more than one agency.
+type agencyBrand struct {
+	// Name is the agency's display name, such as Halifax Water.
+	Name string
+	// Color is a CSS hex colour, such as #1f6feb, to mark the agency's
+	// sections with.
+	Color string
+	// Logo is the image file shown in the agency's sections, and logo its
+	// contents, of logoType.
+	Logo     string
+	logo     []byte
+	logoType string
+}
+
+// imageType returns the content type of the image file name with data,
+// going by its extension since sniffing takes SVGs for text.
+func imageType(name string, data []byte) string {
+	if t := mime.TypeByExtension(filepath.Ext(name)); t != "" {
+		return t
+	}
+	return http.DetectContentType(data)
+}
+
+var brandColorRe = regexp.MustCompile(`^#(?:[0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// set sets the brand's option k, one of name, color and logo, to v.
+func (b *agencyBrand) set(k, v string) error {
+	switch k {
+	case "name":
+		b.Name = v
+	case "color":
+		if !brandColorRe.MatchString(v) {
+			return fmt.Errorf("color %q should be like #1f6feb", v)
+		}
+		b.Color = v
+	case "logo":
+		data, err := os.ReadFile(v)
+		if err != nil {
+			return err
+		}
+		b.Logo, b.logo, b.logoType = v, data, imageType(v, data)
+	default:
+		return fmt.Errorf("unknown agency option %q, want name, color or logo", k)
+	}
+	return nil
+}
+
+// sourceSpecs is a flag.Value for the portals to scrape.
+type sourceSpecs []sourceSpec
+
+// Set implements flag.Value, taking a comma-separated list of portal
+// tender module URLs, each optionally prefixed with agency=. The agency
+// defaults to the portal's subdomain, or HRM for Halifax's. The agency
+// may be followed by ;option=value branding options, as in
+// "HW;name=Halifax Water;color=#1f6feb;logo=hw.png=https://...".
+func (s *sourceSpecs) Set(v string) error {
+	for _, e := range strings.Split(v, ",") {
+		e = strings.TrimSpace(e)
+		if e == "" {
+			continue
+		}
+		var spec sourceSpec
+		if i := strings.Index(e, "=http"); i >= 0 {
+			agency, opts, _ := strings.Cut(e[:i], ";")
+			spec.agency, spec.url = strings.TrimSpace(agency), e[i+1:]
+			for _, o := range strings.Split(opts, ";") {
+				if o = strings.TrimSpace(o); o == "" {
+					continue
+				}
+				k, v, _ := strings.Cut(o, "=")
+				if err := spec.brand.set(strings.TrimSpace(k), strings.TrimSpace(v)); err != nil {
+					return err
+				}
+			}
+		} else {
+			spec.url = e
+		}
+		if err := s.add(spec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// add validates spec, filling in its agency if it's not set, and adds it.
+func (s *sourceSpecs) add(spec sourceSpec) error {
+	u, err := url.Parse(spec.url)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("bad source URL %q", spec.url)
+	}
+	if spec.agency == "" && spec.url == portalURL {
+		spec.agency = portalAgency
+	} else if spec.agency == "" {
+		spec.agency, _, _ = strings.Cut(u.Host, ".")
+	}
+	*s = append(*s, spec)
+	return nil
+}
+
+// setConfig implements configValue, taking a list of what Set takes or
+// of maps with a url and optionally an agency, name, color and logo.
+func (s *sourceSpecs) setConfig(v any) error {
+	l, ok := v.([]any)
+	if !ok {
+		return s.Set(configString(v))
+	}
+	for _, e := range l {
+		m, ok := e.(map[string]any)
+		if !ok {
+			if err := s.Set(configString(e)); err != nil {
+				return err
+			}
+			continue
+		}
+		var spec sourceSpec
+		for k, v := range m {
+			var err error
+			switch k {
+			case "url":
+				spec.url = configString(v)
+			case "agency":
+				spec.agency = configString(v)
+			default:
+				err = spec.brand.set(k, configString(v))
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if err := s.add(spec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *sourceSpecs) String() string {
+	var parts []string
+	for _, spec := range *s {
+		parts = append(parts, spec.agency+"="+spec.url)
+	}
+	return strings.Join(parts, ",")
+}
+
+// client returns a Client for the portal. Tenders from portals other than
+// Halifax's get IDs prefixed with the portal's subdomain, since tender
+// numbers are only unique within a portal.
+func (spec sourceSpec) client() (*Client, error) {
+	cl, err := NewClient(spec.url, spec.agency)
+	if err != nil {
+		return nil, err
+	}
+	if spec.url != portalURL {
+		sub, _, _ := strings.Cut(cl.u.Host, ".")
+		cl.idPrefix = sub + ":"
+	}
+	return cl, nil
+}
+
+// brands returns the branding of each agency of s that has any, by
+// agency, with names defaulting to the agency.
+func (s sourceSpecs) brands() agencyBrands {
+	res := make(agencyBrands)
+	for _, spec := range s {
+		if spec.brand.Name == "" && spec.brand.Color == "" && spec.brand.Logo == "" {
+			continue
+		}
+		b := spec.brand
+		if b.Name == "" {
+			b.Name = spec.agency
+		}
+		res[spec.agency] = b
+	}
+	return res
+}
+
+// agencyBrands are agencies' branding, by agency.
+type agencyBrands map[string]agencyBrand
+
+// Name returns agency's display name.
+func (bs agencyBrands) Name(agency string) string {
+	if b, ok := bs[agency]; ok {
+		return b.Name
+	}
+	return agency
+}
+
+// subject returns the start of digest subjects for specs.
+// names returns the names the sources' runs are recorded under.
+func (s sourceSpecs) names() []string {
+	var res []string
+	for _, spec := range s {
+		if u, err := url.Parse(spec.url); err == nil {
+			res = append(res, u.String())
+		}
+	}
+	return res
+}
+
+func (s sourceSpecs) subject() string {
+	if len(s) == 1 && s[0].url == portalURL {
+		return "New HRM Tenders"
+	}
+	return "New Tenders"
+}
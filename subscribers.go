@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/mail"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// subscriber is someone sent the digest, over email or by text or call,
+// with preferences narrowing down what they're sent.
+type subscriber struct {
+	ID       int64
+	Channel  string
+	Target   string
+	Include  []string
+	Exclude  []string
+	Agencies []string
+	Created  time.Time
+}
+
+func (s subscriber) filter() recipientFilter {
+	return recipientFilter{keywordFilter: keywordFilter{include: s.Include, exclude: s.Exclude}, agencies: s.Agencies}
+}
+
+// addSubscriber adds sub, or replaces the preferences of the subscriber
+// with the same channel and target.
+func (s store) addSubscriber(sub subscriber, actor string) error {
+	switch sub.Channel {
+	case "email":
+		if _, err := mail.ParseAddress(sub.Target); err != nil {
+			return fmt.Errorf("bad email address %q: %w", sub.Target, err)
+		}
+		sub.Target = strings.ToLower(sub.Target)
+	case "sms", "voice":
+		if !phoneRe.MatchString(sub.Target) {
+			return fmt.Errorf("phone number %q should be like +19025551234", sub.Target)
+		}
+	default:
+		return fmt.Errorf("unknown channel %q, want email, sms or voice", sub.Channel)
+	}
+	_, err := s.db.Exec(`insert into subscribers (channel, target, include, exclude, agencies, created) values (?, ?, ?, ?, ?, ?)
+		on conflict (channel, target) do update set include = excluded.include, exclude = excluded.exclude, agencies = excluded.agencies`,
+		sub.Channel, sub.Target, strings.Join(sub.Include, ","), strings.Join(sub.Exclude, ","), strings.Join(sub.Agencies, ","), time.Now())
+	if err != nil {
+		return fmt.Errorf("insert subscriber: %v", err)
+	}
+	return s.audit(actor, "add subscriber", sub.Channel+":"+sub.Target, sub.filterString())
+}
+
+// removeSubscriber removes the subscribers with target, on any channel.
+func (s store) removeSubscriber(target, actor string) error {
+	if strings.Contains(target, "@") {
+		target = strings.ToLower(target)
+	}
+	res, err := s.db.Exec("delete from subscribers where target = ?", target)
+	if err != nil {
+		return fmt.Errorf("delete subscriber: %v", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return fmt.Errorf("no subscriber %s", target)
+	}
+	return s.audit(actor, "remove subscriber", target, "")
+}
+
+// subscribers returns every subscriber, by channel and target.
+func (s store) subscribers() ([]subscriber, error) {
+	rows, err := s.db.Query("select id, channel, target, include, exclude, agencies, created from subscribers order by channel, target")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []subscriber
+	for rows.Next() {
+		var sub subscriber
+		var include, exclude, agencies string
+		if err := rows.Scan(&sub.ID, &sub.Channel, &sub.Target, &include, &exclude, &agencies, &sub.Created); err != nil {
+			return nil, err
+		}
+		sub.Include, sub.Exclude, sub.Agencies = splitList(include), splitList(exclude), splitList(agencies)
+		res = append(res, sub)
+	}
+	return res, rows.Err()
+}
+
+// subscribersImportedKey is the setting holding when TO_EMAILS seeded the
+// subscribers.
+const subscribersImportedKey = "subscribers_imported"
+
+// importSubscribers adds emails as email subscribers if they've never been
+// imported and there aren't any subscribers yet, so TO_EMAILS seeds the
+// table once and removing the last subscriber doesn't bring it back. It
+// returns how many it added.
+func (s store) importSubscribers(emails []string) (int, error) {
+	imported, err := s.setting(subscribersImportedKey)
+	if err != nil || imported != "" {
+		return 0, err
+	}
+	var n int
+	if err := s.db.QueryRow("select count(*) from subscribers").Scan(&n); err != nil {
+		return 0, err
+	}
+	var added int
+	// Stores that had subscribers before imports were recorded have
+	// had theirs.
+	if n > 0 {
+		emails = nil
+	}
+	for _, e := range emails {
+		if e = strings.TrimSpace(e); e == "" {
+			continue
+		}
+		if err := s.addSubscriber(subscriber{Channel: "email", Target: e}, "import"); err != nil {
+			return added, err
+		}
+		added++
+	}
+	return added, s.setSetting(subscribersImportedKey, time.Now().UTC().Format(time.RFC3339), "import")
+}
+
+func (s subscriber) filterString() string {
+	var parts []string
+	if len(s.Include) > 0 {
+		parts = append(parts, "include "+strings.Join(s.Include, ", "))
+	}
+	if len(s.Exclude) > 0 {
+		parts = append(parts, "exclude "+strings.Join(s.Exclude, ", "))
+	}
+	if len(s.Agencies) > 0 {
+		parts = append(parts, "agencies "+strings.Join(s.Agencies, ", "))
+	}
+	return strings.Join(parts, "; ")
+}
+
+func printSubscribers(w io.Writer, subs []subscriber) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CHANNEL\tTARGET\tSINCE\tPREFERENCES")
+	for _, s := range subs {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", s.Channel, s.Target, s.Created.Format(dateFormat), s.filterString())
+	}
+	return tw.Flush()
+}
+
+// subscriberTexts is a channel texting new tenders to subscribers, each
+// narrowed down by their preferences.
+type subscriberTexts struct {
+	gw      smsGateway
+	links   linkShortener
+	horizon time.Duration
+	to      []subscriber
+}
+
+func (c subscriberTexts) name() string { return "sms" }
+
+func (c subscriberTexts) notify(ctx context.Context, ts []Tender, _ updates) error {
+	var errs []string
+	for _, sub := range c.to {
+		if err := notifySMS(ctx, c.gw, c.links, c.horizon, "your subscription", []string{sub.Target}, firstListings(sub.filter().apply(sub.Target, ts))); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%d of %d subscribers failed: %s", len(errs), len(c.to), strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// subscriberCalls is a channel calling subscribers about new tenders,
+// each narrowed down by their preferences.
+type subscriberCalls struct {
+	gw      voiceGateway
+	horizon time.Duration
+	to      []subscriber
+}
+
+func (c subscriberCalls) name() string { return "voice" }
+
+func (c subscriberCalls) notify(ctx context.Context, ts []Tender, _ updates) error {
+	var errs []string
+	for _, sub := range c.to {
+		if err := notifyVoice(ctx, c.gw, c.horizon, "your subscription", []string{sub.Target}, firstListings(sub.filter().apply(sub.Target, ts))); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%d of %d subscribers failed: %s", len(errs), len(c.to), strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// subscribers returns the subscribers that aren't paused, with the
+// -recipient-include and -recipient-exclude keywords added to their
+// preferences.
+func (d *digester) subscribers(st store) ([]subscriber, error) {
+	subs, err := st.subscribers()
+	if err != nil {
+		return nil, err
+	}
+	var targets []string
+	for _, s := range subs {
+		targets = append(targets, s.Target)
+	}
+	active, err := st.activeRecipients(targets)
+	if err != nil {
+		return nil, err
+	}
+	subs = slices.DeleteFunc(subs, func(s subscriber) bool { return !slices.Contains(active, s.Target) })
+	for i, s := range subs {
+		if f, ok := d.filters[s.Target]; ok {
+			subs[i].Include = append(slices.Clone(s.Include), f.include...)
+			subs[i].Exclude = append(slices.Clone(s.Exclude), f.exclude...)
+		}
+	}
+	return subs, nil
+}
+
+// channelsFor returns the subscriber channels for subs besides email,
+// logging those that can't be used since Twilio isn't configured.
+func (d *digester) channelsFor(subs []subscriber) []channel {
+	var texts, calls []subscriber
+	for _, s := range subs {
+		switch s.Channel {
+		case "sms":
+			texts = append(texts, s)
+		case "voice":
+			calls = append(calls, s)
+		}
+	}
+	var chs []channel
+	if len(texts) > 0 && d.sms == nil {
+		slog.Warn("not texting subscribers since TWILIO_ACCOUNT_SID, TWILIO_AUTH_TOKEN and TWILIO_FROM aren't all set", "subscribers", len(texts))
+	} else if len(texts) > 0 {
+		chs = append(chs, subscriberTexts{gw: d.sms, links: d.links, horizon: d.closingSoon["sms"], to: texts})
+	}
+	if len(calls) > 0 && d.voice == nil {
+		slog.Warn("not calling subscribers since TWILIO_ACCOUNT_SID, TWILIO_AUTH_TOKEN and TWILIO_FROM aren't all set", "subscribers", len(calls))
+	} else if len(calls) > 0 {
+		chs = append(chs, subscriberCalls{gw: d.voice, horizon: d.closingSoon["voice"], to: calls})
+	}
+	return chs
+}
+
+// emailFilters returns the email targets of subs and their filters.
+func emailFilters(subs []subscriber) ([]string, recipientFilters) {
+	var to []string
+	filters := recipientFilters{}
+	for _, s := range subs {
+		if s.Channel != "email" {
+			continue
+		}
+		to = append(to, s.Target)
+		if f := s.filter(); !f.empty() {
+			filters[s.Target] = f
+		}
+	}
+	return to, filters
+}
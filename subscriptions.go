@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// pauseRecipient stops digests to email until resumeRecipient is called.
+func (s store) pauseRecipient(email, actor string) error {
+	email = strings.ToLower(strings.TrimSpace(email))
+	_, err := s.db.Exec("insert into subscriptions (email, paused_at) values (?, ?) on conflict (email) do update set paused_at = excluded.paused_at",
+		email, time.Now(),
+	)
+	if err != nil {
+		return fmt.Errorf("pausing %s: %v", email, err)
+	}
+	return s.audit(actor, "pause", email, "")
+}
+
+func (s store) resumeRecipient(email, actor string) error {
+	email = strings.ToLower(strings.TrimSpace(email))
+	_, err := s.db.Exec("insert into subscriptions (email, paused_at) values (?, null) on conflict (email) do update set paused_at = null",
+		email,
+	)
+	if err != nil {
+		return fmt.Errorf("resuming %s: %v", email, err)
+	}
+	return s.audit(actor, "resume", email, "")
+}
+
+// activeRecipients returns the addresses in emails that aren't paused.
+func (s store) activeRecipients(emails []string) ([]string, error) {
+	rows, err := s.db.Query("select email from subscriptions where paused_at is not null")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	paused := make(map[string]bool)
+	for rows.Next() {
+		var email string
+		if err := rows.Scan(&email); err != nil {
+			return nil, err
+		}
+		paused[email] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var active []string
+	for _, e := range emails {
+		addr := strings.ToLower(strings.TrimSpace(e))
+		if i := strings.LastIndex(addr, "<"); i >= 0 {
+			addr = strings.TrimSuffix(addr[i+1:], ">")
+		}
+		if !paused[addr] {
+			active = append(active, e)
+		}
+	}
+	return active, nil
+}
+
+func (s store) audit(actor, action, subject, detail string) error {
+	_, err := s.db.Exec("insert into audit_log (at, actor, action, subject, detail) values (?, ?, ?, ?, ?)",
+		time.Now(), actor, action, subject, detail,
+	)
+	if err != nil {
+		return fmt.Errorf("audit: %v", err)
+	}
+	return nil
+}
+
+// cliActor identifies the user running a command for the audit log.
+func cliActor() string {
+	if u := os.Getenv("USER"); u != "" {
+		return "cli:" + u
+	}
+	return "cli"
+}
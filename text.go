@@ -0,0 +1,27 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// cleanText normalizes portal text to NFC, so accented letters compare and
+// search the same however they were entered, turns any kind of space into
+// a plain one and drops control and formatting characters such as
+// zero-width spaces. Everything else, such as French accents and em
+// dashes, is kept. Runs of spaces are squeezed.
+func cleanText(s string) string {
+	s = norm.NFC.String(s)
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsSpace(r):
+			return ' '
+		case unicode.In(r, unicode.Cc, unicode.Cf, unicode.Co, unicode.Cs), r == unicode.ReplacementChar:
+			return -1
+		}
+		return r
+	}, s)
+	return strings.TrimSpace(squeezeRe.ReplaceAllString(s, " "))
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// runStage runs f with a context that's done when ctx is or after
+// timeout, if it's positive, giving up on f then. f should stop once its
+// context is done, but keeps running in the background if it doesn't, so
+// it should be something that closing the browser or exiting will stop.
+func runStage(ctx context.Context, stage string, timeout time.Duration, f func(context.Context) error) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- f(ctx) }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("%s: %w", stage, ctx.Err())
+	}
+}
+
+// runSend runs the send f with a context that's done when ctx is or after
+// timeout, if it's positive. Unlike runStage, it waits for f to return
+// rather than giving up on it, so a send that goes through late isn't
+// taken for a failed one and sent again. f has to stop soon after its
+// context is done.
+func runSend(ctx context.Context, timeout time.Duration, f func(context.Context) error) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return f(ctx)
+}
+
+// sleep waits for d, or returns ctx's error if it's done first.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// pwTimeout returns the timeout in milliseconds to give a Playwright call
+// so it gives up when ctx's deadline passes, if it has one, or after
+// limit, if it's given and sooner. It returns nil for Playwright's default
+// if there's neither.
+func pwTimeout(ctx context.Context, limit ...time.Duration) *float64 {
+	var d time.Duration
+	if dl, ok := ctx.Deadline(); ok {
+		// Playwright takes 0 as no timeout at all.
+		d = max(time.Until(dl), time.Millisecond)
+	}
+	for _, m := range limit {
+		if d == 0 || m < d {
+			d = m
+		}
+	}
+	if d == 0 {
+		return nil
+	}
+	return ptr(float64(d.Milliseconds()))
+}
+
+// timeoutGrace is how long after -timeout a run that's ignoring its
+// context is given before the process exits anyway.
+const timeoutGrace = time.Minute
+
+// withDeadline returns a context that's done after timeout, if it's
+// positive, for the whole of a run. Since a hung browser may never notice,
+// the process exits timeoutGrace later unless stop is called first.
+func withDeadline(ctx context.Context, timeout time.Duration) (context.Context, func()) {
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	watchdog := time.AfterFunc(timeout+timeoutGrace, func() {
+		slog.Error("run still going after -timeout, exiting", "timeout", timeout)
+		exit(1)
+	})
+	return ctx, func() {
+		watchdog.Stop()
+		cancel()
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// API tokens are stored as SHA-256 hashes, so a leaked database doesn't
+// leak usable tokens. Scopes are read and write.
+var tokenScopes = []string{"read", "write"}
+
+type apiToken struct {
+	ID       int64
+	Name     string
+	Scopes   []string
+	Created  time.Time
+	LastUsed sql.NullTime
+	Revoked  sql.NullTime
+}
+
+func hashToken(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
+
+// createToken stores a new token and returns it. It can't be retrieved
+// again later.
+func (s store) createToken(name string, scopes []string, actor string) (string, error) {
+	for _, sc := range scopes {
+		if !slices.Contains(tokenScopes, sc) {
+			return "", fmt.Errorf("unknown scope %q, want one of %s", sc, strings.Join(tokenScopes, ", "))
+		}
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := "td_" + base64.RawURLEncoding.EncodeToString(b)
+
+	_, err := s.db.Exec("insert into api_tokens (name, hash, scopes, created) values (?, ?, ?, ?)", name, hashToken(token), strings.Join(scopes, ","), time.Now())
+	if err != nil {
+		return "", fmt.Errorf("insert token: %v", err)
+	}
+	return token, s.audit(actor, "create token", name, strings.Join(scopes, ","))
+}
+
+func (s store) revokeToken(name, actor string) error {
+	res, err := s.db.Exec("update api_tokens set revoked = ? where name = ? and revoked is null", time.Now(), name)
+	if err != nil {
+		return fmt.Errorf("revoke token: %v", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return fmt.Errorf("no active token named %q", name)
+	}
+	return s.audit(actor, "revoke token", name, "")
+}
+
+func (s store) tokens() ([]apiToken, error) {
+	rows, err := s.db.Query("select id, name, scopes, created, last_used, revoked from api_tokens order by id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []apiToken
+	for rows.Next() {
+		var t apiToken
+		var scopes string
+		if err := rows.Scan(&t.ID, &t.Name, &scopes, &t.Created, &t.LastUsed, &t.Revoked); err != nil {
+			return nil, err
+		}
+		t.Scopes = strings.Split(scopes, ",")
+		res = append(res, t)
+	}
+	return res, rows.Err()
+}
+
+// tokenFor returns the active token matching token.
+func (s store) tokenFor(token string) (apiToken, error) {
+	var t apiToken
+	var scopes string
+	err := s.db.QueryRow("select id, name, scopes from api_tokens where hash = ? and revoked is null", hashToken(token)).Scan(&t.ID, &t.Name, &scopes)
+	if err != nil {
+		return apiToken{}, err
+	}
+	t.Scopes = strings.Split(scopes, ",")
+	if _, err := s.db.Exec("update api_tokens set last_used = ? where id = ?", time.Now(), t.ID); err != nil {
+		return apiToken{}, err
+	}
+	return t, nil
+}
+
+type tokenNameKey struct{}
+
+// requireScope wraps h so it only runs for requests bearing an active
+// token with scope, as a bearer token or a basic auth password. Since
+// browsers keep sending basic auth once given, requests that change
+// things are refused when they come from another site.
+func requireScope(st store, scope string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" && r.Method != "HEAD" && crossSite(r) {
+			http.Error(w, "cross-site request refused", http.StatusForbidden)
+			return
+		}
+		bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			// Webhooks that can only send credentials in the URL send the
+			// token as the password.
+			_, bearer, ok = r.BasicAuth()
+		}
+		if !ok {
+			// Browsers prompt for Basic, so the admin pages' forms can
+			// take the token as the password too.
+			w.Header().Add("WWW-Authenticate", "Bearer")
+			w.Header().Add("WWW-Authenticate", `Basic realm="tender-digest"`)
+			http.Error(w, "missing bearer token", http.StatusUnauthorized)
+			return
+		}
+		t, err := st.tokenFor(bearer)
+		if err == sql.ErrNoRows {
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !slices.Contains(t.Scopes, scope) {
+			http.Error(w, "token lacks "+scope+" scope", http.StatusForbidden)
+			return
+		}
+		h(w, r.WithContext(context.WithValue(r.Context(), tokenNameKey{}, t.Name)))
+	}
+}
+
+// crossSite reports whether a browser says r comes from a page on another
+// site. Requests not from browsers say nothing and aren't.
+func crossSite(r *http.Request) bool {
+	if o := r.Header.Get("Origin"); o != "" {
+		u, err := url.Parse(o)
+		return err != nil || u.Host != r.Host
+	}
+	switch r.Header.Get("Sec-Fetch-Site") {
+	case "", "same-origin", "none":
+		return false
+	}
+	return true
+}
+
+func printTokens(w io.Writer, st store) error {
+	ts, err := st.tokens()
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tSCOPES\tCREATED\tLAST USED\tREVOKED")
+	for _, t := range ts {
+		lastUsed, revoked := "never", "-"
+		if t.LastUsed.Valid {
+			lastUsed = t.LastUsed.Time.Format(time.RFC3339)
+		}
+		if t.Revoked.Valid {
+			revoked = t.Revoked.Time.Format(time.RFC3339)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", t.Name, strings.Join(t.Scopes, ","), t.Created.Format(time.RFC3339), lastUsed, revoked)
+	}
+	return tw.Flush()
+}
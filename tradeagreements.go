@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// tradeTerms records which trade agreements a tender says it is subject
+// to, and whether it is restricted to local suppliers.
+type tradeTerms struct {
+	Agreements []string
+	LocalOnly  bool
+}
+
+var tradeAgreementRes = []struct {
+	name string
+	re   *regexp.Regexp
+}{
+	{"CFTA", regexp.MustCompile(`(?i)\bCFTA\b|canadian\s+free\s+trade\s+agreement`)},
+	{"CETA", regexp.MustCompile(`(?i)\bCETA\b|comprehensive\s+economic\s+and\s+trade\s+agreement`)},
+	{"ACFTA", regexp.MustCompile(`(?i)\bACFTA\b|atlantic\s+(?:canada|procurement)\s+(?:free\s+trade\s+)?agreement`)},
+	{"CUSMA", regexp.MustCompile(`(?i)\bCUSMA\b|\bNAFTA\b`)},
+	{"WTO-AGP", regexp.MustCompile(`(?i)\bWTO[- ]?AGP\b|agreement\s+on\s+government\s+procurement`)},
+	{"CPTPP", regexp.MustCompile(`(?i)\bCPTPP\b`)},
+}
+
+var localOnlyRe = regexp.MustCompile(`(?i)\b(?:restricted|limited|open)\s+(?:only\s+)?to\s+(?:local|nova\s+scotia|hrm|halifax|atlantic)(?:[\s-]based)?\s+(?:suppliers|vendors|businesses|firms|contractors)|\b(?:local|nova\s+scotia)\s+(?:suppliers|vendors|businesses)\s+only\b`)
+
+// detectTradeTerms finds trade agreement and local supplier statements in
+// text, returning nil if there are none.
+func detectTradeTerms(text string) *tradeTerms {
+	var tt tradeTerms
+	for _, a := range tradeAgreementRes {
+		if a.re.MatchString(text) {
+			tt.Agreements = append(tt.Agreements, a.name)
+		}
+	}
+	tt.LocalOnly = localOnlyRe.MatchString(text)
+	if len(tt.Agreements) == 0 && !tt.LocalOnly {
+		return nil
+	}
+	return &tt
+}
+
+func (tt tradeTerms) String() string {
+	var parts []string
+	if len(tt.Agreements) > 0 {
+		parts = append(parts, "subject to "+strings.Join(tt.Agreements, ", "))
+	}
+	if tt.LocalOnly {
+		parts = append(parts, "local suppliers only")
+	}
+	return strings.Join(parts, "; ")
+}
+
+// filterTradeTerms returns ts without local-only tenders if skipLocalOnly
+// is set, and, if requireAgreements isn't empty, without tenders that
+// don't state they're subject to at least one of them.
+func filterTradeTerms(ts []Tender, skipLocalOnly bool, requireAgreements []string) []Tender {
+	var res []Tender
+	for _, t := range ts {
+		if why := tradeTermsExclusion(t, skipLocalOnly, requireAgreements); why != "" {
+			slog.Info("leaving out tender", "tender", t.ID, "reason", why)
+			continue
+		}
+		res = append(res, t)
+	}
+	return res
+}
+
+// tradeTermsExclusion returns why t's trade terms leave it out, or "" if
+// they don't.
+func tradeTermsExclusion(t Tender, skipLocalOnly bool, requireAgreements []string) string {
+	if skipLocalOnly && t.TradeTerms != nil && t.TradeTerms.LocalOnly {
+		return "restricted to local suppliers"
+	}
+	if len(requireAgreements) > 0 {
+		var agreements []string
+		if t.TradeTerms != nil {
+			agreements = t.TradeTerms.Agreements
+		}
+		if !slices.ContainsFunc(requireAgreements, func(a string) bool { return slices.Contains(agreements, strings.ToUpper(a)) }) {
+			return "not subject to any of " + strings.Join(requireAgreements, ", ")
+		}
+	}
+	return ""
+}
+
+func (s store) setTradeTerms(tenderID string, tt *tradeTerms) error {
+	if tt == nil {
+		return nil
+	}
+	_, err := s.db.Exec("insert into trade_terms (tender_id, agreements, local_only) values (?, ?, ?) on conflict (tender_id) do update set agreements = excluded.agreements, local_only = excluded.local_only",
+		tenderID, strings.Join(tt.Agreements, ","), tt.LocalOnly,
+	)
+	if err != nil {
+		return fmt.Errorf("insert trade terms: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+// portalLocation is where portal dates are when an item's TimeZoneLabel
+// doesn't say, set with -tz.
+var portalLocation = func() *time.Location {
+	loc, err := time.LoadLocation("America/Halifax")
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}()
+
+// zoneLabels map words in the portal's TimeZoneLabel, such as "Atlantic
+// Time" or "ADT", to the location they name, for labels that aren't
+// location names themselves.
+var zoneLabels = []struct {
+	words []string
+	name  string
+}{
+	{[]string{"newfoundland", "nst", "ndt"}, "America/St_Johns"},
+	{[]string{"atlantic", "ast", "adt"}, "America/Halifax"},
+	{[]string{"eastern", "est", "edt"}, "America/Toronto"},
+	{[]string{"central", "cst", "cdt"}, "America/Winnipeg"},
+	{[]string{"mountain", "mst", "mdt"}, "America/Edmonton"},
+	{[]string{"pacific", "pst", "pdt"}, "America/Vancouver"},
+}
+
+// labelLocation returns the location the portal's TimeZoneLabel label
+// names, or portalLocation if it's empty or unrecognized.
+func labelLocation(label string) *time.Location {
+	label = strings.TrimSpace(label)
+	if label == "" {
+		return portalLocation
+	}
+	// Abbreviations like EST load as fixed offsets, but the portal means
+	// the zone, daylight time and all.
+	if strings.Contains(label, "/") || label == "UTC" {
+		if loc, err := time.LoadLocation(label); err == nil {
+			return loc
+		}
+	}
+	words := strings.FieldsFunc(strings.ToLower(label), func(r rune) bool {
+		return !('a' <= r && r <= 'z')
+	})
+	for _, z := range zoneLabels {
+		for _, w := range words {
+			if !slices.Contains(z.words, w) {
+				continue
+			}
+			if loc, err := time.LoadLocation(z.name); err == nil {
+				return loc
+			}
+		}
+	}
+	return portalLocation
+}
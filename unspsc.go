@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// unspscMap assigns UNSPSC commodity codes to tenders by keywords in their
+// description, for portals that don't expose codes themselves.
+type unspscMap []unspscRule
+
+type unspscRule struct {
+	code string
+	re   *regexp.Regexp
+}
+
+// loadUNSPSCMap reads a CSV file where each record is a UNSPSC code
+// followed by one or more keywords or phrases that map to it, such as:
+//
+//	72141103,paving,asphalt,resurfacing
+func loadUNSPSCMap(path string) (unspscMap, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	r.Comment = '#'
+	recs, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+
+	var m unspscMap
+	for _, rec := range recs {
+		if len(rec) < 2 {
+			return nil, fmt.Errorf("%s: want code and at least one keyword, got %q", path, rec)
+		}
+		var alts []string
+		for _, kw := range rec[1:] {
+			if kw = strings.TrimSpace(kw); kw != "" {
+				alts = append(alts, strings.Join(strings.Fields(regexp.QuoteMeta(kw)), `\s+`))
+			}
+		}
+		re, err := regexp.Compile(`(?i)\b(?:` + strings.Join(alts, "|") + `)\b`)
+		if err != nil {
+			return nil, err
+		}
+		m = append(m, unspscRule{code: strings.TrimSpace(rec[0]), re: re})
+	}
+	return m, nil
+}
+
+// codes returns the codes whose keywords appear in text.
+func (m unspscMap) codes(text string) []string {
+	var codes []string
+	for _, r := range m {
+		if r.re.MatchString(text) && !slices.Contains(codes, r.code) {
+			codes = append(codes, r.code)
+		}
+	}
+	return codes
+}
+
+// filterUNSPSC returns the tenders in ts with a code starting with one of
+// prefixes, so a segment such as 72 or a class such as 721411 selects
+// everything under it. With no prefixes ts is returned as is.
+func filterUNSPSC(ts []Tender, prefixes []string) []Tender {
+	if len(prefixes) == 0 {
+		return ts
+	}
+	var res []Tender
+	for _, t := range ts {
+		if why := unspscExclusion(t, prefixes); why != "" {
+			slog.Info("leaving out tender", "tender", t.ID, "reason", why)
+			continue
+		}
+		res = append(res, t)
+	}
+	return res
+}
+
+// unspscExclusion returns why t's UNSPSC codes leave it out, or "" if they
+// don't.
+func unspscExclusion(t Tender, prefixes []string) string {
+	if len(prefixes) == 0 || slices.ContainsFunc(t.UNSPSC, func(code string) bool {
+		return slices.ContainsFunc(prefixes, func(p string) bool { return strings.HasPrefix(code, p) })
+	}) {
+		return ""
+	}
+	return "no UNSPSC code under " + strings.Join(prefixes, ", ")
+}
+
+func (s store) setUNSPSC(tenderID string, codes []string) error {
+	for _, c := range codes {
+		if _, err := s.db.Exec("insert into tender_unspsc (tender_id, code) values (?, ?) on conflict do nothing", tenderID, c); err != nil {
+			return fmt.Errorf("insert unspsc: %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"slices"
+	"time"
+)
+
+// updates are what a digest says besides announcing new tenders.
+type updates struct {
+	alerts      []documentAlert
+	reminders   []questionReminder
+	retractions []retraction
+	changes     []tenderChange
+}
+
+func (u updates) empty() bool {
+	return len(u.alerts) == 0 && len(u.reminders) == 0 && len(u.retractions) == 0 && len(u.changes) == 0
+}
+
+// pendingUpdates returns the updates that haven't been notified yet, with
+// question reminders for deadlines within reminderWithin of now.
+func (s store) pendingUpdates(reminderWithin time.Duration, now time.Time) (updates, error) {
+	var u updates
+	var err error
+	if u.alerts, err = s.pendingDocumentAlerts(); err != nil {
+		return updates{}, err
+	}
+	if u.reminders, err = s.dueQuestionReminders(reminderWithin, now); err != nil {
+		return updates{}, err
+	}
+	if u.retractions, err = s.pendingRetractions(); err != nil {
+		return updates{}, err
+	}
+	if u.changes, err = s.pendingChanges(); err != nil {
+		return updates{}, err
+	}
+	return u, nil
+}
+
+func (s store) markUpdatesNotified(u updates) error {
+	if err := s.markDocumentAlertsNotified(u.alerts); err != nil {
+		return err
+	}
+	if err := s.markQuestionRemindersSent(u.reminders); err != nil {
+		return err
+	}
+	if err := s.markRetractionsNotified(u.retractions); err != nil {
+		return err
+	}
+	return s.markChangesNotified(u.changes)
+}
+
+// merge returns u with the updates in o it doesn't already have.
+func (u updates) merge(o updates) updates {
+	res := updates{
+		alerts:      slices.Clone(u.alerts),
+		reminders:   slices.Clone(u.reminders),
+		retractions: slices.Clone(u.retractions),
+		changes:     slices.Clone(u.changes),
+	}
+	for _, a := range o.alerts {
+		if !slices.ContainsFunc(res.alerts, func(b documentAlert) bool { return b.ID == a.ID }) {
+			res.alerts = append(res.alerts, a)
+		}
+	}
+	for _, r := range o.reminders {
+		if !slices.ContainsFunc(res.reminders, func(b questionReminder) bool { return b.TenderID == r.TenderID && b.At.Equal(r.At) }) {
+			res.reminders = append(res.reminders, r)
+		}
+	}
+	for _, r := range o.retractions {
+		if !slices.ContainsFunc(res.retractions, func(b retraction) bool { return b.TenderID == r.TenderID }) {
+			res.retractions = append(res.retractions, r)
+		}
+	}
+	for _, c := range o.changes {
+		if !slices.ContainsFunc(res.changes, func(b tenderChange) bool { return b.ID == c.ID }) {
+			res.changes = append(res.changes, c)
+		}
+	}
+	return res
+}
+
+// only returns the updates in u about tenders keep reports true for.
+func (u updates) only(keep func(tenderID string) bool) updates {
+	var res updates
+	for _, a := range u.alerts {
+		if keep(a.TenderID) {
+			res.alerts = append(res.alerts, a)
+		}
+	}
+	for _, r := range u.reminders {
+		if keep(r.TenderID) {
+			res.reminders = append(res.reminders, r)
+		}
+	}
+	for _, r := range u.retractions {
+		if keep(r.TenderID) {
+			res.retractions = append(res.retractions, r)
+		}
+	}
+	for _, c := range u.changes {
+		if keep(c.TenderID) {
+			res.changes = append(res.changes, c)
+		}
+	}
+	return res
+}
+
+// updatedTenders returns the tenders u is about, by ID.
+func (s store) updatedTenders(u updates) (map[string]Tender, error) {
+	res := make(map[string]Tender)
+	for _, a := range u.alerts {
+		res[a.TenderID] = Tender{}
+	}
+	for _, r := range u.reminders {
+		res[r.TenderID] = Tender{}
+	}
+	for _, r := range u.retractions {
+		res[r.TenderID] = Tender{}
+	}
+	for _, c := range u.changes {
+		res[c.TenderID] = Tender{}
+	}
+	for id := range res {
+		ts, err := s.selectTenders("select "+tenderColumns+" from tenders where id = ?", id)
+		if err != nil {
+			return nil, err
+		}
+		if len(ts) == 0 {
+			delete(res, id)
+			continue
+		}
+		res[id] = ts[0]
+	}
+	return res, nil
+}
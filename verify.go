@@ -0,0 +1,165 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// recordRaw keeps the portal's item for a newly stored tender, so that
+// later parser versions can be checked against what this one stored.
+func (s store) recordRaw(tenderID string, raw []byte) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	_, err := s.db.Exec("insert into raw_tenders (tender_id, fetched, data) values (?, ?, ?) on conflict do nothing", tenderID, time.Now(), raw)
+	if err != nil {
+		return fmt.Errorf("insert raw tender: %v", err)
+	}
+	return nil
+}
+
+// verify reparses every recorded raw item with the client in cls for the
+// portal it came from and writes how the result differs from what's
+// stored to w, reporting whether anything did. It's meant for checking a
+// new version before letting it loose on a production store.
+func verify(w io.Writer, cls []*Client, st store) (bool, error) {
+	rows, err := st.db.Query("select tender_id, data from raw_tenders order by tender_id")
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	type rawRow struct {
+		id   string
+		data []byte
+	}
+	var raws []rawRow
+	for rows.Next() {
+		var r rawRow
+		if err := rows.Scan(&r.id, &r.data); err != nil {
+			return false, err
+		}
+		raws = append(raws, r)
+	}
+	if err := rows.Err(); err != nil {
+		return false, err
+	}
+
+	var checked, differing int
+	for _, r := range raws {
+		var d RawTender
+		if err := json.Unmarshal(r.data, &d); err != nil {
+			return false, fmt.Errorf("%s: %w", r.id, err)
+		}
+		checked++
+
+		stored, err := st.verifyFields(r.id)
+		if err != nil {
+			return false, fmt.Errorf("%s: %w", r.id, err)
+		}
+
+		cl := cls[0]
+		if su, err := url.Parse(stored["url"]); err == nil {
+			for _, c := range cls {
+				if c.u.Host == su.Host {
+					cl = c
+				}
+			}
+		}
+
+		parsed := map[string]string{}
+		t, err := cl.parse(d)
+		if err != nil {
+			parsed["error"] = err.Error()
+		} else {
+			parsed = verifyFields(t)
+			// Placeholder dates parse as the current time, so they can't
+			// match what was stored.
+			if strings.Contains(d.DateAvailableDisplay, "9999") {
+				parsed["issued"] = stored["issued"]
+			}
+			if strings.Contains(d.DateClosingDisplay, "9999") {
+				parsed["close"] = stored["close"]
+			}
+			// Dates stored without times can only be compared as dates.
+			for _, k := range []string{"issued", "close"} {
+				if len(stored[k]) == len(dateFormat) && len(parsed[k]) > len(dateFormat) {
+					parsed[k] = parsed[k][:len(dateFormat)]
+				}
+			}
+		}
+
+		var keys []string
+		for k := range stored {
+			keys = append(keys, k)
+		}
+		for k := range parsed {
+			if _, ok := stored[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		slices.Sort(keys)
+
+		diff := false
+		for _, k := range keys {
+			if stored[k] != parsed[k] {
+				fmt.Fprintf(w, "%s %s: stored %q, now parses as %q\n", r.id, k, stored[k], parsed[k])
+				diff = true
+			}
+		}
+		if diff {
+			differing++
+		}
+	}
+
+	fmt.Fprintf(w, "checked %d recorded tenders, %d differ\n", checked, differing)
+	return differing > 0, nil
+}
+
+// verifyFields returns the parsed fields of t that are stored, in the
+// form they're stored in.
+func verifyFields(t Tender) map[string]string {
+	f := map[string]string{
+		"id":          t.ID,
+		"url":         t.URL,
+		"description": t.Description,
+		"agency":      t.Agency,
+		"issued":      formatStoredTime(t.IssuedDate),
+		"close":       formatStoredTime(t.CloseDate),
+	}
+	var events []string
+	for _, e := range t.Events {
+		events = append(events, e.String())
+	}
+	slices.Sort(events)
+	f["events"] = strings.Join(events, "; ")
+	if t.BidSecurity != nil {
+		f["bid security"] = t.BidSecurity.String()
+	}
+	if t.TradeTerms != nil {
+		f["trade terms"] = t.TradeTerms.String()
+	}
+	return f
+}
+
+// verifyFields loads the stored fields of the tender with id in the form
+// verifyFields(Tender) returns them.
+func (s store) verifyFields(id string) (map[string]string, error) {
+	t, err := s.archivedTender(id)
+	if err == sql.ErrNoRows {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := s.loadDetails(&t.Tender); err != nil {
+		return nil, err
+	}
+	return verifyFields(t.Tender), nil
+}
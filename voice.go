@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// voiceGateway places a call that reads message aloud.
+type voiceGateway interface {
+	call(ctx context.Context, to, message string) error
+}
+
+func (g twilio) call(ctx context.Context, to, message string) error {
+	var say strings.Builder
+	xml.EscapeText(&say, []byte(message))
+	twiml := `<Response><Say voice="alice" language="en-CA">` + say.String() + `</Say><Pause length="1"/><Say voice="alice" language="en-CA">` + say.String() + `</Say></Response>`
+	return g.post(ctx, "Calls.json", url.Values{"To": {to}, "From": {g.from}, "Twiml": {twiml}})
+}
+
+// maxVoiceTenders is how many tenders a call reads out before just saying
+// how many more there are.
+const maxVoiceTenders = 3
+
+// notifyVoice calls each of to once about ts, matching the saved search
+// name, reading out each tender's description and close date. Tenders
+// closing within horizon are read out first and called out as such.
+func notifyVoice(ctx context.Context, g voiceGateway, horizon time.Duration, name string, to []string, ts []Tender) error {
+	if len(ts) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	ts = slices.Clone(ts)
+	slices.SortStableFunc(ts, func(a, b Tender) int {
+		as, bs := closingSoon(a, horizon, now), closingSoon(b, horizon, now)
+		switch {
+		case as && !bs:
+			return -1
+		case bs && !as:
+			return 1
+		}
+		return 0
+	})
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Tender digest alert. %d new tenders match %s.", len(ts), name)
+	for i, t := range ts {
+		if i == maxVoiceTenders {
+			fmt.Fprintf(&b, " And %d more. Check your email for details.", len(ts)-i)
+			break
+		}
+		soon := ""
+		if closingSoon(t, horizon, now) {
+			soon = "closing soon, "
+		}
+		fmt.Fprintf(&b, " %s, %sclosing %s.", squeezeRe.ReplaceAllString(t.Description, " "), soon, t.CloseDate.Format("Monday, January 2 at 3:04 PM"))
+	}
+
+	var errs []string
+	for _, num := range to {
+		if err := g.call(ctx, num, b.String()); err != nil {
+			slog.Error("calling", "to", num, "err", err)
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%d of %d numbers failed: %s", len(errs), len(to), strings.Join(errs, "; "))
+	}
+	return nil
+}
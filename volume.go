@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"text/tabwriter"
+	"time"
+)
+
+// volumeWeeks is how many weeks of runs a source's usual volume is taken
+// from.
+const volumeWeeks = 8
+
+// volumeMinRuns is how many earlier runs on the same weekday it takes
+// before a run's volume is judged.
+const volumeMinRuns = 3
+
+// volumeFactor is how many times more or fewer tenders than usual a run
+// has to list to look wrong.
+const volumeFactor = 3
+
+// volumeMinDiff is how far from usual a run's volume has to be to look
+// wrong, so a source listing a handful of tenders isn't flagged for
+// listing a few more.
+const volumeMinDiff = 10
+
+// usualVolume returns the median number of tenders source listed on runs
+// on the same weekday as at, in portalLocation, over the volumeWeeks
+// before it, and how many runs that's from. Failed runs and runs whose
+// volume looked wrong are left out, so a stretch of them doesn't become
+// the norm.
+func (s store) usualVolume(source string, at time.Time) (median, runs int, err error) {
+	rows, err := s.db.Query(`select started, tenders from runs
+		where source = ? and error is null and anomaly is null and tenders is not null
+		and datetime(started) >= datetime(?) and datetime(started) < datetime(?)`, source, at.AddDate(0, 0, -7*volumeWeeks), at)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer rows.Close()
+
+	day := at.In(portalLocation).Weekday()
+	var counts []int
+	for rows.Next() {
+		var started time.Time
+		var n int
+		if err := rows.Scan(&started, &n); err != nil {
+			return 0, 0, err
+		}
+		if started.In(portalLocation).Weekday() == day {
+			counts = append(counts, n)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, 0, err
+	}
+	if len(counts) == 0 {
+		return 0, 0, nil
+	}
+	slices.Sort(counts)
+	return counts[len(counts)/2], len(counts), nil
+}
+
+// volumeAnomaly returns why source listing n tenders on a run at at looks
+// wrong compared to its usual volume for the weekday, or "" if it
+// doesn't or there aren't enough runs to tell.
+func (s store) volumeAnomaly(source string, at time.Time, n int) (string, error) {
+	usual, runs, err := s.usualVolume(source, at)
+	if err != nil || runs < volumeMinRuns {
+		return "", err
+	}
+	day := at.In(portalLocation).Weekday()
+	switch {
+	case n == 0 && usual > 0:
+		return fmt.Sprintf("listed no tenders, %d is usual on a %s", usual, day), nil
+	case n*volumeFactor < usual && usual-n >= volumeMinDiff:
+		return fmt.Sprintf("listed %d tenders, far fewer than the %d usual on a %s", n, usual, day), nil
+	case n > usual*volumeFactor && n-usual >= volumeMinDiff:
+		return fmt.Sprintf("listed %d tenders, far more than the %d usual on a %s", n, usual, day), nil
+	}
+	return "", nil
+}
+
+// printVolumes writes how many tenders each source listed on its latest
+// run, against what's usual on that weekday.
+func printVolumes(w io.Writer, st store) error {
+	rows, err := st.db.Query(`select source, started, tenders, coalesce(anomaly, '') from runs
+		where id in (select max(id) from runs where error is null and tenders is not null group by source)
+		order by source`)
+	if err != nil {
+		return err
+	}
+	type latest struct {
+		source  string
+		started time.Time
+		tenders int
+		anomaly string
+	}
+	var ls []latest
+	for rows.Next() {
+		var l latest
+		if err := rows.Scan(&l.source, &l.started, &l.tenders, &l.anomaly); err != nil {
+			rows.Close()
+			return err
+		}
+		ls = append(ls, l)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SOURCE\tLAST RUN\tLISTED\tUSUAL\tRUNS\tANOMALY")
+	for _, l := range ls {
+		usual, runs, err := st.usualVolume(l.source, l.started)
+		if err != nil {
+			return err
+		}
+		usualText := "-"
+		if runs > 0 {
+			usualText = fmt.Sprint(usual)
+		}
+		anomaly := "-"
+		if l.anomaly != "" {
+			anomaly = l.anomaly
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%d\t%s\n", l.source, l.started.In(portalLocation).Format("Mon 2006-01-02 15:04"), l.tenders, usualText, runs, anomaly)
+	}
+	return tw.Flush()
+}